@@ -0,0 +1,71 @@
+// Package api contains the http handlers of the json api served under /api/v1.
+package api
+
+import (
+	"backend/db"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Server serves the api from an etf repository.
+type Server struct {
+	repo db.EtfRepository
+}
+
+func NewServer(repo db.EtfRepository) *Server {
+	return &Server{repo: repo}
+}
+
+// Register adds the api routes to mux.
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/changes", s.HandleChanges)
+	mux.HandleFunc("GET /api/v1/etfs", s.HandleEtfs)
+	mux.HandleFunc("GET /api/v1/etfs/{symbol}", s.HandleEtfProfile)
+	mux.HandleFunc("GET /api/fetchEtfProfile", s.HandleEtfProfile) // Unversioned route kept for existing clients
+	mux.HandleFunc("GET /api/v1/compare", s.HandleCompare)
+	mux.HandleFunc("GET /api/v1/search", s.HandleSearch)
+	mux.HandleFunc("GET /api/v1/search/autocomplete", s.HandleAutocomplete)
+	mux.HandleFunc("GET /api/v1/screens", s.HandleScreens)
+	mux.HandleFunc("GET /api/v1/screens/{name}", s.HandleScreen)
+	mux.HandleFunc("PUT /api/v1/screens/{name}", s.HandleSaveScreen)
+	mux.HandleFunc("DELETE /api/v1/screens/{name}", s.HandleDeleteScreen)
+	mux.HandleFunc("GET /api/v1/screens/{name}/etfs", s.HandleScreenEtfs)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+// writeRepositoryError maps the kind of a repository error to its status code.
+// Only client errors include the error message, others are logged with what failed.
+func writeRepositoryError(w http.ResponseWriter, err error, what string) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, db.ErrValidation):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, db.ErrConflict):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, db.ErrTransient), errors.Is(err, context.DeadlineExceeded):
+		log.Printf("Error %s: %v", what, err)
+		writeError(w, http.StatusServiceUnavailable, what+" failed, try again later")
+	default:
+		log.Printf("Error %s: %v", what, err)
+		writeError(w, http.StatusInternalServerError, what+" failed")
+	}
+}
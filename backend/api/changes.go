@@ -0,0 +1,82 @@
+package api
+
+import (
+	"backend/db"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+type changesResponse struct {
+	Events []db.ChangeEvent `json:"events"`
+	// Pass as after to fetch the next page. 0 if there are no more events.
+	NextAfter int64 `json:"next_after"`
+}
+
+// HandleChanges serves the change feed of all etfs, oldest first.
+// Query parameters: etf, kind, field, since (RFC 3339 or YYYY-MM-DD), after (event id) and limit.
+func (s *Server) HandleChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := db.ChangeEventFilter{
+		EtfId: query.Get("etf"),
+		Kind:  query.Get("kind"),
+		Field: query.Get("field"),
+		Limit: defaultChangesLimit,
+	}
+
+	switch filter.Kind {
+	case "", db.ChangeKindListed, db.ChangeKindChanged, db.ChangeKindVanished, db.ChangeKindDelisted:
+	default:
+		writeError(w, http.StatusBadRequest, "kind must be one of listed, changed, vanished, delisted")
+		return
+	}
+	if since := query.Get("since"); since != "" {
+		parsed, err := ParseTime(since)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be a RFC 3339 timestamp or YYYY-MM-DD date")
+			return
+		}
+		filter.Since = parsed
+	}
+	if after := query.Get("after"); after != "" {
+		parsed, err := strconv.ParseInt(after, 10, 64)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, "after must be an event id")
+			return
+		}
+		filter.AfterId = parsed
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > maxChangesLimit {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxChangesLimit))
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	events, err := s.repo.GetChangeEvents(r.Context(), filter)
+	if err != nil {
+		writeRepositoryError(w, err, "loading change events")
+		return
+	}
+
+	response := changesResponse{Events: events}
+	if len(events) == filter.Limit {
+		response.NextAfter = events[len(events)-1].Id
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// ParseTime accepts a RFC 3339 timestamp or a YYYY-MM-DD date (midnight UTC).
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"backend/db"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func newTestServer(t *testing.T, repo db.EtfRepository) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	NewServer(repo).Register(mux)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func getJSON(t *testing.T, url string, target any) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if target != nil {
+		if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+			t.Fatalf("decode response of %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestHandleChanges(t *testing.T) {
+	repo := db.NewMemoryRepository()
+	for _, ter := range []float64{0.002, 0.0015, 0.001} {
+		repo.InsertOrUpdateEtf(context.Background(), db.EtfBaseData{Id: "a", Name: "Fund a", TotalExpenseRatio: sql.NullFloat64{Float64: ter, Valid: true}})
+	}
+	repo.InsertOrUpdateEtf(context.Background(), db.EtfBaseData{Id: "b", Name: "Fund b"})
+	server := newTestServer(t, repo)
+
+	var page changesResponse
+	if status := getJSON(t, server.URL+"/api/v1/changes?etf=a&limit=2", &page); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if len(page.Events) != 2 || page.Events[0].Kind != db.ChangeKindListed || page.NextAfter != page.Events[1].Id {
+		t.Fatalf("first page = %+v, want listed and a change with a cursor", page)
+	}
+
+	var next changesResponse
+	getJSON(t, server.URL+"/api/v1/changes?etf=a&limit=2&after="+strconv.FormatInt(page.NextAfter, 10), &next)
+	if len(next.Events) != 1 || string(next.Events[0].NewValue) != "0.001" || next.NextAfter != 0 {
+		t.Errorf("second page = %+v, want the last ter change and no cursor", next)
+	}
+
+	var changed changesResponse
+	getJSON(t, server.URL+"/api/v1/changes?kind=changed&field=totalexpenseratio", &changed)
+	if len(changed.Events) != 2 {
+		t.Errorf("got %d ter changes, want 2", len(changed.Events))
+	}
+}
+
+func TestHandleChangesBadRequest(t *testing.T) {
+	server := newTestServer(t, db.NewMemoryRepository())
+	for _, query := range []string{"kind=renamed", "since=yesterday", "after=-1", "limit=0", "limit=abc"} {
+		var body errorResponse
+		if status := getJSON(t, server.URL+"/api/v1/changes?"+query, &body); status != http.StatusBadRequest || body.Error == "" {
+			t.Errorf("%s: status = %d, error = %q, want 400 with a message", query, status, body.Error)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"backend/compare"
+	"backend/db"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	minCompareEtfs = 2
+	maxCompareEtfs = 5
+)
+
+// HandleCompare serves a side by side comparison of etfs, see compare.Comparison.
+// The query parameter ids lists the etfs separated by commas, as ids, isins, wkns or tickers like in HandleEtfProfile.
+func (s *Server) HandleCompare(w http.ResponseWriter, r *http.Request) {
+	symbols := strings.Split(r.URL.Query().Get("ids"), ",")
+	if len(symbols) < minCompareEtfs || len(symbols) > maxCompareEtfs {
+		writeError(w, http.StatusBadRequest, "ids must list "+strconv.Itoa(minCompareEtfs)+" to "+strconv.Itoa(maxCompareEtfs)+" etfs separated by commas")
+		return
+	}
+
+	var ids []string
+	for _, symbol := range symbols {
+		symbol = strings.TrimSpace(symbol)
+		if !symbolPattern.MatchString(symbol) {
+			writeError(w, http.StatusBadRequest, "ids must be etf ids, isins, wkns or tickers of up to 20 letters, digits, dots, dashes or underscores")
+			return
+		}
+		etfId, err := s.repo.ResolveEtfSymbol(r.Context(), symbol)
+		if err != nil {
+			writeRepositoryError(w, err, "resolving etf")
+			return
+		}
+		if slices.Contains(ids, etfId) {
+			writeError(w, http.StatusBadRequest, "ids name etf "+etfId+" more than once")
+			return
+		}
+		ids = append(ids, etfId)
+	}
+
+	var profiles []db.EtfProfile
+	for _, etfId := range ids {
+		profile, err := s.repo.GetEtfProfile(r.Context(), etfId)
+		if err != nil {
+			writeRepositoryError(w, err, "loading etf profile")
+			return
+		}
+		profiles = append(profiles, profile)
+	}
+	writeJSON(w, http.StatusOK, compare.Compare(profiles))
+}
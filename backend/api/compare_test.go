@@ -0,0 +1,62 @@
+package api
+
+import (
+	"backend/compare"
+	"backend/db"
+	"database/sql"
+	"net/http"
+	"testing"
+)
+
+func TestHandleCompare(t *testing.T) {
+	repo := db.NewMemoryRepository()
+	for _, etf := range []struct {
+		id, details string
+		ter         float64
+	}{
+		{"a", `{"isin": "IE00B4L5Y983", "fund_domicile": "Irland", "country_composition": [{"country": "USA", "percentile": "71,89 %"}], "historical_volatility": [{"period": "1 Jahr", "value": "10,87 %"}]}`, 0.002},
+		{"b", `{"isin": "IE00BK5BQT80", "fund_domicile": "Irland", "country_composition": [{"country": "USA", "percentile": "62,10 %"}], "historical_volatility": [{"period": "1 Jahr", "value": "11,20 %"}]}`, 0.0022},
+		{"c", `{}`, 0.001},
+	} {
+		seedEtf(t, repo, db.EtfBaseData{Id: etf.id, Name: "Fund " + etf.id, TotalExpenseRatio: sql.NullFloat64{Float64: etf.ter, Valid: true}}, etf.details)
+	}
+	server := newTestServer(t, repo)
+
+	var comparison compare.Comparison
+	if status := getJSON(t, server.URL+"/api/v1/compare?ids=IE00BK5BQT80,a", &comparison); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if len(comparison.Etfs) != 2 || comparison.Etfs[0].Id != "b" || comparison.Etfs[1].Name != "Fund a" {
+		t.Errorf("etfs = %+v, want b and a in the requested order", comparison.Etfs)
+	}
+	ter := comparison.Attributes[0]
+	if ter.Field != "total_expense_ratio" || ter.Best != "a" || ter.Spread == nil || *ter.Spread != 0.0002 {
+		t.Errorf("ter = %+v, want a cheaper by 0.0002", ter)
+	}
+	for _, row := range comparison.Attributes {
+		if row.Field == "fund_domicile" && !row.Same {
+			t.Errorf("domicile = %+v, want the same for both", row)
+		}
+	}
+	if country := comparison.Composition[0]; country.Overlap == nil || *country.Overlap != 0.621 || country.Rows[0].Key != "USA" {
+		t.Errorf("country = %+v, want USA and an overlap of 0.621", country)
+	}
+	if volatility := comparison.Risk[0]; len(volatility.Rows) != 1 || volatility.Rows[0].Best != "a" {
+		t.Errorf("volatility = %+v, want a less volatile", volatility)
+	}
+
+	for path, want := range map[string]int{
+		"/api/v1/compare":                    http.StatusBadRequest,
+		"/api/v1/compare?ids=a":              http.StatusBadRequest,
+		"/api/v1/compare?ids=a,b,c,a,b,c":    http.StatusBadRequest,
+		"/api/v1/compare?ids=a,IE00B4L5Y983": http.StatusBadRequest,
+		"/api/v1/compare?ids=a,bad%20id":     http.StatusBadRequest,
+		"/api/v1/compare?ids=a,,b":           http.StatusBadRequest,
+		"/api/v1/compare?ids=a,unknown":      http.StatusNotFound,
+	} {
+		var body errorResponse
+		if status := getJSON(t, server.URL+path, &body); status != want || body.Error == "" {
+			t.Errorf("%s: status = %d, error = %q, want %d with a message", path, status, body.Error, want)
+		}
+	}
+}
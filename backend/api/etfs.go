@@ -0,0 +1,169 @@
+package api
+
+import (
+	"backend/db"
+	"backend/screener"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+const (
+	defaultEtfsLimit = 50
+	maxEtfsLimit     = 500
+)
+
+type etfsResponse struct {
+	Items  []db.EtfListItem `json:"items"`
+	Total  int              `json:"total"` // Etfs matching the filters on all pages
+	Offset int              `json:"offset"`
+	Limit  int              `json:"limit"`
+}
+
+// HandleEtfs serves a page of the etf catalogue.
+// Query parameters:
+//   - sort: name (default), ter, volume, release_date, performance_1y, performance_3y or performance_5y
+//   - order: asc (default) or desc. Etfs without a value to sort by come last either way
+//   - distributing, hedged: true or false
+//   - replication, currency, domicile, provider: exact values, ignoring case
+//   - ter_min, ter_max: fractions, e.g. 0.002 for 0,20 %
+//   - include_inactive: true to include missing and delisted etfs
+//   - screen: a screener query, e.g. ter < 0.2% AND country["USA"] < 50%, see package screener
+//   - offset and limit
+func (s *Server) HandleEtfs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, message := parseEtfListFilter(query)
+	if message != "" {
+		writeError(w, http.StatusBadRequest, message)
+		return
+	}
+	if screen := query.Get("screen"); screen != "" {
+		parsed, err := screener.Parse(screen)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter.Screen = parsed
+	}
+	s.writeEtfs(w, r, filter)
+}
+
+// parseEtfListFilter reads the query parameters of HandleEtfs except screen. Invalid parameters return a message for the client.
+func parseEtfListFilter(query url.Values) (db.EtfListFilter, string) {
+	filter := db.EtfListFilter{
+		Sort:              query.Get("sort"),
+		ReplicationMethod: query.Get("replication"),
+		FundCurrency:      query.Get("currency"),
+		FundDomicile:      query.Get("domicile"),
+		FundProvider:      query.Get("provider"),
+		Limit:             defaultEtfsLimit,
+	}
+
+	switch filter.Sort {
+	case "", db.EtfSortName, db.EtfSortTer, db.EtfSortVolume, db.EtfSortReleaseDate, db.EtfSortPerformance1y, db.EtfSortPerformance3y, db.EtfSortPerformance5y:
+	default:
+		return filter, "sort must be one of name, ter, volume, release_date, performance_1y, performance_3y, performance_5y"
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, "order must be asc or desc"
+	}
+
+	var errs []string
+	filter.IsDistributing = parseBoolParam(query, "distributing", &errs)
+	filter.HasCurrencyHedging = parseBoolParam(query, "hedged", &errs)
+	filter.MinTer = parseFloatParam(query, "ter_min", &errs)
+	filter.MaxTer = parseFloatParam(query, "ter_max", &errs)
+	if includeInactive := parseBoolParam(query, "include_inactive", &errs); includeInactive != nil {
+		filter.IncludeInactive = *includeInactive
+	}
+	if len(errs) > 0 {
+		return filter, errs[0]
+	}
+	if offset := query.Get("offset"); offset != "" {
+		parsed, err := strconv.Atoi(offset)
+		if err != nil || parsed < 0 {
+			return filter, "offset must not be negative"
+		}
+		filter.Offset = parsed
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > maxEtfsLimit {
+			return filter, "limit must be between 1 and " + strconv.Itoa(maxEtfsLimit)
+		}
+		filter.Limit = parsed
+	}
+	return filter, ""
+}
+
+func (s *Server) writeEtfs(w http.ResponseWriter, r *http.Request, filter db.EtfListFilter) {
+	page, err := s.repo.ListEtfs(r.Context(), filter)
+	if err != nil {
+		writeRepositoryError(w, err, "listing etfs")
+		return
+	}
+	writeJSON(w, http.StatusOK, etfsResponse{Items: page.Items, Total: page.Total, Offset: filter.Offset, Limit: filter.Limit})
+}
+
+// parseBoolParam returns nil if the parameter is not set. Invalid values are added to errs.
+func parseBoolParam(query url.Values, name string, errs *[]string) *bool {
+	value := query.Get(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		*errs = append(*errs, name+" must be true or false")
+		return nil
+	}
+	return &parsed
+}
+
+// parseFloatParam returns nil if the parameter is not set. Invalid values are added to errs.
+func parseFloatParam(query url.Values, name string, errs *[]string) *float64 {
+	value := query.Get(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		*errs = append(*errs, name+" must be a number")
+		return nil
+	}
+	return &parsed
+}
+
+// Ids, isins, wkns and exchange tickers only consist of these characters
+var symbolPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,20}$`)
+
+// HandleEtfProfile serves the stored record of an etf, see db.EtfProfile.
+// The etf is given by the path value symbol, or the query parameter symbol for /api/fetchEtfProfile,
+// and may be its finanzfluss id, isin, wkn or an exchange ticker.
+func (s *Server) HandleEtfProfile(w http.ResponseWriter, r *http.Request) {
+	symbol := r.PathValue("symbol")
+	if symbol == "" {
+		symbol = r.URL.Query().Get("symbol")
+	}
+	if !symbolPattern.MatchString(symbol) {
+		writeError(w, http.StatusBadRequest, "symbol must be an etf id, isin, wkn or ticker of up to 20 letters, digits, dots, dashes or underscores")
+		return
+	}
+
+	etfId, err := s.repo.ResolveEtfSymbol(r.Context(), symbol)
+	if err != nil {
+		writeRepositoryError(w, err, "resolving etf")
+		return
+	}
+	profile, err := s.repo.GetEtfProfile(r.Context(), etfId)
+	if err != nil {
+		writeRepositoryError(w, err, "loading etf profile")
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"backend/db"
+	"context"
+	"database/sql"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleEtfProfile(t *testing.T) {
+	repo := db.NewMemoryRepository()
+	seedEtf(t, repo, db.EtfBaseData{Id: "ie00b4l5y983", Name: "iShares Core MSCI World", TotalExpenseRatio: sql.NullFloat64{Float64: 0.002, Valid: true}}, `{
+		"isin": "IE00B4L5Y983",
+		"wkn": "A0RPWH",
+		"nr_positions": "1.513",
+		"country_composition": [{"country": "USA", "percentile": "71,89 %"}],
+		"historical_performance": [{"timespan": "1 Jahr", "performance": "+26,54 %", "return": "+26,54 %"}],
+		"exchanges": [{"name": "XETRA", "currency": "EUR", "ticker": "EUNL"}]
+	}`)
+	seedEtf(t, repo, db.EtfBaseData{Id: "b", Name: "Fund b"}, "")
+	server := newTestServer(t, repo)
+
+	for _, path := range []string{"/api/v1/etfs/IE00B4L5Y983", "/api/v1/etfs/a0rpwh", "/api/v1/etfs/eunl", "/api/fetchEtfProfile?symbol=ie00b4l5y983"} {
+		var profile db.EtfProfile
+		if status := getJSON(t, server.URL+path, &profile); status != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", path, status)
+		}
+		if profile.Id != "ie00b4l5y983" || profile.NrPositions == nil || *profile.NrPositions != 1513 || *profile.TotalExpenseRatio != 0.002 {
+			t.Errorf("%s: profile = %+v, want the typed record of ie00b4l5y983", path, profile)
+		}
+		if profile.Performance1y == nil || math.Abs(*profile.Performance1y-0.2654) > 1e-9 || profile.Performance3y != nil {
+			t.Errorf("%s: performance = %v, %v, want 0.2654 for one year only", path, profile.Performance1y, profile.Performance3y)
+		}
+		if len(profile.Composition) != 1 || profile.Composition[0].Key != "USA" || profile.Composition[0].Weight != 0.7189 {
+			t.Errorf("%s: composition = %+v, want USA with 0.7189", path, profile.Composition)
+		}
+	}
+
+	// Fields are in snake_case, also where the t_etf columns are not
+	var fields map[string]any
+	getJSON(t, server.URL+"/api/v1/etfs/ie00b4l5y983", &fields)
+	_, legacy := fields["totalexpenseratio"]
+	if fields["total_expense_ratio"] != 0.002 || fields["is_distributing"] != false || legacy {
+		t.Errorf("profile fields = %v, want them in snake_case", fields)
+	}
+
+	var profile db.EtfProfile
+	getJSON(t, server.URL+"/api/v1/etfs/b", &profile)
+	if profile.Name != "Fund b" || profile.ISIN != nil || profile.Status != db.EtfStatusActive || len(profile.Composition) != 0 {
+		t.Errorf("profile of b = %+v, want no details", profile)
+	}
+
+	for path, want := range map[string]int{
+		"/api/v1/etfs/unknown":                    http.StatusNotFound,
+		"/api/v1/etfs/bad%20symbol":               http.StatusBadRequest,
+		"/api/v1/etfs/" + strings.Repeat("a", 21): http.StatusBadRequest,
+		"/api/fetchEtfProfile":                    http.StatusBadRequest,
+	} {
+		var body errorResponse
+		if status := getJSON(t, server.URL+path, &body); status != want || body.Error == "" {
+			t.Errorf("%s: status = %d, error = %q, want %d with a message", path, status, body.Error, want)
+		}
+	}
+}
+
+func TestHandleEtfs(t *testing.T) {
+	ctx := context.Background()
+	repo := db.NewMemoryRepository()
+	insert := func(id string, ter float64, distributing bool) {
+		seedEtf(t, repo, db.EtfBaseData{Id: id, Name: "Fund " + id, IsDistributing: distributing, TotalExpenseRatio: sql.NullFloat64{Float64: ter, Valid: ter > 0}}, "")
+	}
+	insert("d", 0.0045, true)
+	time.Sleep(time.Millisecond)
+	runStart := time.Now()
+	insert("a", 0.002, false)
+	insert("b", 0.0007, true)
+	insert("c", 0.0012, false)
+	insert("e", 0, false)
+	repo.ReconcileListRun(ctx, runStart, 1) // Delists d
+	server := newTestServer(t, repo)
+
+	ids := func(page etfsResponse) string {
+		var ids string
+		for _, item := range page.Items {
+			ids += item.Id
+		}
+		return ids
+	}
+
+	for query, want := range map[string]string{
+		"":                                    "abce",
+		"sort=ter":                            "bcae",
+		"sort=ter&order=desc":                 "acbe",
+		"sort=ter&limit=2&offset=1":           "ca",
+		"distributing=false&ter_max=0.0015":   "c",
+		"ter_min=0.001&include_inactive=true": "acd",
+	} {
+		var page etfsResponse
+		if status := getJSON(t, server.URL+"/api/v1/etfs?"+query, &page); status != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", query, status)
+		}
+		if got := ids(page); got != want {
+			t.Errorf("%s: etfs = %s, want %s", query, got, want)
+		}
+	}
+
+	var page etfsResponse
+	getJSON(t, server.URL+"/api/v1/etfs?sort=ter&limit=1", &page)
+	if page.Total != 4 || page.Limit != 1 || page.Items[0].TotalExpenseRatio == nil || *page.Items[0].TotalExpenseRatio != 0.0007 {
+		t.Errorf("page = %+v, want the cheapest of 4 etfs", page)
+	}
+
+	for _, query := range []string{"sort=price", "order=up", "distributing=maybe", "ter_min=cheap", "ter_min=0.01&ter_max=0.001", "offset=-1", "limit=501"} {
+		var body errorResponse
+		if status := getJSON(t, server.URL+"/api/v1/etfs?"+query, &body); status != http.StatusBadRequest || body.Error == "" {
+			t.Errorf("%s: status = %d, error = %q, want 400 with a message", query, status, body.Error)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"backend/db"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// seedEtf stores an etf with base data and, unless detailsJSON is empty, details given like scraped.
+func seedEtf(t *testing.T, repo db.EtfRepository, base db.EtfBaseData, detailsJSON string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := repo.InsertOrUpdateEtf(ctx, base); err != nil {
+		t.Fatalf("insert etf %s: %v", base.Id, err)
+	}
+	if detailsJSON == "" {
+		return
+	}
+	var details db.EtfDetailsData
+	if err := json.Unmarshal([]byte(detailsJSON), &details); err != nil {
+		t.Fatalf("details of etf %s: %v", base.Id, err)
+	}
+	details.Id = base.Id
+	if err := repo.UpdateEtfDetails(ctx, details); err != nil {
+		t.Fatalf("update details of etf %s: %v", base.Id, err)
+	}
+}
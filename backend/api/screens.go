@@ -0,0 +1,89 @@
+package api
+
+import (
+	"backend/db"
+	"backend/screener"
+	"encoding/json"
+	"net/http"
+)
+
+const maxScreenBodySize = 64 << 10
+
+type screensResponse struct {
+	Screens []db.SavedScreen `json:"screens"`
+}
+
+type saveScreenRequest struct {
+	Query       string `json:"query"`
+	Description string `json:"description"`
+}
+
+// HandleScreens serves all saved screens, ordered by name.
+func (s *Server) HandleScreens(w http.ResponseWriter, r *http.Request) {
+	screens, err := s.repo.ListSavedScreens(r.Context())
+	if err != nil {
+		writeRepositoryError(w, err, "loading screens")
+		return
+	}
+	writeJSON(w, http.StatusOK, screensResponse{Screens: screens})
+}
+
+// HandleScreen serves the saved screen given by the path value name.
+func (s *Server) HandleScreen(w http.ResponseWriter, r *http.Request) {
+	screen, err := s.repo.GetSavedScreen(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeRepositoryError(w, err, "loading screen")
+		return
+	}
+	writeJSON(w, http.StatusOK, screen)
+}
+
+// HandleSaveScreen creates or replaces the screen given by the path value name.
+// The body is a json object with the query and an optional description. Invalid queries are rejected with their position.
+func (s *Server) HandleSaveScreen(w http.ResponseWriter, r *http.Request) {
+	var request saveScreenRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxScreenBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "body must be a json object with query and description: "+err.Error())
+		return
+	}
+
+	screen, err := s.repo.SaveScreen(r.Context(), db.SavedScreen{Name: r.PathValue("name"), Query: request.Query, Description: request.Description})
+	if err != nil {
+		writeRepositoryError(w, err, "saving screen")
+		return
+	}
+	writeJSON(w, http.StatusOK, screen)
+}
+
+// HandleDeleteScreen deletes the screen given by the path value name.
+func (s *Server) HandleDeleteScreen(w http.ResponseWriter, r *http.Request) {
+	if err := s.repo.DeleteSavedScreen(r.Context(), r.PathValue("name")); err != nil {
+		writeRepositoryError(w, err, "deleting screen")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleScreenEtfs serves a page of the etfs matching the saved screen given by the path value name.
+// It takes the query parameters of HandleEtfs except screen.
+func (s *Server) HandleScreenEtfs(w http.ResponseWriter, r *http.Request) {
+	filter, message := parseEtfListFilter(r.URL.Query())
+	if message != "" {
+		writeError(w, http.StatusBadRequest, message)
+		return
+	}
+	screen, err := s.repo.GetSavedScreen(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeRepositoryError(w, err, "loading screen")
+		return
+	}
+	// Saved screens were valid when saved, but fields may have been renamed since
+	filter.Screen, err = screener.Parse(screen.Query)
+	if err != nil {
+		writeError(w, http.StatusConflict, "screen "+screen.Name+" must be saved again: "+err.Error())
+		return
+	}
+	s.writeEtfs(w, r, filter)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"backend/db"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHandleScreens(t *testing.T) {
+	repo := db.NewMemoryRepository()
+	for _, etf := range []struct {
+		id, replication, details string
+		ter                      float64
+	}{
+		{"a", "Physisch (Optimiertes Sampling)", `{"nr_positions": "1.513", "country_composition": [{"country": "USA", "percentile": "71,89 %"}]}`, 0.002},
+		{"b", "Physisch (Vollständig)", `{"nr_positions": "2.400", "country_composition": [{"country": "USA", "percentile": "42,10 %"}]}`, 0.0012},
+		{"c", "Synthetisch", `{"nr_positions": "1.200"}`, 0.001},
+		{"d", "Physisch (Vollständig)", `{"nr_positions": "50"}`, 0.0015},
+	} {
+		seedEtf(t, repo, db.EtfBaseData{Id: etf.id, Name: "Fund " + etf.id, ReplicationMethod: etf.replication, TotalExpenseRatio: sql.NullFloat64{Float64: etf.ter, Valid: true}}, etf.details)
+	}
+	server := newTestServer(t, repo)
+
+	put := func(name string, body string) (int, db.SavedScreen, errorResponse) {
+		request, _ := http.NewRequest(http.MethodPut, server.URL+"/api/v1/screens/"+name, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var screen db.SavedScreen
+		var errBody errorResponse
+		data := json.NewDecoder(resp.Body)
+		if resp.StatusCode == http.StatusOK {
+			data.Decode(&screen)
+		} else {
+			data.Decode(&errBody)
+		}
+		return resp.StatusCode, screen, errBody
+	}
+
+	query := `ter < 0.2% AND country["USA"] < 50% AND nr_positions > 1000 AND replication ~ "Physisch"`
+	status, screen, _ := put("us-light", `{"query": `+strconv.Quote(query)+`, "description": "Broad, cheap, not too much USA"}`)
+	if status != http.StatusOK || screen.Name != "us-light" || screen.Query != query || screen.CreatedAt.IsZero() {
+		t.Fatalf("save: status = %d, screen = %+v", status, screen)
+	}
+
+	var page etfsResponse
+	if status := getJSON(t, server.URL+"/api/v1/screens/us-light/etfs", &page); status != http.StatusOK || page.Total != 1 || page.Items[0].Id != "b" {
+		t.Errorf("etfs of saved screen: status = %d, page = %+v, want b", status, page)
+	}
+	page = etfsResponse{}
+	getJSON(t, server.URL+"/api/v1/etfs?sort=ter&screen="+url.QueryEscape(`nr_positions >= 1200 OR NOT replication ~ "physisch"`), &page)
+	if page.Total != 3 || page.Items[0].Id != "c" || page.Items[2].Id != "a" {
+		t.Errorf("etfs of ad-hoc screen = %+v, want c, b and a", page)
+	}
+
+	var screens screensResponse
+	if getJSON(t, server.URL+"/api/v1/screens", &screens); len(screens.Screens) != 1 || screens.Screens[0].Description != "Broad, cheap, not too much USA" {
+		t.Errorf("screens = %+v, want us-light", screens)
+	}
+
+	var body errorResponse
+	if status := getJSON(t, server.URL+"/api/v1/etfs?screen="+url.QueryEscape("ter < 0.2"), &body); status != http.StatusBadRequest || !strings.Contains(body.Error, "position 7") {
+		t.Errorf("invalid ad-hoc screen: status = %d, error = %q, want 400 with the position", status, body.Error)
+	}
+	for name, body := range map[string]string{
+		"us-light":  `{"query": "country < 50%"}`,
+		"us-light?": `{"query": "ter < 1%"}`,
+		"cheap":     `{"query": "ter < 1%", "owner": "me"}`,
+		"empty":     `{"query": ""}`,
+	} {
+		if status, _, errBody := put(url.PathEscape(name), body); status != http.StatusBadRequest || errBody.Error == "" {
+			t.Errorf("save %s %s: status = %d, error = %q, want 400 with a message", name, body, status, errBody.Error)
+		}
+	}
+
+	request, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/v1/screens/us-light", nil)
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("delete: status = %d, want %d", resp.StatusCode, want)
+		}
+	}
+	if status := getJSON(t, server.URL+"/api/v1/screens/us-light/etfs", &body); status != http.StatusNotFound {
+		t.Errorf("etfs of deleted screen: status = %d, want 404", status)
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"backend/db"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSearchLimit       = 20
+	defaultAutocompleteLimit = 10
+	maxSearchLimit           = 100
+)
+
+type searchResponse struct {
+	Hits []db.SearchHit `json:"hits"` // Best first
+}
+
+// HandleSearch finds etfs by words of their name, base index or fund provider, forgiving typos, or by their
+// id, isin, wkn or ticker. Query parameters: q, include_inactive and limit.
+func (s *Server) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	s.search(w, r, false, defaultSearchLimit)
+}
+
+// HandleAutocomplete serves a typeahead: like HandleSearch, but the words and identifiers typed so far
+// match by their start, without forgiving typos.
+func (s *Server) HandleAutocomplete(w http.ResponseWriter, r *http.Request) {
+	s.search(w, r, true, defaultAutocompleteLimit)
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request, prefix bool, limit int) {
+	query := r.URL.Query()
+	search := db.EtfSearch{Text: query.Get("q"), Prefix: prefix, Limit: limit}
+	if strings.TrimSpace(search.Text) == "" {
+		writeError(w, http.StatusBadRequest, "q must not be empty")
+		return
+	}
+
+	var errs []string
+	if includeInactive := parseBoolParam(query, "include_inactive", &errs); includeInactive != nil {
+		search.IncludeInactive = *includeInactive
+	}
+	if len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, errs[0])
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > maxSearchLimit {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxSearchLimit))
+			return
+		}
+		search.Limit = parsed
+	}
+
+	hits, err := s.repo.SearchEtfs(r.Context(), search)
+	if err != nil {
+		writeRepositoryError(w, err, "searching etfs")
+		return
+	}
+	writeJSON(w, http.StatusOK, searchResponse{Hits: hits})
+}
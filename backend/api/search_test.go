@@ -0,0 +1,50 @@
+package api
+
+import (
+	"backend/db"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleSearch(t *testing.T) {
+	repo := db.NewMemoryRepository()
+	seedEtf(t, repo, db.EtfBaseData{Id: "ie00b4l5y983", Name: "iShares Core MSCI World UCITS ETF"}, `{"isin": "IE00B4L5Y983", "wkn": "A0RPWH", "base_index": "MSCI World", "fund_provider": "iShares", "exchanges": [{"ticker": "EUNL"}]}`)
+	seedEtf(t, repo, db.EtfBaseData{Id: "ie00bk5bqt80", Name: "Vanguard FTSE All-World UCITS ETF"}, `{"isin": "IE00BK5BQT80", "wkn": "A2PKXG", "base_index": "FTSE All-World", "fund_provider": "Vanguard", "exchanges": [{"ticker": "VWCE"}]}`)
+	server := newTestServer(t, repo)
+
+	for path, want := range map[string]string{
+		"/api/v1/search?q=" + url.QueryEscape("msci world"):     "ie00b4l5y983",
+		"/api/v1/search?q=EUNL":                                 "ie00b4l5y983",
+		"/api/v1/search?q=ucits&limit=1":                        "ie00b4l5y983", // Ties are ordered by name, ignoring case
+		"/api/v1/search/autocomplete?q=" + url.QueryEscape("v"): "ie00bk5bqt80",
+		"/api/v1/search/autocomplete?q=a2pk":                    "ie00bk5bqt80",
+		"/api/v1/search/autocomplete?q=ucits":                   "ie00b4l5y983,ie00bk5bqt80",
+	} {
+		var response searchResponse
+		if status := getJSON(t, server.URL+path, &response); status != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", path, status)
+		}
+		var ids []string
+		for _, hit := range response.Hits {
+			ids = append(ids, hit.Id)
+		}
+		if got := strings.Join(ids, ","); got != want {
+			t.Errorf("%s: hits = %s, want %s", path, got, want)
+		}
+	}
+
+	var response searchResponse
+	getJSON(t, server.URL+"/api/v1/search?q=eunl", &response)
+	if hit := response.Hits[0]; hit.Name != "iShares Core MSCI World UCITS ETF" || *hit.ISIN != "IE00B4L5Y983" || len(hit.Tickers) != 1 || hit.Score < 4 {
+		t.Errorf("hit = %+v, want the details of ie00b4l5y983 with an identifier score", hit)
+	}
+
+	for _, path := range []string{"/api/v1/search", "/api/v1/search?q=%20", "/api/v1/search?q=-", "/api/v1/search?q=msci&limit=101", "/api/v1/search/autocomplete?q=msci&include_inactive=maybe"} {
+		var body errorResponse
+		if status := getJSON(t, server.URL+path, &body); status != http.StatusBadRequest || body.Error == "" {
+			t.Errorf("%s: status = %d, error = %q, want 400 with a message", path, status, body.Error)
+		}
+	}
+}
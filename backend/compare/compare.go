@@ -0,0 +1,291 @@
+// Package compare lines up the stored records of etfs side by side: attributes, compositions merged on
+// their keys and risk metrics by period, each with the differences between the etfs.
+package compare
+
+import (
+	"backend/db"
+	"backend/parse"
+	"cmp"
+	"encoding/json"
+	"math"
+	"slices"
+)
+
+// Comparison of etfs. All values are aligned with Etfs.
+type Comparison struct {
+	Etfs        []Etf                   `json:"etfs"`
+	Attributes  []AttributeRow          `json:"attributes"`
+	Composition []CompositionComparison `json:"composition"`
+	Risk        []RiskComparison        `json:"risk"`
+}
+
+type Etf struct {
+	Id     string  `json:"id"`
+	Name   string  `json:"name"`
+	ISIN   *string `json:"isin"`
+	Status string  `json:"status"`
+}
+
+// Row is a value of each etf with the differences between them. Only numeric rows have a spread and differences.
+type Row struct {
+	Values            []any      `json:"values"`                        // In the order of Comparison.Etfs, null if unknown
+	Same              bool       `json:"same"`                          // All etfs have the same known value
+	Spread            *float64   `json:"spread,omitempty"`              // Greatest minus smallest known value
+	DifferenceToFirst []*float64 `json:"difference_to_first,omitempty"` // Value minus the value of the first etf
+	Best              string     `json:"best,omitempty"`                // Id of the etf with the single best value, where better is defined
+}
+
+// AttributeRow compares a field of db.EtfProfile, named like in its JSON.
+type AttributeRow struct {
+	Field string `json:"field"`
+	Row
+}
+
+// CompositionComparison merges the composition entries of a dimension on their keys.
+type CompositionComparison struct {
+	Dimension string `json:"dimension"`
+	// Sum of the smallest weight of each key, e.g. 0.8 if the etfs share 80 % of their weight.
+	// Null unless every etf has entries of the dimension
+	Overlap *float64         `json:"overlap"`
+	Rows    []CompositionRow `json:"rows"` // Heaviest keys first
+}
+
+// CompositionRow compares the weight of a key. Etfs with entries of the dimension but not the key weigh 0 for it,
+// etfs without any entries of the dimension have no known weight.
+type CompositionRow struct {
+	Key string `json:"key"`
+	Row
+}
+
+// RiskComparison compares a risk metric by period.
+type RiskComparison struct {
+	Metric string    `json:"metric"` // Column of t_etf, e.g. "historical_volatility"
+	Rows   []RiskRow `json:"rows"`   // Periods in the order scraped
+}
+
+type RiskRow struct {
+	Period string `json:"period"` // As displayed, e.g. "3 Jahre"
+	Row
+}
+
+// Which values are better
+const (
+	higherIsBetter = 1
+	noBetter       = 0
+	lowerIsBetter  = -1
+)
+
+// Compare lines up the profiles in the given order.
+func Compare(profiles []db.EtfProfile) Comparison {
+	comparison := Comparison{Etfs: []Etf{}, Attributes: []AttributeRow{}, Composition: []CompositionComparison{}, Risk: []RiskComparison{}}
+	for _, profile := range profiles {
+		comparison.Etfs = append(comparison.Etfs, Etf{Id: profile.Id, Name: profile.Name, ISIN: profile.ISIN, Status: profile.Status})
+	}
+
+	numbers := func(field string, better int, value func(db.EtfProfile) *float64) {
+		values := collect(profiles, value)
+		comparison.Attributes = append(comparison.Attributes, AttributeRow{field, numberRow(values, better, comparison.Etfs)})
+	}
+	texts := func(field string, value func(db.EtfProfile) *string) {
+		comparison.Attributes = append(comparison.Attributes, AttributeRow{field, valueRow(collect(profiles, value))})
+	}
+	flags := func(field string, value func(db.EtfProfile) *bool) {
+		comparison.Attributes = append(comparison.Attributes, AttributeRow{field, valueRow(collect(profiles, value))})
+	}
+	integer := func(value *int64) *float64 {
+		if value == nil {
+			return nil
+		}
+		f := float64(*value)
+		return &f
+	}
+	numbers("total_expense_ratio", lowerIsBetter, func(p db.EtfProfile) *float64 { return p.TotalExpenseRatio })
+	numbers("fund_volume_eur", higherIsBetter, func(p db.EtfProfile) *float64 { return p.FundVolumeEur })
+	numbers("share_class_volume_eur", higherIsBetter, func(p db.EtfProfile) *float64 { return p.ShareClassVolumeEur })
+	texts("replication_method", func(p db.EtfProfile) *string { return p.ReplicationMethod })
+	texts("fund_domicile", func(p db.EtfProfile) *string { return p.FundDomicile })
+	texts("fund_currency", func(p db.EtfProfile) *string { return p.FundCurrency })
+	texts("fund_provider", func(p db.EtfProfile) *string { return p.FundProvider })
+	texts("base_index", func(p db.EtfProfile) *string { return p.BaseIndex })
+	texts("release_date", func(p db.EtfProfile) *string { return p.ReleaseDate })
+	flags("is_distributing", func(p db.EtfProfile) *bool { return p.IsDistributing })
+	flags("has_currency_hedging", func(p db.EtfProfile) *bool { return p.HasCurrencyHedging })
+	flags("securities_lending_permitted", func(p db.EtfProfile) *bool { return p.SecuritiesLendingPermitted })
+	numbers("nr_positions", noBetter, func(p db.EtfProfile) *float64 { return integer(p.NrPositions) })
+	numbers("weight_top_10", noBetter, func(p db.EtfProfile) *float64 { return p.WeightTop10 })
+	numbers("performance_1y", higherIsBetter, func(p db.EtfProfile) *float64 { return p.Performance1y })
+	numbers("performance_3y", higherIsBetter, func(p db.EtfProfile) *float64 { return p.Performance3y })
+	numbers("performance_5y", higherIsBetter, func(p db.EtfProfile) *float64 { return p.Performance5y })
+
+	for _, dimension := range []string{db.CompositionCountry, db.CompositionRegion, db.CompositionCurrency, db.CompositionIndustry, db.CompositionHolding} {
+		comparison.Composition = append(comparison.Composition, compareComposition(profiles, dimension, comparison.Etfs))
+	}
+
+	for _, metric := range []struct {
+		name   string
+		better int
+		value  func(db.EtfProfile) json.RawMessage
+		parse  func(string) (float64, bool)
+	}{
+		{"historical_volatility", lowerIsBetter, func(p db.EtfProfile) json.RawMessage { return p.HistoricalVolatility }, parsePercent},
+		{"historical_max_drawdown", higherIsBetter, func(p db.EtfProfile) json.RawMessage { return p.HistoricalMaxDrawdown }, parsePercent}, // Drawdowns are negative
+		{"historical_sharpe_ratio", higherIsBetter, func(p db.EtfProfile) json.RawMessage { return p.HistoricalSharpeRatio }, parseNumber},
+	} {
+		risk := RiskComparison{Metric: metric.name, Rows: []RiskRow{}}
+		byPeriod := map[string][]*float64{}
+		var periods []string
+		for i, profile := range profiles {
+			for _, value := range riskValues(metric.value(profile)) {
+				if _, ok := byPeriod[value.Period]; !ok {
+					byPeriod[value.Period] = make([]*float64, len(profiles))
+					periods = append(periods, value.Period)
+				}
+				if parsed, ok := metric.parse(value.Value); ok {
+					byPeriod[value.Period][i] = &parsed
+				}
+			}
+		}
+		for _, period := range periods {
+			risk.Rows = append(risk.Rows, RiskRow{period, numberRow(byPeriod[period], metric.better, comparison.Etfs)})
+		}
+		comparison.Risk = append(comparison.Risk, risk)
+	}
+	return comparison
+}
+
+func collect[T any](profiles []db.EtfProfile, value func(db.EtfProfile) *T) []*T {
+	values := make([]*T, len(profiles))
+	for i, profile := range profiles {
+		values[i] = value(profile)
+	}
+	return values
+}
+
+// valueRow compares values without an order, like texts and flags.
+func valueRow[T comparable](values []*T) Row {
+	row := Row{Values: make([]any, len(values)), Same: len(values) > 0}
+	for i, value := range values {
+		row.Values[i] = value
+		row.Same = row.Same && value != nil && *value == *values[0]
+	}
+	return row
+}
+
+// numberRow compares numbers and computes their differences. better decides which etf has the best value.
+func numberRow(values []*float64, better int, etfs []Etf) Row {
+	row := valueRow(values)
+	row.DifferenceToFirst = make([]*float64, len(values))
+	var known []float64
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		known = append(known, *value)
+		if values[0] != nil {
+			difference := round(*value - *values[0])
+			row.DifferenceToFirst[i] = &difference
+		}
+	}
+	if len(known) == 0 {
+		return row
+	}
+	spread := round(slices.Max(known) - slices.Min(known))
+	row.Spread = &spread
+
+	if better == noBetter || len(known) < 2 || spread == 0 {
+		return row
+	}
+	best := slices.Max(known)
+	if better == lowerIsBetter {
+		best = slices.Min(known)
+	}
+	isBest := func(value *float64) bool { return value != nil && *value == best }
+	if first := slices.IndexFunc(values, isBest); !slices.ContainsFunc(values[first+1:], isBest) {
+		row.Best = etfs[first].Id
+	}
+	return row
+}
+
+// round drops the floating point noise of differences like 0.0022 - 0.002
+func round(value float64) float64 {
+	return math.Round(value*1e10) / 1e10
+}
+
+func compareComposition(profiles []db.EtfProfile, dimension string, etfs []Etf) CompositionComparison {
+	comparison := CompositionComparison{Dimension: dimension, Rows: []CompositionRow{}}
+	weights := map[string][]*float64{}
+	var keys []string
+	hasDimension := make([]bool, len(profiles))
+	for i, profile := range profiles {
+		for _, entry := range profile.Composition {
+			if entry.Dimension != dimension {
+				continue
+			}
+			hasDimension[i] = true
+			if _, ok := weights[entry.Key]; !ok {
+				weights[entry.Key] = make([]*float64, len(profiles))
+				keys = append(keys, entry.Key)
+			}
+			weight := entry.Weight
+			weights[entry.Key][i] = &weight
+		}
+	}
+
+	allHaveDimension := !slices.Contains(hasDimension, false)
+	zero := 0.0
+	overlap := 0.0
+	for _, key := range keys {
+		smallest := 1.0
+		for i := range profiles {
+			if hasDimension[i] && weights[key][i] == nil {
+				weights[key][i] = &zero
+			}
+			if weights[key][i] != nil {
+				smallest = min(smallest, *weights[key][i])
+			}
+		}
+		overlap += smallest
+		comparison.Rows = append(comparison.Rows, CompositionRow{key, numberRow(weights[key], noBetter, etfs)})
+	}
+	if len(keys) > 0 && allHaveDimension {
+		overlap = round(overlap)
+		comparison.Overlap = &overlap
+	}
+
+	// Heaviest first, so the keys that matter come before long tails of small ones
+	heaviest := func(row CompositionRow) float64 {
+		weights := []float64{0}
+		for _, value := range row.Values {
+			if weight, ok := value.(*float64); ok && weight != nil {
+				weights = append(weights, *weight)
+			}
+		}
+		return slices.Max(weights)
+	}
+	slices.SortStableFunc(comparison.Rows, func(a, b CompositionRow) int {
+		return cmp.Or(cmp.Compare(heaviest(b), heaviest(a)), cmp.Compare(a.Key, b.Key))
+	})
+	return comparison
+}
+
+type riskValue struct {
+	Period string `json:"period"`
+	Value  string `json:"value"`
+}
+
+// riskValues decodes a risk column like historical_volatility. Anything but a list has no values.
+func riskValues(column json.RawMessage) []riskValue {
+	var values []riskValue
+	json.Unmarshal(column, &values)
+	return values
+}
+
+func parsePercent(s string) (float64, bool) {
+	value, err := parse.Percent(s)
+	return value.Float64, err == nil && value.Valid
+}
+
+func parseNumber(s string) (float64, bool) {
+	value, err := parse.Number(s)
+	return value.Float64, err == nil && value.Valid
+}
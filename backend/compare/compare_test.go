@@ -0,0 +1,96 @@
+package compare
+
+import (
+	"backend/db"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func floats(values []*float64) []any {
+	result := []any{}
+	for _, value := range values {
+		if value == nil {
+			result = append(result, nil)
+			continue
+		}
+		result = append(result, *value)
+	}
+	return result
+}
+
+func TestCompare(t *testing.T) {
+	profiles := []db.EtfProfile{
+		{
+			Id:                "a",
+			TotalExpenseRatio: ptr(0.002),
+			ReplicationMethod: ptr("Physisch (Optimiertes Sampling)"),
+			FundDomicile:      ptr("Irland"),
+			Composition: []db.CompositionEntry{
+				{Dimension: db.CompositionCountry, Key: "USA", Weight: 0.7},
+				{Dimension: db.CompositionCountry, Key: "Japan", Weight: 0.1},
+			},
+			HistoricalVolatility:  json.RawMessage(`[{"period": "1 Jahr", "value": "10,87 %"}, {"period": "3 Jahre", "value": "14,21 %"}]`),
+			HistoricalMaxDrawdown: json.RawMessage(`[{"period": "1 Jahr", "value": "-6,34 %"}]`),
+		},
+		{
+			Id:                "b",
+			TotalExpenseRatio: ptr(0.0022),
+			ReplicationMethod: ptr("Physisch (Optimiertes Sampling)"),
+			FundDomicile:      ptr("Luxemburg"),
+			Composition: []db.CompositionEntry{
+				{Dimension: db.CompositionCountry, Key: "USA", Weight: 0.6},
+				{Dimension: db.CompositionCountry, Key: "UK", Weight: 0.2},
+			},
+			HistoricalVolatility:  json.RawMessage(`[{"period": "1 Jahr", "value": "9,50 %"}]`),
+			HistoricalMaxDrawdown: json.RawMessage(`[{"period": "1 Jahr", "value": "-8,00 %"}]`),
+		},
+		{
+			Id:                "c",
+			TotalExpenseRatio: ptr(0.0007),
+			ReplicationMethod: ptr("Synthetisch"),
+		},
+	}
+	comparison := Compare(profiles)
+
+	attributes := map[string]AttributeRow{}
+	for _, row := range comparison.Attributes {
+		attributes[row.Field] = row
+	}
+	ter := attributes["total_expense_ratio"]
+	if got := floats(ter.DifferenceToFirst); !reflect.DeepEqual(got, []any{0.0, 0.0002, -0.0013}) || *ter.Spread != 0.0015 || ter.Best != "c" || ter.Same {
+		t.Errorf("ter = %+v, differences %v, want c best with a spread of 0.0015", ter, got)
+	}
+	if replication := attributes["replication_method"]; replication.Same || replication.Spread != nil || replication.Best != "" {
+		t.Errorf("replication = %+v, want a text row that is not the same", replication)
+	}
+	if volume := attributes["fund_volume_eur"]; volume.Spread != nil || volume.Best != "" || len(volume.Values) != 3 || volume.Values[0].(*float64) != nil {
+		t.Errorf("volume = %+v, want no known values", volume)
+	}
+
+	country := comparison.Composition[0]
+	if country.Dimension != db.CompositionCountry || country.Overlap != nil || len(country.Rows) != 3 {
+		t.Fatalf("country = %+v, want 3 keys and no overlap as c has no countries", country)
+	}
+	if usa := country.Rows[0]; usa.Key != "USA" || !reflect.DeepEqual(floats(usa.DifferenceToFirst), []any{0.0, -0.1, nil}) {
+		t.Errorf("first country = %+v, want USA with a difference of -0.1", usa)
+	}
+	if uk := country.Rows[1]; uk.Key != "UK" || !reflect.DeepEqual(uk.Values, []any{ptr(0.0), ptr(0.2), (*float64)(nil)}) {
+		t.Errorf("second country = %+v, want UK weighing 0 in a", uk)
+	}
+	if overlap := Compare(profiles[:2]).Composition[0].Overlap; overlap == nil || *overlap != 0.6 {
+		t.Errorf("overlap of a and b = %v, want 0.6", overlap)
+	}
+
+	volatility, drawdown := comparison.Risk[0], comparison.Risk[1]
+	if len(volatility.Rows) != 2 || volatility.Rows[0].Period != "1 Jahr" || volatility.Rows[0].Best != "b" || volatility.Rows[1].Best != "" {
+		t.Errorf("volatility = %+v, want b best in 1 Jahr and a only in 3 Jahre", volatility)
+	}
+	if drawdown.Metric != "historical_max_drawdown" || drawdown.Rows[0].Best != "a" {
+		t.Errorf("drawdown = %+v, want a best with the smaller loss", drawdown)
+	}
+}
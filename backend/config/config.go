@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidConfig is returned by Loader.Load if a value can't be parsed or fails validation.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Config is the configuration of the backend and its scripts.
+// See Loader for where the values are read from.
+type Config struct {
+	DB      DB
+	HTTP    HTTP
+	Scraper Scraper
+	Logging Logging
+}
+
+// DB describes the postgres connection.
+type DB struct {
+	DSN      string // Full connection string or postgres:// url. Used as is if set, the other fields are ignored.
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+	SSLMode  string // disable, allow, prefer, require, verify-ca or verify-full
+}
+
+// HTTP configures the api server started by -op serve.
+type HTTP struct {
+	Addr        string // Listen address, e.g. ":8080" or "127.0.0.1:8080".
+	FrontendDir string // Directory of the built frontend served at /.
+}
+
+// Scraper configures the list and etf scrapers.
+type Scraper struct {
+	SelectorsFile string // Selector config replacing the embedded scraper/selectors.json if set.
+
+	Concurrency       int     // Number of browser tabs working in parallel.
+	RequestsPerSecond float64 // Shared page loads per second per host. <= 0 disables limiting.
+	Burst             int     // Page loads allowed at once before the rate applies.
+
+	RetryMaxAttempts int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+	RetryJitter      float64
+
+	MaxPageMismatches int // How often a list page is reloaded when a different page than requested got rendered.
+	DelistAfterMisses int // Complete list runs in a row an etf may be missing from before it is delisted.
+
+	DriftMaxFillRateDrop     float64
+	DriftBaselineRuns        int
+	DriftMinSamples          int
+	DriftMaxConsecutiveEmpty int
+
+	Chrome Chrome
+}
+
+// Chrome describes how the scrapers launch (or attach to) Chrome.
+type Chrome struct {
+	ExecPath         string   // Discovered from PATH / well known locations if empty.
+	RemoteURL        string   // DevTools websocket url of an already running Chrome. Skips launching if set.
+	Headless         bool     // Run without a visible window.
+	UserDataDir      string   // Persistent profile dir. An ephemeral temp profile is used if empty.
+	ProfileDirectory string   // Profile inside UserDataDir, e.g. "Default".
+	WindowWidth      int      // Window width in px.
+	WindowHeight     int      // Window height in px.
+	UserAgent        string   // Overrides the user agent if set.
+	ExtraFlags       []string // Additional command line flags, e.g. "no-sandbox" or "proxy-server=host:port".
+}
+
+// Logging configures the standard logger.
+type Logging struct {
+	File         string // Appended to instead of stderr if set.
+	UTC          bool   // Log timestamps in UTC instead of local time.
+	Microseconds bool   // Log timestamps with microsecond resolution.
+}
+
+// Default returns the config used for everything not set explicitly.
+func Default() Config {
+	return Config{
+		DB: DB{
+			Host:    "localhost",
+			Port:    5432,
+			SSLMode: "disable",
+		},
+		HTTP: HTTP{
+			Addr:        ":8080",
+			FrontendDir: "./frontend/dist",
+		},
+		Scraper: Scraper{
+			Concurrency:              4,
+			RequestsPerSecond:        2,
+			Burst:                    1,
+			RetryMaxAttempts:         3,
+			RetryBaseDelay:           2 * time.Second,
+			RetryMaxDelay:            30 * time.Second,
+			RetryJitter:              0.2,
+			MaxPageMismatches:        5,
+			DelistAfterMisses:        3,
+			DriftMaxFillRateDrop:     0.25,
+			DriftBaselineRuns:        5,
+			DriftMinSamples:          20,
+			DriftMaxConsecutiveEmpty: 10,
+			Chrome: Chrome{
+				Headless:     true,
+				WindowWidth:  1920,
+				WindowHeight: 1080,
+			},
+		},
+	}
+}
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Validate returns one error per invalid value, named by its env var.
+func (c Config) Validate() []error {
+	var errs []error
+	check := func(ok bool, key string, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s%s: %s", envPrefix, key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	if c.DB.DSN != "" {
+		if strings.HasPrefix(c.DB.DSN, "postgres://") || strings.HasPrefix(c.DB.DSN, "postgresql://") {
+			_, err := url.Parse(c.DB.DSN)
+			check(err == nil, "DB_DSN", "invalid url")
+		}
+	} else {
+		check(c.DB.Host != "", "DB_HOST", "required")
+		check(c.DB.Port > 0 && c.DB.Port < 65536, "DB_PORT", "%d is not a valid port", c.DB.Port)
+		check(c.DB.User != "", "DB_USER", "required")
+		check(c.DB.Name != "", "DB_NAME", "required")
+		check(slices.Contains(sslModes, c.DB.SSLMode), "DB_SSLMODE", "%q is not one of %s", c.DB.SSLMode, strings.Join(sslModes, ", "))
+	}
+
+	_, _, err := net.SplitHostPort(c.HTTP.Addr)
+	check(err == nil, "HTTP_ADDR", "%q is not a host:port address", c.HTTP.Addr)
+
+	s := c.Scraper
+	check(s.Concurrency >= 1, "SCRAPER_CONCURRENCY", "must be at least 1")
+	check(s.Burst >= 1, "SCRAPER_BURST", "must be at least 1")
+	check(s.RetryMaxAttempts >= 1, "SCRAPER_RETRY_MAX_ATTEMPTS", "must be at least 1")
+	check(s.RetryBaseDelay >= 0, "SCRAPER_RETRY_BASE_DELAY", "must not be negative")
+	check(s.RetryMaxDelay >= s.RetryBaseDelay, "SCRAPER_RETRY_MAX_DELAY", "must not be less than the base delay %s", s.RetryBaseDelay)
+	check(s.RetryJitter >= 0 && s.RetryJitter <= 1, "SCRAPER_RETRY_JITTER", "must be between 0 and 1")
+	check(s.MaxPageMismatches >= 0, "SCRAPER_MAX_PAGE_MISMATCHES", "must not be negative")
+	check(s.DelistAfterMisses >= 1, "SCRAPER_DELIST_AFTER_MISSES", "must be at least 1")
+	check(s.DriftMaxFillRateDrop > 0 && s.DriftMaxFillRateDrop <= 1, "SCRAPER_DRIFT_MAX_FILL_RATE_DROP", "must be greater than 0 and at most 1")
+	check(s.DriftBaselineRuns >= 1, "SCRAPER_DRIFT_BASELINE_RUNS", "must be at least 1")
+	check(s.DriftMinSamples >= 0, "SCRAPER_DRIFT_MIN_SAMPLES", "must not be negative")
+	check(s.DriftMaxConsecutiveEmpty >= 0, "SCRAPER_DRIFT_MAX_CONSECUTIVE_EMPTY", "must not be negative")
+	check(s.Chrome.WindowWidth > 0, "CHROME_WINDOW_WIDTH", "must be positive")
+	check(s.Chrome.WindowHeight > 0, "CHROME_WINDOW_HEIGHT", "must be positive")
+	return errs
+}
+
+// ConnString returns the connection string for lib/pq.
+func (d DB) ConnString() string {
+	if d.DSN != "" {
+		return d.DSN
+	}
+	parts := []string{
+		"host=" + quoteConnValue(d.Host),
+		fmt.Sprintf("port=%d", d.Port),
+		"user=" + quoteConnValue(d.User),
+		"dbname=" + quoteConnValue(d.Name),
+		"sslmode=" + quoteConnValue(d.SSLMode),
+	}
+	if d.Password != "" {
+		parts = append(parts, "password="+quoteConnValue(d.Password))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteConnValue quotes values with spaces or quotes, as required by the key=value connection string format.
+func quoteConnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
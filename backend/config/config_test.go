@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.env")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func load(t *testing.T, args ...string) (Config, error) {
+	t.Helper()
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(flags)
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return loader.Load()
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+ASSETFORGE_V2_DB_HOST=db.internal
+ASSETFORGE_V2_DB_PORT=1
+ASSETFORGE_V2_DB_USER=assetforge
+ASSETFORGE_V2_DB_NAME=assetforge
+ASSETFORGE_V2_SCRAPER_CONCURRENCY=2
+ASSETFORGE_V2_SCRAPER_RETRY_BASE_DELAY=1s
+ASSETFORGE_V2_CHROME_FLAGS=no-sandbox, proxy-server=host:3128
+`)
+	t.Setenv("ASSETFORGE_V2_DB_PORT", "2")
+	t.Setenv("ASSETFORGE_V2_SCRAPER_CONCURRENCY", "")
+
+	config, err := load(t, "-config", path, "-db-port", "3", "-chrome-headless=false")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if config.DB.Host != "db.internal" || config.DB.Port != 3 || config.DB.SSLMode != "disable" {
+		t.Errorf("DB = %+v, want host from the file, port from the flag and the default sslmode", config.DB)
+	}
+	if config.Scraper.Concurrency != 2 || config.Scraper.RetryBaseDelay != time.Second {
+		t.Errorf("Scraper = %+v, want values from the file as the env var is empty", config.Scraper)
+	}
+	if config.Scraper.Chrome.Headless || len(config.Scraper.Chrome.ExtraFlags) != 2 || config.Scraper.Chrome.ExtraFlags[1] != "proxy-server=host:3128" {
+		t.Errorf("Chrome = %+v, want headless disabled by flag and two extra flags", config.Scraper.Chrome)
+	}
+	if config.HTTP.Addr != ":8080" {
+		t.Errorf("HTTP.Addr = %q, want the default", config.HTTP.Addr)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	path := writeConfigFile(t, `
+ASSETFORGE_V2_DB_USER=assetforge
+ASSETFORGE_V2_DB_NAME=assetforge
+ASSETFORGE_V2_DB_SSL_MODE=require
+ASSETFORGE_V2_SCRAPER_RPS=fast
+`)
+	t.Setenv("ASSETFORGE_V2_DB_SSLMODE", "on")
+
+	_, err := load(t, "-config", path, "-scraper-concurrency", "0")
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Load error = %v, want ErrInvalidConfig", err)
+	}
+	for _, want := range []string{"unknown key ASSETFORGE_V2_DB_SSL_MODE", "ASSETFORGE_V2_SCRAPER_RPS from", "ASSETFORGE_V2_DB_SSLMODE", "ASSETFORGE_V2_SCRAPER_CONCURRENCY"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load error %q does not mention %s", err, want)
+		}
+	}
+
+	if _, err := load(t, "-config", filepath.Join(t.TempDir(), "missing.env")); err == nil {
+		t.Error("expected an error for a missing explicit config file")
+	}
+}
+
+func TestConnString(t *testing.T) {
+	db := DB{Host: "localhost", Port: 5432, User: "postgres", Password: "it's secret", Name: "assetforge", SSLMode: "require"}
+	want := `host=localhost port=5432 user=postgres dbname=assetforge sslmode=require password='it\'s secret'`
+	if got := db.ConnString(); got != want {
+		t.Errorf("ConnString() = %s, want %s", got, want)
+	}
+
+	db.DSN = "postgres://postgres@db:5432/assetforge?sslmode=verify-full"
+	if got := db.ConnString(); got != db.DSN {
+		t.Errorf("ConnString() = %s, want the dsn as is", got)
+	}
+}
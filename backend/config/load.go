@@ -0,0 +1,229 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// All env vars and config file keys start with this prefix.
+const envPrefix = "ASSETFORGE_V2_"
+
+// Loader reads the Config from, in increasing precedence:
+//   - the defaults of Default()
+//   - a dotenv style config file with the same keys as the env vars. Given by -config or ASSETFORGE_V2_CONFIG_FILE,
+//     otherwise <APP_ENV>.env (APP_ENV defaults to dev) in the working directory if it exists
+//   - ASSETFORGE_V2_* env vars
+//   - command line flags, named after the env vars, e.g. -db-host for ASSETFORGE_V2_DB_HOST
+//
+// Empty values in the config file and env vars are treated as unset.
+type Loader struct {
+	configFile string
+	flags      map[string]string // Set flags by setting key
+}
+
+// NewLoader registers -config and one flag per setting on flags. Call Load after flags got parsed.
+func NewLoader(flags *flag.FlagSet) *Loader {
+	l := &Loader{flags: map[string]string{}}
+	flags.StringVar(&l.configFile, "config", "", "Config file with "+envPrefix+"* keys (env: "+envPrefix+"CONFIG_FILE)")
+
+	defaults := Default()
+	for _, s := range defaults.settings() {
+		key := s.key
+		usage := fmt.Sprintf("%s (env: %s%s)", s.usage, envPrefix, key)
+		set := func(value string) error {
+			l.flags[key] = value
+			return nil
+		}
+		if _, ok := s.value.(*bool); ok {
+			flags.BoolFunc(flagName(key), usage, set)
+		} else {
+			flags.Func(flagName(key), usage, set)
+		}
+	}
+	return l
+}
+
+// Load merges all sources and validates the result.
+// All invalid values are reported at once, wrapped in ErrInvalidConfig.
+func (l *Loader) Load() (Config, error) {
+	config := Default()
+	settings := config.settings()
+	var errs []error
+
+	path, explicit := l.configFilePath()
+	fileValues, err := godotenv.Read(path)
+	switch {
+	case err == nil:
+		errs = append(errs, unknownKeys(fileValues, settings, path)...)
+		for _, s := range settings {
+			if value := fileValues[envPrefix+s.key]; value != "" {
+				errs = append(errs, s.set(value, path))
+			}
+		}
+	case explicit || !errors.Is(err, fs.ErrNotExist):
+		errs = append(errs, fmt.Errorf("reading config file: %w", err))
+	}
+
+	for _, s := range settings {
+		if value := os.Getenv(envPrefix + s.key); value != "" {
+			errs = append(errs, s.set(value, "env"))
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := l.flags[s.key]; ok {
+			errs = append(errs, s.set(value, "flag -"+flagName(s.key)))
+		}
+	}
+
+	errs = append(errs, config.Validate()...)
+	if err := errors.Join(errs...); err != nil {
+		return config, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	return config, nil
+}
+
+// configFilePath returns the config file to read and whether it was given explicitly, in which case it must exist.
+func (l *Loader) configFilePath() (string, bool) {
+	if l.configFile != "" {
+		return l.configFile, true
+	}
+	if path := os.Getenv(envPrefix + "CONFIG_FILE"); path != "" {
+		return path, true
+	}
+	appEnv := os.Getenv("APP_ENV")
+	if appEnv == "" {
+		appEnv = "dev"
+	}
+	return appEnv + ".env", false
+}
+
+// unknownKeys reports prefixed keys in the config file that are no setting, which are most likely typos.
+func unknownKeys(values map[string]string, settings []setting, path string) []error {
+	known := map[string]bool{envPrefix + "CONFIG_FILE": true}
+	for _, s := range settings {
+		known[envPrefix+s.key] = true
+	}
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		if strings.HasPrefix(key, envPrefix) && !known[key] {
+			errs = append(errs, fmt.Errorf("%s: unknown key %s", path, key))
+		}
+	}
+	return errs
+}
+
+// setting is a single configurable value.
+type setting struct {
+	key   string // Env var without envPrefix. The flag name is derived from it.
+	value any    // Pointer to the field in the Config
+	usage string
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"DB_DSN", &c.DB.DSN, "Full postgres connection string or postgres:// url. Overrides the other DB settings"},
+		{"DB_HOST", &c.DB.Host, "Postgres host"},
+		{"DB_PORT", &c.DB.Port, "Postgres port"},
+		{"DB_USER", &c.DB.User, "Postgres user"},
+		{"DB_PASSWORD", &c.DB.Password, "Postgres password"},
+		{"DB_NAME", &c.DB.Name, "Postgres database"},
+		{"DB_SSLMODE", &c.DB.SSLMode, "Postgres sslmode: disable, allow, prefer, require, verify-ca or verify-full"},
+
+		{"HTTP_ADDR", &c.HTTP.Addr, "Listen address of the api server"},
+		{"HTTP_FRONTEND_DIR", &c.HTTP.FrontendDir, "Directory of the built frontend"},
+
+		{"SCRAPER_SELECTORS_FILE", &c.Scraper.SelectorsFile, "Selector config file. Defaults to the embedded scraper/selectors.json"},
+		{"SCRAPER_CONCURRENCY", &c.Scraper.Concurrency, "Browser tabs scraping in parallel"},
+		{"SCRAPER_RPS", &c.Scraper.RequestsPerSecond, "Page loads per second per host. <= 0 disables limiting"},
+		{"SCRAPER_BURST", &c.Scraper.Burst, "Page loads allowed at once before the rate applies"},
+		{"SCRAPER_RETRY_MAX_ATTEMPTS", &c.Scraper.RetryMaxAttempts, "Attempts per scrape task"},
+		{"SCRAPER_RETRY_BASE_DELAY", &c.Scraper.RetryBaseDelay, "Delay before the first retry, doubled per attempt"},
+		{"SCRAPER_RETRY_MAX_DELAY", &c.Scraper.RetryMaxDelay, "Max delay between retries"},
+		{"SCRAPER_RETRY_JITTER", &c.Scraper.RetryJitter, "Randomization of retry delays as a fraction of the delay"},
+		{"SCRAPER_MAX_PAGE_MISMATCHES", &c.Scraper.MaxPageMismatches, "Reloads of a list page that rendered a different page than requested"},
+		{"SCRAPER_DELIST_AFTER_MISSES", &c.Scraper.DelistAfterMisses, "Complete list runs in a row an etf may be missing from before it is delisted"},
+		{"SCRAPER_DRIFT_MAX_FILL_RATE_DROP", &c.Scraper.DriftMaxFillRateDrop, "Max drop of a fields fill rate below its baseline before a run is degraded"},
+		{"SCRAPER_DRIFT_BASELINE_RUNS", &c.Scraper.DriftBaselineRuns, "Completed runs the fill rate baseline is averaged over"},
+		{"SCRAPER_DRIFT_MIN_SAMPLES", &c.Scraper.DriftMinSamples, "Items needed before fill rates are compared"},
+		{"SCRAPER_DRIFT_MAX_CONSECUTIVE_EMPTY", &c.Scraper.DriftMaxConsecutiveEmpty, "Consecutive empty results before a run is aborted. 0 disables"},
+
+		{"CHROME_EXEC_PATH", &c.Scraper.Chrome.ExecPath, "Chrome executable. Discovered if empty"},
+		{"CHROME_REMOTE_URL", &c.Scraper.Chrome.RemoteURL, "DevTools websocket url of a running chrome. Nothing is launched if set"},
+		{"CHROME_HEADLESS", &c.Scraper.Chrome.Headless, "Run chrome without a visible window"},
+		{"CHROME_USER_DATA_DIR", &c.Scraper.Chrome.UserDataDir, "Persistent chrome profile dir. Ephemeral if empty"},
+		{"CHROME_PROFILE_DIRECTORY", &c.Scraper.Chrome.ProfileDirectory, "Profile inside the user data dir"},
+		{"CHROME_WINDOW_WIDTH", &c.Scraper.Chrome.WindowWidth, "Chrome window width in px"},
+		{"CHROME_WINDOW_HEIGHT", &c.Scraper.Chrome.WindowHeight, "Chrome window height in px"},
+		{"CHROME_USER_AGENT", &c.Scraper.Chrome.UserAgent, "Custom user agent"},
+		{"CHROME_FLAGS", &c.Scraper.Chrome.ExtraFlags, "Comma separated extra chrome flags"},
+
+		{"LOG_FILE", &c.Logging.File, "Log file appended to instead of stderr"},
+		{"LOG_UTC", &c.Logging.UTC, "Log timestamps in UTC"},
+		{"LOG_MICROSECONDS", &c.Logging.Microseconds, "Log timestamps with microseconds"},
+	}
+}
+
+// set parses value into the field of the setting. The field is left unchanged if value is invalid.
+// source is only used in the error.
+func (s setting) set(value string, source string) error {
+	var err error
+	switch field := s.value.(type) {
+	case *string:
+		*field = value
+	case *int:
+		var i int
+		if i, err = strconv.Atoi(value); err == nil {
+			*field = i
+		}
+	case *float64:
+		var f float64
+		if f, err = strconv.ParseFloat(value, 64); err == nil {
+			*field = f
+		}
+	case *bool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			*field = b
+		}
+	case *time.Duration:
+		var d time.Duration
+		if d, err = time.ParseDuration(value); err == nil {
+			*field = d
+		}
+	case *[]string:
+		*field = splitList(value)
+	default:
+		err = fmt.Errorf("unsupported type %T", s.value)
+	}
+	if err != nil {
+		return fmt.Errorf("%s%s from %s: invalid value %q", envPrefix, s.key, source, value)
+	}
+	return nil
+}
+
+// splitList splits a comma separated value into its trimmed, non empty parts.
+func splitList(value string) []string {
+	var list []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+// flagName turns a setting key into its flag name, e.g. DB_HOST into db-host.
+func flagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
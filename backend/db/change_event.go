@@ -0,0 +1,186 @@
+package db
+
+import (
+	"backend/diff"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of change events.
+const (
+	ChangeKindListed   = "listed"   // A new etf appeared in the search results, or a missing or delisted one reappeared
+	ChangeKindChanged  = "changed"  // A field of a known etf changed
+	ChangeKindVanished = "vanished" // The etf was missing from a complete list run for the first time
+	ChangeKindDelisted = "delisted" // The etf was missing from too many complete list runs in a row
+)
+
+// ChangeEvent is a detected change of an etf. Field, OldValue and NewValue are only set for ChangeKindChanged.
+type ChangeEvent struct {
+	Id         int64           `json:"id"`
+	EtfId      string          `json:"etf_id"`
+	Kind       string          `json:"kind"`
+	Field      string          `json:"field,omitempty"`
+	OldValue   json.RawMessage `json:"old_value,omitempty"`
+	NewValue   json.RawMessage `json:"new_value,omitempty"`
+	DetectedAt time.Time       `json:"detected_at"`
+}
+
+// ChangeEventFilter selects change events. Zero values don't filter.
+type ChangeEventFilter struct {
+	EtfId   string
+	Kind    string
+	Field   string // Matches the field and everything nested below it, e.g. "composition.country"
+	Since   time.Time
+	AfterId int64 // Only events with a greater id, to continue a previous page
+	Limit   int
+}
+
+func (f ChangeEventFilter) validate() error {
+	switch f.Kind {
+	case "", ChangeKindListed, ChangeKindChanged, ChangeKindVanished, ChangeKindDelisted:
+	default:
+		return validationError("unknown change kind %q", f.Kind)
+	}
+	if f.Limit < 0 || f.AfterId < 0 {
+		return validationError("limit and after id must not be negative")
+	}
+	return nil
+}
+
+// recordEtfSnapshot appends the current state of the etf to its history, unless it equals the latest snapshot,
+// and records what changed as change events.
+// The snapshot content is built by the sql function etf_snapshot_data, which leaves out volatile columns like scrape dates.
+func recordEtfSnapshot(ctx context.Context, tx *sql.Tx, etfId string) error {
+	return recordEtfSnapshots(ctx, tx, []string{etfId})
+}
+
+// recordEtfSnapshots is recordEtfSnapshot for many etfs, reading their current and latest snapshots with one query.
+func recordEtfSnapshots(ctx context.Context, tx *sql.Tx, etfIds []string) error {
+	type pending struct {
+		etfId        string
+		data         json.RawMessage
+		hash         string
+		previous     json.RawMessage
+		previousHash sql.NullString
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT e.id, d, md5(d::TEXT), s.data, s.content_hash
+		FROM unnest($1::VARCHAR[]) WITH ORDINALITY e(id, n)
+		CROSS JOIN LATERAL etf_snapshot_data(e.id) d
+		LEFT JOIN LATERAL (
+			SELECT data, content_hash FROM t_etf_snapshot
+			WHERE etf_id = e.id
+			ORDER BY taken_at DESC, id DESC
+			LIMIT 1
+		) s ON true
+		WHERE d IS NOT NULL
+		ORDER BY e.n`, pq.Array(etfIds))
+	if err != nil {
+		return err
+	}
+	var changed []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.etfId, &p.data, &p.hash, &p.previous, &p.previousHash); err != nil {
+			rows.Close()
+			return err
+		}
+		if p.hash != p.previousHash.String {
+			changed = append(changed, p)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, p := range changed {
+		_, err = tx.ExecContext(ctx, "INSERT INTO t_etf_snapshot (etf_id, taken_at, content_hash, data) VALUES ($1, $2, $3, $4)",
+			p.etfId, now, p.hash, p.data)
+		if err != nil {
+			return err
+		}
+
+		if p.previous == nil {
+			if err := insertChangeEvent(ctx, tx, ChangeEvent{EtfId: p.etfId, Kind: ChangeKindListed, DetectedAt: now}); err != nil {
+				return err
+			}
+			continue
+		}
+		changes, err := diff.Snapshots(p.previous, p.data)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			event := ChangeEvent{EtfId: p.etfId, Kind: ChangeKindChanged, Field: change.Field, DetectedAt: now}
+			if change.Old != nil {
+				event.OldValue, _ = json.Marshal(change.Old)
+			}
+			if change.New != nil {
+				event.NewValue, _ = json.Marshal(change.New)
+			}
+			if err := insertChangeEvent(ctx, tx, event); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func insertChangeEvent(ctx context.Context, tx *sql.Tx, event ChangeEvent) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO t_etf_change_event (etf_id, kind, field, old_value, new_value, detected_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		event.EtfId, event.Kind, sql.NullString{String: event.Field, Valid: event.Field != ""},
+		nullJSON(event.OldValue), nullJSON(event.NewValue), event.DetectedAt)
+	return err
+}
+
+func nullJSON(value json.RawMessage) sql.NullString {
+	return sql.NullString{String: string(value), Valid: value != nil}
+}
+
+// GetChangeEvents returns the change events matching the filter, oldest first.
+func (r *PostgresRepository) GetChangeEvents(ctx context.Context, filter ChangeEventFilter) ([]ChangeEvent, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, etf_id, kind, coalesce(field, ''), old_value, new_value, detected_at
+		FROM t_etf_change_event
+		WHERE ($1 = '' OR etf_id = $1)
+			AND ($2 = '' OR kind = $2)
+			AND ($3 = '' OR field = $3 OR left(field, length($3) + 1) = $3 || '.')
+			AND detected_at >= $4
+			AND id > $5
+		ORDER BY id
+		LIMIT $6`,
+		filter.EtfId, filter.Kind, filter.Field, filter.Since, filter.AfterId, sql.NullInt64{Int64: int64(filter.Limit), Valid: filter.Limit > 0})
+	if err != nil {
+		return nil, wrapError(err, "get change events")
+	}
+	defer rows.Close()
+
+	events := []ChangeEvent{}
+	for rows.Next() {
+		var event ChangeEvent
+		var oldValue, newValue []byte
+		if err := rows.Scan(&event.Id, &event.EtfId, &event.Kind, &event.Field, &oldValue, &newValue, &event.DetectedAt); err != nil {
+			return nil, wrapError(err, "get change events")
+		}
+		if oldValue != nil {
+			event.OldValue = json.RawMessage(oldValue)
+		}
+		if newValue != nil {
+			event.NewValue = json.RawMessage(newValue)
+		}
+		events = append(events, event)
+	}
+	return events, wrapError(rows.Err(), "get change events")
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"backend/parse"
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Dimensions of t_etf_composition.
+const (
+	CompositionCountry  = "country"
+	CompositionRegion   = "region"
+	CompositionCurrency = "currency"
+	CompositionHolding  = "holding"
+	CompositionIndustry = "industry"
+)
+
+// CompositionEntry is the weight of a single country, region, currency, holding or industry in an etf.
+type CompositionEntry struct {
+	Dimension string  `json:"dimension"`
+	Key       string  `json:"key"`
+	Weight    float64 `json:"weight"` // Fraction, e.g. 0.7189 for "71,89 %"
+}
+
+// compositionEntries collects the composition lists of the scraped details.
+// Entries without a parseable weight are left out.
+func compositionEntries(data EtfDetailsData) []CompositionEntry {
+	entries := []CompositionEntry{}
+	add := func(dimension string, key string, weight string) {
+		value, err := parse.Percent(weight)
+		if err != nil {
+			log.Printf("Error parsing %s weight of %q: %v", dimension, key, err)
+		}
+		if key == "" || !value.Valid {
+			return
+		}
+		entries = append(entries, CompositionEntry{Dimension: dimension, Key: key, Weight: value.Float64})
+	}
+
+	for _, c := range data.CountryComposition {
+		add(CompositionCountry, c.Country, c.Percentile)
+	}
+	for _, c := range data.RegionComposition {
+		add(CompositionRegion, c.Country, c.Percentile)
+	}
+	for _, c := range data.CurrencyDistribution {
+		add(CompositionCurrency, c.Country, c.Percentile)
+	}
+	for _, h := range data.Top10Holdings {
+		add(CompositionHolding, h.Name, h.Percentile)
+	}
+	for _, i := range data.IndustryDistribution {
+		add(CompositionIndustry, i.Name, i.Percentile)
+	}
+	return entries
+}
+
+// replaceComposition replaces all composition entries of an etf. Keys listed twice in a dimension are summed up.
+func replaceComposition(ctx context.Context, tx *sql.Tx, etfId string, entries []CompositionEntry, scrapeDate time.Time) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM t_etf_composition WHERE etf_id = $1", etfId); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO t_etf_composition (etf_id, dimension, key, weight, scrape_date)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (etf_id, dimension, key)
+		DO UPDATE SET weight = t_etf_composition.weight + EXCLUDED.weight`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		if _, err := stmt.ExecContext(ctx, etfId, entry.Dimension, entry.Key, entry.Weight, scrapeDate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
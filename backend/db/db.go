@@ -1,79 +1,136 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"log"
-	"os"
-	"path/filepath"
-	"runtime"
 
+	"backend/parse"
 	"encoding/json"
 	"fmt"
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
-	"strconv"
+	"github.com/lib/pq"
 	"strings"
-	"sync"
 	"time"
 )
 
-var (
-	db   *sql.DB
-	once sync.Once
-)
+// Connect opens the postgres database and checks that it is reachable.
+func Connect(ctx context.Context, connString string) (*sql.DB, error) {
+	conn, err := sql.Open("postgres", connString)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w: %w", ErrValidation, err)
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, wrapError(err, "connecting to database")
+	}
+	log.Print("Successfully conected to database!")
+	return conn, nil
+}
 
-func Establish_db_conn() {
-	once.Do(func() {
-		// Load .env file according to app env
-		var app_env = os.Getenv("APP_ENV")
-		if app_env == "" {
-			app_env = "dev"
-		}
-		_, filename, _, _ := runtime.Caller(0)                           // Gets this files path
-		projectRoot := filepath.Join(filepath.Dir(filename), "..", "..") // Goes up two levels to root dir
-		envFile := filepath.Join(projectRoot, "backend", app_env+".env")
-		err := godotenv.Load(envFile)
-		if err != nil {
-			log.Fatal("Error loading .env file:", err)
-		}
+// EtfBaseData is the data of an etf shown in the search results.
+type EtfBaseData struct {
+	Id                  string
+	Name                string
+	FundVolume          string // As displayed, e.g. "1,23 Mrd. €"
+	IsDistributing      bool
+	ReleaseDate         time.Time
+	ReplicationMethod   string
+	ShareClassVolume    string // As displayed
+	TotalExpenseRatio   sql.NullFloat64
+	FundVolumeEur       sql.NullFloat64 // In parse.BaseCurrency, if parseable
+	ShareClassVolumeEur sql.NullFloat64
+}
+
+// UpsertResult counts the etfs passed to UpsertEtfs by what happened to them.
+type UpsertResult struct {
+	Inserted  int // Etfs that were not stored before
+	Updated   int // Etfs whose base data changed, or that were missing or delisted before
+	Unchanged int // Etfs identical to the stored ones. Only their last seen time is refreshed
+}
 
-		// Read env vars
-		DB_USER := os.Getenv("ASSETFORGE_V2_DB_USER")
-		DB_PASSWORD := os.Getenv("ASSETFORGE_V2_DB_PASSWORD")
-		DB_NAME := os.Getenv("ASSETFORGE_V2_DB_NAME")
-		DB_HOST := os.Getenv("ASSETFORGE_V2_DB_HOST")
-		DB_PORT := os.Getenv("ASSETFORGE_V2_DB_PORT")
+// Add sums up the counts, e.g. of all pages of a run.
+func (r *UpsertResult) Add(other UpsertResult) {
+	r.Inserted += other.Inserted
+	r.Updated += other.Updated
+	r.Unchanged += other.Unchanged
+}
 
-		// Connect to db
-		connStr := "user=" + DB_USER + " password=" + DB_PASSWORD + " dbname=" + DB_NAME + " sslmode=disable host=" + DB_HOST + " port=" + DB_PORT
-		db, err = sql.Open("postgres", connStr)
-		if err != nil {
-			log.Fatal("Error connecting to the database:", err)
-		}
-		err = db.Ping()
-		if err != nil {
-			log.Fatal("Connection could not be opened. Error:", err)
-		}
-		log.Print("Successfully conected to database!")
-	})
+// Rows per INSERT statement of UpsertEtfs. Postgres allows at most 65535 parameters per statement.
+const upsertChunkSize = 1000
+
+// InsertOrUpdateEtf upserts the base data of a single etf, see UpsertEtfs.
+func (r *PostgresRepository) InsertOrUpdateEtf(ctx context.Context, data EtfBaseData) error {
+	_, err := r.UpsertEtfs(ctx, []EtfBaseData{data})
+	return err
 }
 
-func GetDb() *sql.DB {
-	if db == nil {
-		log.Fatal("db.Getdb() called without connection being established first. First call db.Establish_db_conn().")
+// UpsertEtfs upserts the base data of a batch of etfs from the search results, e.g. a list page, in one transaction.
+// The etfs are written with multi-row INSERT ... ON CONFLICT statements, marked as seen and snapshotted.
+// Rows identical to the stored etfs are not rewritten, so they neither get a new snapshot nor change events.
+// Nothing is written if an etf is invalid. If an id occurs more than once, its last row wins.
+func (r *PostgresRepository) UpsertEtfs(ctx context.Context, batch []EtfBaseData) (UpsertResult, error) {
+	var result UpsertResult
+	batch, err := prepareUpsertBatch(batch)
+	if err != nil || len(batch) == 0 {
+		return result, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, wrapError(err, "upsert %d etfs", len(batch))
 	}
-	return db
+	defer tx.Rollback()
+
+	seenAt := time.Now()
+	var written []string
+	for start := 0; start < len(batch); start += upsertChunkSize {
+		chunk := batch[start:min(start+upsertChunkSize, len(batch))]
+		ids, err := upsertEtfChunk(ctx, tx, chunk, seenAt, &result)
+		if err != nil {
+			return UpsertResult{}, wrapError(err, "upsert %d etfs", len(batch))
+		}
+		written = append(written, ids...)
+	}
+	if err := recordEtfSnapshots(ctx, tx, written); err != nil {
+		return UpsertResult{}, wrapError(err, "record snapshots of %d etfs", len(written))
+	}
+	if err := tx.Commit(); err != nil {
+		return UpsertResult{}, wrapError(err, "commit %d etfs", len(batch))
+	}
+	return result, nil
 }
 
-func InsertOrUpdateEtf(id string, name string, fundVolume string, isDistributing bool, releaseDate time.Time, replicationMethod string, shareClassVolume string, totalExpenseRatio float32) {
-	// Ensure releaseDate is only a date, not a timestamp.
-	releaseDate = releaseDate.Truncate(24 * time.Hour)
+// upsertEtfChunk upserts the etfs with a single statement, sets them active again and returns the ids of the inserted and updated ones.
+// A listed change event is recorded for every etf that was missing or delisted before.
+func upsertEtfChunk(ctx context.Context, tx *sql.Tx, chunk []EtfBaseData, seenAt time.Time, result *UpsertResult) ([]string, error) {
+	const baseColumns = 10
+	ids := make([]string, len(chunk))
+	args := []any{seenAt, seenAt, EtfStatusActive}
+	values := make([]string, len(chunk))
+	for i, data := range chunk {
+		ids[i] = data.Id
+		placeholders := make([]string, baseColumns)
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%d", len(args)+j+1)
+		}
+		values[i] = "(" + strings.Join(placeholders, ", ") + ", $1, $2, $3, 0)"
+		// Ensure releaseDate is only a date, not a timestamp.
+		releaseDate := data.ReleaseDate.Truncate(24 * time.Hour)
+		args = append(args, data.Id, data.Name, data.FundVolume, data.IsDistributing, releaseDate, data.ReplicationMethod, data.ShareClassVolume,
+			data.TotalExpenseRatio, data.FundVolumeEur, data.ShareClassVolumeEur)
+	}
 
-	scrape_date_base_data := time.Now()
+	// The statuses are read and locked before the insert, so they can't change until it is done
+	previous, err := lockEtfStatuses(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
 
-	var queryString = `
-		INSERT INTO t_etf (id, name, fundVolume, isDistributing, releaseDate, replicationMethod, shareClassVolume, totalExpenseRatio, scrape_date_base_data)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	// Conflicting rows are only updated if something differs, the others are not returned. xmax is 0 for freshly inserted rows.
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO t_etf (id, name, fundVolume, isDistributing, releaseDate, replicationMethod, shareClassVolume, totalExpenseRatio, fund_volume_eur, share_class_volume_eur,
+			scrape_date_base_data, last_seen_at, status, missed_runs)
+		VALUES `+strings.Join(values, ", ")+`
 		ON CONFLICT (id)
 		DO UPDATE SET
 			name = EXCLUDED.name,
@@ -83,12 +140,110 @@ func InsertOrUpdateEtf(id string, name string, fundVolume string, isDistributing
 			replicationMethod = EXCLUDED.replicationMethod,
 			shareClassVolume = EXCLUDED.shareClassVolume,
 			totalExpenseRatio = EXCLUDED.totalExpenseRatio,
-      scrape_date_base_data = EXCLUDED.scrape_date_base_data`
+			fund_volume_eur = EXCLUDED.fund_volume_eur,
+			share_class_volume_eur = EXCLUDED.share_class_volume_eur,
+			scrape_date_base_data = EXCLUDED.scrape_date_base_data,
+			last_seen_at = EXCLUDED.last_seen_at,
+			status = EXCLUDED.status,
+			missed_runs = EXCLUDED.missed_runs
+		WHERE (t_etf.name, t_etf.fundVolume, t_etf.isDistributing, t_etf.releaseDate, t_etf.replicationMethod, t_etf.shareClassVolume,
+				t_etf.totalExpenseRatio, t_etf.fund_volume_eur, t_etf.share_class_volume_eur, t_etf.status, t_etf.missed_runs)
+			IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.fundVolume, EXCLUDED.isDistributing, EXCLUDED.releaseDate, EXCLUDED.replicationMethod, EXCLUDED.shareClassVolume,
+				EXCLUDED.totalExpenseRatio, EXCLUDED.fund_volume_eur, EXCLUDED.share_class_volume_eur, EXCLUDED.status, EXCLUDED.missed_runs)
+		RETURNING id, xmax = 0`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	written := []string{} // Not nil, pq passes nil arrays as NULL
+	var relisted []string
+	for rows.Next() {
+		var id string
+		var inserted bool
+		if err := rows.Scan(&id, &inserted); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		written = append(written, id)
+		if inserted {
+			result.Inserted++
+		} else {
+			result.Updated++
+		}
+		if previous[id] == EtfStatusMissing || previous[id] == EtfStatusDelisted {
+			relisted = append(relisted, id)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := db.Exec(queryString, id, name, fundVolume, isDistributing, releaseDate, replicationMethod, shareClassVolume, totalExpenseRatio, scrape_date_base_data)
+	if len(written) < len(ids) {
+		result.Unchanged += len(ids) - len(written)
+		// ReconcileListRun relies on the last seen time of all etfs in the search results
+		_, err = tx.ExecContext(ctx, "UPDATE t_etf SET scrape_date_base_data = $1, last_seen_at = $2 WHERE id = ANY($3) AND NOT id = ANY($4)",
+			seenAt, seenAt, pq.Array(ids), pq.Array(written))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range relisted {
+		if err := insertChangeEvent(ctx, tx, ChangeEvent{EtfId: id, Kind: ChangeKindListed, DetectedAt: seenAt}); err != nil {
+			return nil, err
+		}
+	}
+	return written, nil
+}
+
+// lockEtfStatuses returns the statuses of the stored etfs among ids, by id, and locks their rows until the end of tx.
+func lockEtfStatuses(ctx context.Context, tx *sql.Tx, ids []string) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id, status FROM t_etf WHERE id = ANY($1) FOR UPDATE", pq.Array(ids))
 	if err != nil {
-		log.Printf("Error executing query: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := map[string]string{}
+	for rows.Next() {
+		var id, status string
+		if err := rows.Scan(&id, &status); err != nil {
+			return nil, err
+		}
+		statuses[id] = status
 	}
+	return statuses, rows.Err()
+}
+
+// prepareUpsertBatch validates all etfs of a batch and removes duplicate ids, which a single
+// INSERT ... ON CONFLICT statement can't update twice. The last row of an id wins, at the position of the first.
+func prepareUpsertBatch(batch []EtfBaseData) ([]EtfBaseData, error) {
+	positions := make(map[string]int, len(batch))
+	prepared := make([]EtfBaseData, 0, len(batch))
+	for _, data := range batch {
+		if err := data.Validate(); err != nil {
+			return nil, err
+		}
+		if i, ok := positions[data.Id]; ok {
+			prepared[i] = data
+			continue
+		}
+		positions[data.Id] = len(prepared)
+		prepared = append(prepared, data)
+	}
+	return prepared, nil
+}
+
+// Validate checks the fields required to store an etf, so callers can skip invalid rows before upserting a batch.
+func (data EtfBaseData) Validate() error {
+	if data.Id == "" {
+		return validationError("etf without id")
+	}
+	if data.Name == "" {
+		return validationError("etf %s without name", data.Id)
+	}
+	return nil
 }
 
 type EtfDetailsData struct {
@@ -176,62 +331,34 @@ type EtfDetailsData struct {
 		Currency string `json:"currency"`
 		Ticker   string `json:"ticker"`
 	} `json:"exchanges"`
-}
 
-func UpdateEtfDetails(data EtfDetailsData) error {
-	var scrapeDateDetails = time.Now()
+	// Rows of the "Basisdaten" and "Rechtliche Struktur" cards whose label is not mapped to a field
+	AdditionalAttributes map[string]string `json:"additional_attributes"`
+}
 
-	// Parse
-	var weight_top_10 = strings.TrimSpace(data.WeightTop10)
-	weight_top_10 = strings.TrimSuffix(weight_top_10, "%")
-	weight_top_10 = strings.ReplaceAll(weight_top_10, "\u00a0", "")
-	weight_top_10 = strings.ReplaceAll(weight_top_10, ",", ".")
-	var weight_top_10_float, err_weight_top_10_float = strconv.ParseFloat(weight_top_10, 32)
-	weight_top_10_float = weight_top_10_float / 100
-	if err_weight_top_10_float != nil {
-		fmt.Println("Error parsing weight_top_10:", err_weight_top_10_float)
+// UpdateEtfDetails stores the details of an etf scraped from its page.
+// An isin or wkn that is invalid or already used by another etf is quarantined, the other details are stored anyway.
+// ErrNotFound is returned if the etf is not in t_etf yet.
+func (r *PostgresRepository) UpdateEtfDetails(ctx context.Context, data EtfDetailsData) error {
+	if data.Id == "" {
+		return validationError("etf details without id")
 	}
+	var scrapeDateDetails = time.Now()
 
-	// Convert all fields to sql.NullXXX types
-	fields := map[string]interface{}{
-		"ISIN":                       sql.NullString{String: data.ISIN, Valid: data.ISIN != ""},
-		"WKN":                        sql.NullString{String: data.WKN, Valid: data.WKN != ""},
-		"NrPositions":                sql.NullInt64{Int64: parseToInt64(data.NrPositions), Valid: data.NrPositions != "" && data.NrPositions != "—"},
-		"BaseIndex":                  sql.NullString{String: data.BaseIndex, Valid: data.BaseIndex != ""},
-		"ShareClassVolume":           sql.NullString{String: data.ShareClassVolume, Valid: data.ShareClassVolume != ""},
-		"FundDomicile":               sql.NullString{String: data.FundDomicile, Valid: data.FundDomicile != ""},
-		"FundCurrency":               sql.NullString{String: data.FundCurrency, Valid: data.FundCurrency != ""},
-		"SecuritiesLendingPermitted": sql.NullBool{Bool: data.SecuritiesLendingPermitted, Valid: true},
-		"TradeCurrency":              sql.NullString{String: data.TradeCurrency, Valid: data.TradeCurrency != ""},
-		"HasCurrencyHedging":         sql.NullBool{Bool: data.HasCurrencyHedging, Valid: true},
-		"HasSpecialAssets":           sql.NullBool{Bool: data.HasSpecialAssets, Valid: true},
-		"FundProvider":               sql.NullString{String: data.FundProvider, Valid: data.FundProvider != ""},
-		"LegalStructure":             sql.NullString{String: data.LegalStructure, Valid: data.LegalStructure != ""},
-		"FundStructure":              sql.NullString{String: data.FundStructure, Valid: data.FundStructure != ""},
-		"Administrator":              sql.NullString{String: data.Administrator, Valid: data.Administrator != ""},
-		"Depotbank":                  sql.NullString{String: data.Depotbank, Valid: data.Depotbank != ""},
-		"Auditor":                    sql.NullString{String: data.Auditor, Valid: data.Auditor != ""},
-		"CountryComposition":         sql.NullString{String: marshalJSON(data.CountryComposition), Valid: data.CountryComposition != nil},
-		"RegionComposition":          sql.NullString{String: marshalJSON(data.RegionComposition), Valid: data.RegionComposition != nil},
-		"CurrencyDistribution":       sql.NullString{String: marshalJSON(data.CurrencyDistribution), Valid: data.CurrencyDistribution != nil},
-		"Top10Holdings":              sql.NullString{String: marshalJSON(data.Top10Holdings), Valid: data.Top10Holdings != nil},
-		"IndustryDistribution":       sql.NullString{String: marshalJSON(data.IndustryDistribution), Valid: data.IndustryDistribution != nil},
-		"ActivityDistribution":       sql.NullString{String: marshalJSON(data.ActivityDistribution), Valid: data.ActivityDistribution != nil},
-		"HistoricalPerformance":      sql.NullString{String: marshalJSON(data.HistoricalPerformance), Valid: data.HistoricalPerformance != nil},
-		"HistoricalVolatility":       sql.NullString{String: marshalJSON(data.HistoricalVolatility), Valid: data.HistoricalVolatility != nil},
-		"HistoricalMaxDrawdown":      sql.NullString{String: marshalJSON(data.HistoricalMaxDrawdown), Valid: data.HistoricalMaxDrawdown != nil},
-		"HistoricalSharpeRatio":      sql.NullString{String: marshalJSON(data.HistoricalSharpeRatio), Valid: data.HistoricalSharpeRatio != nil},
-		"Exchanges":                  sql.NullString{String: marshalJSON(data.Exchanges), Valid: data.Exchanges != nil},
-		"WeightTop10":                sql.NullFloat64{Float64: weight_top_10_float, Valid: err_weight_top_10_float == nil},
-		"NrStockPositions":           sql.NullInt64{Int64: parseToInt64(data.NrStockPositions), Valid: data.NrStockPositions != ""},
-		"NrBondPositions":            sql.NullInt64{Int64: parseToInt64(data.NrBondPositions), Valid: data.NrBondPositions != ""},
-		"NrCashAndOtherPositions":    sql.NullInt64{Int64: parseToInt64(data.NrCashAndOtherPositions), Valid: data.NrCashAndOtherPositions != ""},
+	// The compositions, quarantined values and the snapshot of the new state are written in the same transaction as the details
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(err, "update details of etf %s", data.Id)
 	}
+	defer tx.Rollback()
 
-	// Validate fields
-	if err := ValidateNullFields(fields); err != nil {
-		log.Printf("Validation failed: %v", err)
+	data, quarantined := checkIdentifiers(data, scrapeDateDetails)
+	duplicates, err := claimIdentifiers(ctx, tx, &data, scrapeDateDetails)
+	if err != nil {
+		return wrapError(err, "check identifiers of etf %s", data.Id)
 	}
+	quarantined = append(quarantined, duplicates...)
+	fields := etfDetailsFields(data)
 
 	// Prepare query arguments in the correct order
 	queryArgs := []interface{}{
@@ -268,6 +395,8 @@ func UpdateEtfDetails(data EtfDetailsData) error {
 		fields["HistoricalMaxDrawdown"],
 		fields["HistoricalSharpeRatio"],
 		fields["Exchanges"],
+		fields["AdditionalAttributes"],
+		fields["ShareClassVolumeEur"],
 		scrapeDateDetails, // Last argument is scrape date
 	}
 
@@ -306,20 +435,98 @@ func UpdateEtfDetails(data EtfDetailsData) error {
             historical_max_drawdown = $31,
             historical_sharpe_ratio = $32,
             exchanges = $33,
-            scrape_date_details = $34
+            additional_attributes = $34,
+            share_class_volume_eur = $35,
+            scrape_date_details = $36
         WHERE id = $1
     `
 
-	_, err := db.Exec(query, queryArgs...)
+	result, err := tx.ExecContext(ctx, query, queryArgs...)
 	if err != nil {
-		log.Printf("Error executing update: %v", err)
-		return err
+		return wrapError(err, "update details of etf %s", data.Id)
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return wrapError(sql.ErrNoRows, "update details of etf %s", data.Id)
+	}
+	if err := insertQuarantinedValues(ctx, tx, quarantined); err != nil {
+		return wrapError(err, "quarantine identifiers of etf %s", data.Id)
+	}
+	if err := replaceComposition(ctx, tx, data.Id, compositionEntries(data), scrapeDateDetails); err != nil {
+		return wrapError(err, "update composition of etf %s", data.Id)
+	}
+	if err := recordEtfSnapshot(ctx, tx, data.Id); err != nil {
+		return wrapError(err, "record snapshot of etf %s", data.Id)
+	}
+	if err := tx.Commit(); err != nil {
+		return wrapError(err, "commit details of etf %s", data.Id)
 	}
 
+	for _, value := range quarantined {
+		log.Printf("Quarantined %s %q of etf %s: %s", value.Field, value.Value, data.Id, value.Reason)
+	}
 	log.Println("Updated etf details for id", data.Id)
 	return nil
 }
 
+// etfDetailsFields parses the scraped details into sql.NullXXX values, keyed by EtfDetailsData field name.
+// The compositions are included as scraped, their parsed entries are stored in t_etf_composition.
+func etfDetailsFields(data EtfDetailsData) map[string]interface{} {
+	// Parse
+	weightTop10, err := parse.Percent(data.WeightTop10)
+	if err != nil {
+		log.Println("Error parsing weight_top_10:", err)
+	}
+	shareClassVolume, err := parse.Volume(data.ShareClassVolume)
+	if err != nil {
+		log.Println("Error parsing share_class_volume:", err)
+	}
+
+	// Convert all fields to sql.NullXXX types
+	fields := map[string]interface{}{
+		"ISIN":                       sql.NullString{String: data.ISIN, Valid: data.ISIN != ""},
+		"WKN":                        sql.NullString{String: data.WKN, Valid: data.WKN != ""},
+		"NrPositions":                parseInt("nr_positions", data.NrPositions),
+		"BaseIndex":                  sql.NullString{String: data.BaseIndex, Valid: data.BaseIndex != ""},
+		"ShareClassVolume":           sql.NullString{String: data.ShareClassVolume, Valid: data.ShareClassVolume != ""},
+		"ShareClassVolumeEur":        shareClassVolume.InBaseCurrency(),
+		"FundDomicile":               sql.NullString{String: data.FundDomicile, Valid: data.FundDomicile != ""},
+		"FundCurrency":               sql.NullString{String: data.FundCurrency, Valid: data.FundCurrency != ""},
+		"SecuritiesLendingPermitted": sql.NullBool{Bool: data.SecuritiesLendingPermitted, Valid: true},
+		"TradeCurrency":              sql.NullString{String: data.TradeCurrency, Valid: data.TradeCurrency != ""},
+		"HasCurrencyHedging":         sql.NullBool{Bool: data.HasCurrencyHedging, Valid: true},
+		"HasSpecialAssets":           sql.NullBool{Bool: data.HasSpecialAssets, Valid: true},
+		"FundProvider":               sql.NullString{String: data.FundProvider, Valid: data.FundProvider != ""},
+		"LegalStructure":             sql.NullString{String: data.LegalStructure, Valid: data.LegalStructure != ""},
+		"FundStructure":              sql.NullString{String: data.FundStructure, Valid: data.FundStructure != ""},
+		"Administrator":              sql.NullString{String: data.Administrator, Valid: data.Administrator != ""},
+		"Depotbank":                  sql.NullString{String: data.Depotbank, Valid: data.Depotbank != ""},
+		"Auditor":                    sql.NullString{String: data.Auditor, Valid: data.Auditor != ""},
+		"CountryComposition":         sql.NullString{String: marshalJSON(data.CountryComposition), Valid: data.CountryComposition != nil},
+		"RegionComposition":          sql.NullString{String: marshalJSON(data.RegionComposition), Valid: data.RegionComposition != nil},
+		"CurrencyDistribution":       sql.NullString{String: marshalJSON(data.CurrencyDistribution), Valid: data.CurrencyDistribution != nil},
+		"Top10Holdings":              sql.NullString{String: marshalJSON(data.Top10Holdings), Valid: data.Top10Holdings != nil},
+		"IndustryDistribution":       sql.NullString{String: marshalJSON(data.IndustryDistribution), Valid: data.IndustryDistribution != nil},
+		"ActivityDistribution":       sql.NullString{String: marshalJSON(data.ActivityDistribution), Valid: data.ActivityDistribution != nil},
+		"HistoricalPerformance":      sql.NullString{String: marshalJSON(data.HistoricalPerformance), Valid: data.HistoricalPerformance != nil},
+		"HistoricalVolatility":       sql.NullString{String: marshalJSON(data.HistoricalVolatility), Valid: data.HistoricalVolatility != nil},
+		"HistoricalMaxDrawdown":      sql.NullString{String: marshalJSON(data.HistoricalMaxDrawdown), Valid: data.HistoricalMaxDrawdown != nil},
+		"HistoricalSharpeRatio":      sql.NullString{String: marshalJSON(data.HistoricalSharpeRatio), Valid: data.HistoricalSharpeRatio != nil},
+		"Exchanges":                  sql.NullString{String: marshalJSON(data.Exchanges), Valid: data.Exchanges != nil},
+		"AdditionalAttributes":       sql.NullString{String: marshalJSON(data.AdditionalAttributes), Valid: data.AdditionalAttributes != nil},
+		"WeightTop10":                weightTop10,
+		"NrStockPositions":           parseInt("nr_stock_positions", data.NrStockPositions),
+		"NrBondPositions":            parseInt("nr_bond_positions", data.NrBondPositions),
+		"NrCashAndOtherPositions":    parseInt("nr_cash_and_other_positions", data.NrCashAndOtherPositions),
+	}
+
+	// Validate fields
+	if err := ValidateNullFields(fields); err != nil {
+		log.Printf("Validation failed: %v", err)
+	}
+
+	return fields
+}
+
 func ValidateNullFields(fields map[string]interface{}) error {
 	var warnings []string
 
@@ -351,10 +558,11 @@ func ValidateNullFields(fields map[string]interface{}) error {
 	return nil
 }
 
-func parseToInt64(value string) int64 {
-	v, err := strconv.ParseInt(value, 10, 64)
+// parseInt parses a german formatted count, logging values that are neither a number nor empty.
+func parseInt(field string, value string) sql.NullInt64 {
+	v, err := parse.Int(value)
 	if err != nil {
-		return 0
+		log.Printf("Error parsing %s: %v", field, err)
 	}
 	return v
 }
@@ -367,14 +575,32 @@ func marshalJSON(data interface{}) string {
 	return string(b)
 }
 
-func GetAllIds() (*sql.Rows, error) {
-	query := "select id from t_etf;"
-	rows, err := db.Query(query)
-	return rows, err
+// GetAllIds returns the ids of all active etfs.
+func (r *PostgresRepository) GetAllIds(ctx context.Context) ([]string, error) {
+	ids, err := r.queryIds(ctx, "select id from t_etf where status = $1;", EtfStatusActive)
+	return ids, wrapError(err, "get etf ids")
 }
 
-func GetAllIdsWhereNoDetails() (*sql.Rows, error) {
-	query := "select id from t_etf where scrape_date_details is NULL;"
-	rows, err := db.Query(query)
-	return rows, err
+// GetAllIdsWhereNoDetails returns the ids of all active etfs without details.
+func (r *PostgresRepository) GetAllIdsWhereNoDetails(ctx context.Context) ([]string, error) {
+	ids, err := r.queryIds(ctx, "select id from t_etf where scrape_date_details is NULL and status = $1;", EtfStatusActive)
+	return ids, wrapError(err, "get etf ids without details")
+}
+
+func (r *PostgresRepository) queryIds(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of errors returned by the repositories, checked with errors.Is.
+// The original error stays in the chain, e.g. sql.ErrNoRows for ErrNotFound.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")          // e.g. a unique constraint violation
+	ErrValidation = errors.New("validation failed") // Invalid input, rejected by the repository or a constraint
+	ErrTransient  = errors.New("transient error")   // Connection problems, timeouts, serialization failures. Worth retrying
+)
+
+// wrapError prefixes err with the failed operation and its kind, e.g. "get scrape run 3: not found: sql: no rows in result set".
+// nil stays nil and errors that already have a kind only get the operation added.
+func wrapError(err error, op string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+	op = fmt.Sprintf(op, args...)
+	kind := errorKind(err)
+	if kind == nil || hasKind(err) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return fmt.Errorf("%s: %w: %w", op, kind, err)
+}
+
+// validationError creates an ErrValidation for input rejected before it reaches the database.
+func validationError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrValidation, fmt.Sprintf(format, args...))
+}
+
+func hasKind(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) || errors.Is(err, ErrValidation) || errors.Is(err, ErrTransient)
+}
+
+// errorKind maps driver errors to a kind. Errors of no known kind, including context.Canceled, return nil.
+func errorKind(err error) error {
+	var pqErr *pq.Error
+	var netErr net.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return ErrTransient
+	case errors.As(err, &pqErr):
+		return pqErrorKind(pqErr)
+	case errors.As(err, &netErr):
+		return ErrTransient
+	}
+	return nil
+}
+
+// pqErrorKind classifies postgres errors by their SQLSTATE, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+func pqErrorKind(err *pq.Error) error {
+	code := string(err.Code)
+	switch {
+	// unique_violation
+	case code == "23505":
+		return ErrConflict
+	// integrity_constraint_violation, data_exception
+	case strings.HasPrefix(code, "23"), strings.HasPrefix(code, "22"):
+		return ErrValidation
+	// connection_exception, transaction_rollback (serialization failures, deadlocks), insufficient_resources,
+	// query_canceled (e.g. by statement_timeout), admin_shutdown, crash_shutdown, cannot_connect_now
+	case strings.HasPrefix(code, "08"), strings.HasPrefix(code, "40"), strings.HasPrefix(code, "53"),
+		code == "57014", code == "57P01", code == "57P02", code == "57P03":
+		return ErrTransient
+	}
+	return nil
+}
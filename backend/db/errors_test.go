@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestWrapError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		kind error
+	}{
+		{sql.ErrNoRows, ErrNotFound},
+		{&pq.Error{Code: "23505"}, ErrConflict},
+		{&pq.Error{Code: "23502"}, ErrValidation},
+		{&pq.Error{Code: "22P02"}, ErrValidation},
+		{&pq.Error{Code: "40001"}, ErrTransient},
+		{&pq.Error{Code: "57P01"}, ErrTransient},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), ErrTransient},
+		{&pq.Error{Code: "42P01"}, nil},
+		{context.Canceled, nil},
+	} {
+		err := wrapError(tc.err, "get etf %s", "a")
+		if !errors.Is(err, tc.err) {
+			t.Errorf("wrapError(%v) = %v, lost the original error", tc.err, err)
+		}
+		for _, kind := range []error{ErrNotFound, ErrConflict, ErrValidation, ErrTransient} {
+			if errors.Is(err, kind) != (kind == tc.kind) {
+				t.Errorf("wrapError(%v) = %v, want kind %v", tc.err, err, tc.kind)
+			}
+		}
+	}
+
+	if err := wrapError(nil, "get etf"); err != nil {
+		t.Errorf("wrapError(nil) = %v, want nil", err)
+	}
+	twice := wrapError(wrapError(sql.ErrNoRows, "inner"), "outer")
+	if got, want := twice.Error(), "outer: inner: not found: sql: no rows in result set"; got != want {
+		t.Errorf("wrapped twice = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Statuses of an etf, tracked via complete list runs.
+const (
+	EtfStatusActive   = "active"   // Part of the latest complete list run
+	EtfStatusMissing  = "missing"  // Missing from the latest complete list run(s), may come back. Excluded by default
+	EtfStatusDelisted = "delisted" // Missing from too many complete list runs in a row. Excluded by default
+)
+
+// ListRunReconciliation is the outcome of ReconcileListRun.
+type ListRunReconciliation struct {
+	Missing  int // Etfs missing from this run, including the newly delisted ones
+	Delisted int // Etfs delisted by this run
+}
+
+// ReconcileListRun counts a miss for every etf that was not seen since runStartedAt, i.e. that was not part of
+// the complete list run started then. Etfs become missing on their first miss and delisted after delistAfterMisses misses in a row.
+// The transitions are recorded as vanished and delisted change events.
+func (r *PostgresRepository) ReconcileListRun(ctx context.Context, runStartedAt time.Time, delistAfterMisses int) (ListRunReconciliation, error) {
+	var reconciliation ListRunReconciliation
+	if delistAfterMisses < 1 {
+		return reconciliation, validationError("delistAfterMisses must be at least 1, got %d", delistAfterMisses)
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return reconciliation, wrapError(err, "reconcile list run")
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE t_etf SET
+			missed_runs = missed_runs + 1,
+			status = CASE WHEN missed_runs + 1 >= $2 THEN $3 ELSE $4 END
+		WHERE status <> $3 AND (last_seen_at IS NULL OR last_seen_at < $1)
+		RETURNING id, status, missed_runs`,
+		runStartedAt, delistAfterMisses, EtfStatusDelisted, EtfStatusMissing)
+	if err != nil {
+		return reconciliation, wrapError(err, "reconcile list run")
+	}
+
+	now := time.Now()
+	var events []ChangeEvent
+	for rows.Next() {
+		var id, status string
+		var missedRuns int
+		if err := rows.Scan(&id, &status, &missedRuns); err != nil {
+			rows.Close()
+			return reconciliation, wrapError(err, "reconcile list run")
+		}
+		reconciliation.Missing++
+		if missedRuns == 1 {
+			events = append(events, ChangeEvent{EtfId: id, Kind: ChangeKindVanished, DetectedAt: now})
+		}
+		if status == EtfStatusDelisted {
+			reconciliation.Delisted++
+			events = append(events, ChangeEvent{EtfId: id, Kind: ChangeKindDelisted, DetectedAt: now})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return reconciliation, wrapError(err, "reconcile list run")
+	}
+
+	for _, event := range events {
+		if err := insertChangeEvent(ctx, tx, event); err != nil {
+			return reconciliation, wrapError(err, "reconcile list run")
+		}
+	}
+	return reconciliation, wrapError(tx.Commit(), "reconcile list run")
+}
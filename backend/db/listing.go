@@ -0,0 +1,161 @@
+package db
+
+import (
+	"backend/screener"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Sort keys of ListEtfs, by the t_etf column they sort by.
+// Names sort alphabetically ignoring case, as a catalogue is read. Beyond that the collation of the database decides,
+// e.g. about punctuation.
+var etfListSortColumns = map[string]string{
+	EtfSortName:          "lower(name)",
+	EtfSortTer:           "totalExpenseRatio",
+	EtfSortVolume:        "fund_volume_eur",
+	EtfSortReleaseDate:   "releaseDate",
+	EtfSortPerformance1y: "performance_1y",
+	EtfSortPerformance3y: "performance_3y",
+	EtfSortPerformance5y: "performance_5y",
+}
+
+const (
+	EtfSortName          = "name"
+	EtfSortTer           = "ter"
+	EtfSortVolume        = "volume" // Fund volume in parse.BaseCurrency
+	EtfSortReleaseDate   = "release_date"
+	EtfSortPerformance1y = "performance_1y"
+	EtfSortPerformance3y = "performance_3y"
+	EtfSortPerformance5y = "performance_5y"
+)
+
+// EtfListFilter selects and orders the etfs of ListEtfs. Zero values don't filter.
+// Text filters ignore case. Etfs without a value for the sort key come last in both directions.
+type EtfListFilter struct {
+	IsDistributing     *bool
+	ReplicationMethod  string
+	FundCurrency       string
+	FundDomicile       string
+	FundProvider       string
+	HasCurrencyHedging *bool
+	MinTer             *float64 // Fraction, e.g. 0.002 for 0,20 %
+	MaxTer             *float64
+	IncludeInactive    bool            // Also missing and delisted etfs
+	Screen             *screener.Query // Only etfs matching the screen
+
+	Sort       string // One of the EtfSort* keys. Defaults to EtfSortName
+	Descending bool
+	Offset     int
+	Limit      int // 0 returns all
+}
+
+func (f EtfListFilter) validate() error {
+	if _, ok := etfListSortColumns[f.Sort]; f.Sort != "" && !ok {
+		return validationError("unknown sort key %q", f.Sort)
+	}
+	if f.Offset < 0 || f.Limit < 0 {
+		return validationError("offset and limit must not be negative")
+	}
+	if f.MinTer != nil && f.MaxTer != nil && *f.MinTer > *f.MaxTer {
+		return validationError("min ter %v is greater than max ter %v", *f.MinTer, *f.MaxTer)
+	}
+	return nil
+}
+
+// EtfListItem is the compact form of an etf in listings. Fields are named like in EtfProfile.
+type EtfListItem struct {
+	Id                 string   `json:"id"`
+	Name               string   `json:"name"`
+	ISIN               *string  `json:"isin"`
+	Status             string   `json:"status"`
+	TotalExpenseRatio  *float64 `json:"total_expense_ratio"`
+	FundVolumeEur      *float64 `json:"fund_volume_eur"`
+	IsDistributing     *bool    `json:"is_distributing"`
+	ReplicationMethod  *string  `json:"replication_method"`
+	ReleaseDate        *string  `json:"release_date"`
+	FundCurrency       *string  `json:"fund_currency"`
+	FundDomicile       *string  `json:"fund_domicile"`
+	FundProvider       *string  `json:"fund_provider"`
+	HasCurrencyHedging *bool    `json:"has_currency_hedging"`
+	Performance1y      *float64 `json:"performance_1y"` // Cumulative, as a fraction
+	Performance3y      *float64 `json:"performance_3y"`
+	Performance5y      *float64 `json:"performance_5y"`
+}
+
+// EtfListPage is a page of ListEtfs.
+type EtfListPage struct {
+	Items []EtfListItem `json:"items"`
+	Total int           `json:"total"` // Etfs matching the filter, on all pages
+}
+
+const etfListWhere = `
+	WHERE ($1 OR status = 'active')
+		AND ($2::BOOLEAN IS NULL OR isDistributing = $2)
+		AND ($3 = '' OR lower(replicationMethod) = lower($3))
+		AND ($4 = '' OR lower(fund_currency) = lower($4))
+		AND ($5 = '' OR lower(fund_domicile) = lower($5))
+		AND ($6 = '' OR lower(fund_provider) = lower($6))
+		AND ($7::BOOLEAN IS NULL OR has_currency_hedging = $7)
+		AND ($8::NUMERIC IS NULL OR totalExpenseRatio >= $8)
+		AND ($9::NUMERIC IS NULL OR totalExpenseRatio <= $9)`
+
+// ListEtfs returns a page of the etfs matching the filter. Missing and delisted etfs are only included if asked for.
+func (r *PostgresRepository) ListEtfs(ctx context.Context, filter EtfListFilter) (EtfListPage, error) {
+	page := EtfListPage{Items: []EtfListItem{}}
+	if err := filter.validate(); err != nil {
+		return page, err
+	}
+	args := []any{filter.IncludeInactive, filter.IsDistributing, filter.ReplicationMethod, filter.FundCurrency, filter.FundDomicile,
+		filter.FundProvider, filter.HasCurrencyHedging, filter.MinTer, filter.MaxTer}
+
+	where := etfListWhere
+	if filter.Screen != nil {
+		condition, screenArgs := filter.Screen.SQL(len(args) + 1)
+		where += "\n\t\tAND " + condition
+		args = append(args, screenArgs...)
+	}
+
+	if err := r.db.QueryRowContext(ctx, "SELECT count(*) FROM t_etf"+where, args...).Scan(&page.Total); err != nil {
+		return page, wrapError(err, "count etfs")
+	}
+
+	sortColumn := etfListSortColumns[filter.Sort]
+	if sortColumn == "" {
+		sortColumn = etfListSortColumns[EtfSortName]
+	}
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+	// The sort column comes from etfListSortColumns, never from the caller
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, coalesce(name, ''), isin, status, totalExpenseRatio, fund_volume_eur, isDistributing, replicationMethod, releaseDate,
+			fund_currency, fund_domicile, fund_provider, has_currency_hedging, performance_1y, performance_3y, performance_5y
+		FROM t_etf%s
+		ORDER BY %s %s NULLS LAST, id
+		LIMIT $%d OFFSET $%d`, where, sortColumn, direction, len(args)+1, len(args)+2),
+		append(args, sql.NullInt64{Int64: int64(filter.Limit), Valid: filter.Limit > 0}, filter.Offset)...)
+	if err != nil {
+		return page, wrapError(err, "list etfs")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item EtfListItem
+		var releaseDate sql.NullTime
+		err := rows.Scan(&item.Id, &item.Name, &item.ISIN, &item.Status, &item.TotalExpenseRatio, &item.FundVolumeEur, &item.IsDistributing,
+			&item.ReplicationMethod, &releaseDate, &item.FundCurrency, &item.FundDomicile, &item.FundProvider, &item.HasCurrencyHedging,
+			&item.Performance1y, &item.Performance3y, &item.Performance5y)
+		if err != nil {
+			return page, wrapError(err, "list etfs")
+		}
+		if releaseDate.Valid {
+			date := releaseDate.Time.Format(time.DateOnly)
+			item.ReleaseDate = &date
+		}
+		page.Items = append(page.Items, item)
+	}
+	return page, wrapError(rows.Err(), "list etfs")
+}
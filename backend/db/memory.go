@@ -0,0 +1,991 @@
+package db
+
+import (
+	"backend/diff"
+	"backend/parse"
+	"cmp"
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryRepository is an EtfRepository keeping everything in memory, for unit tests.
+// It mirrors the behaviour of PostgresRepository, including snapshots, change events and etf statuses.
+type MemoryRepository struct {
+	mu          sync.Mutex
+	etfs        map[string]*memoryEtf
+	screens     map[string]SavedScreen
+	snapshots   []EtfSnapshot
+	events      []ChangeEvent
+	quarantine  []QuarantinedValue
+	runs        []ScrapeRun // Index is id - 1
+	itemResults []ScrapeItemResult
+	checkpoints map[int64]ListCheckpoint
+	fieldStats  map[int64]map[string]FieldStat
+}
+
+type memoryEtf struct {
+	columns           map[string]any // Columns of t_etf that are part of snapshots, by column name
+	composition       []CompositionEntry
+	scrapeDateDetails time.Time
+	lastSeenAt        time.Time
+	status            string
+	missedRuns        int
+}
+
+// t_etf columns set by UpdateEtfDetails, by the etfDetailsFields key they are set from.
+// The scraped composition columns are missing, like in etf_snapshot_data.
+var etfDetailsColumns = map[string]string{
+	"ISIN":                       "isin",
+	"WKN":                        "wkn",
+	"NrPositions":                "nr_positions",
+	"BaseIndex":                  "base_index",
+	"ShareClassVolume":           "share_class_volume",
+	"ShareClassVolumeEur":        "share_class_volume_eur",
+	"FundDomicile":               "fund_domicile",
+	"FundCurrency":               "fund_currency",
+	"SecuritiesLendingPermitted": "securities_lending_permitted",
+	"TradeCurrency":              "trade_currency",
+	"HasCurrencyHedging":         "has_currency_hedging",
+	"HasSpecialAssets":           "has_special_assets",
+	"FundProvider":               "fund_provider",
+	"LegalStructure":             "legal_structure",
+	"FundStructure":              "fund_structure",
+	"Administrator":              "administrator",
+	"Depotbank":                  "depotbank",
+	"Auditor":                    "auditor",
+	"ActivityDistribution":       "activity_distribution",
+	"HistoricalPerformance":      "historical_performance",
+	"HistoricalVolatility":       "historical_volatility",
+	"HistoricalMaxDrawdown":      "historical_max_drawdown",
+	"HistoricalSharpeRatio":      "historical_sharpe_ratio",
+	"Exchanges":                  "exchanges",
+	"AdditionalAttributes":       "additional_attributes",
+	"WeightTop10":                "weight_top_10",
+	"NrStockPositions":           "nr_stock_positions",
+	"NrBondPositions":            "nr_bond_positions",
+	"NrCashAndOtherPositions":    "nr_cash_and_other_positions",
+}
+
+// Detail columns of type JSON, stored as json.RawMessage so snapshots contain them as objects
+var etfJSONColumns = map[string]bool{
+	"activity_distribution":   true,
+	"historical_performance":  true,
+	"historical_volatility":   true,
+	"historical_max_drawdown": true,
+	"historical_sharpe_ratio": true,
+	"exchanges":               true,
+	"additional_attributes":   true,
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		etfs:        map[string]*memoryEtf{},
+		screens:     map[string]SavedScreen{},
+		checkpoints: map[int64]ListCheckpoint{},
+		fieldStats:  map[int64]map[string]FieldStat{},
+	}
+}
+
+func (r *MemoryRepository) InsertOrUpdateEtf(ctx context.Context, data EtfBaseData) error {
+	_, err := r.UpsertEtfs(ctx, []EtfBaseData{data})
+	return err
+}
+
+func (r *MemoryRepository) UpsertEtfs(ctx context.Context, batch []EtfBaseData) (UpsertResult, error) {
+	var result UpsertResult
+	batch, err := prepareUpsertBatch(batch)
+	if err != nil {
+		return result, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, data := range batch {
+		r.upsertEtf(data, now, &result)
+	}
+	return result, nil
+}
+
+// upsertEtf stores the base data and counts what happened to the etf. The caller must hold r.mu.
+func (r *MemoryRepository) upsertEtf(data EtfBaseData, now time.Time, result *UpsertResult) {
+	etf, ok := r.etfs[data.Id]
+	if !ok {
+		etf = &memoryEtf{columns: map[string]any{}, status: EtfStatusActive}
+		for _, column := range etfDetailsColumns {
+			etf.columns[column] = nil
+		}
+		r.etfs[data.Id] = etf
+	}
+
+	var releaseDate any
+	if !data.ReleaseDate.IsZero() {
+		releaseDate = data.ReleaseDate.Format(time.DateOnly)
+	}
+	changed := etf.status != EtfStatusActive || etf.missedRuns != 0
+	for column, value := range map[string]any{
+		"id":                     data.Id,
+		"name":                   data.Name,
+		"fundvolume":             data.FundVolume,
+		"isdistributing":         data.IsDistributing,
+		"releasedate":            releaseDate,
+		"replicationmethod":      data.ReplicationMethod,
+		"shareclassvolume":       data.ShareClassVolume,
+		"totalexpenseratio":      nullValue(data.TotalExpenseRatio),
+		"fund_volume_eur":        nullValue(data.FundVolumeEur),
+		"share_class_volume_eur": nullValue(data.ShareClassVolumeEur),
+	} {
+		changed = changed || etf.columns[column] != value
+		etf.columns[column] = value
+	}
+	etf.lastSeenAt = now
+	switch {
+	case !ok:
+		result.Inserted++
+	case changed:
+		result.Updated++
+	default:
+		result.Unchanged++
+		return
+	}
+
+	if etf.status == EtfStatusMissing || etf.status == EtfStatusDelisted {
+		r.addEvent(ChangeEvent{EtfId: data.Id, Kind: ChangeKindListed, DetectedAt: now})
+	}
+	etf.status = EtfStatusActive
+	etf.missedRuns = 0
+	r.recordSnapshot(data.Id, now)
+}
+
+func (r *MemoryRepository) UpdateEtfDetails(ctx context.Context, data EtfDetailsData) error {
+	if data.Id == "" {
+		return validationError("etf details without id")
+	}
+	now := time.Now()
+	data, quarantined := checkIdentifiers(data, now)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	etf, ok := r.etfs[data.Id]
+	if !ok {
+		return wrapError(sql.ErrNoRows, "update details of etf %s", data.Id)
+	}
+
+	for otherId, other := range r.etfs {
+		for _, identifier := range []struct {
+			column string
+			value  *string
+		}{{"isin", &data.ISIN}, {"wkn", &data.WKN}} {
+			if otherId != data.Id && *identifier.value != "" && other.columns[identifier.column] == *identifier.value {
+				quarantined = append(quarantined, duplicateIdentifier(data.Id, identifier.column, *identifier.value, otherId, now))
+				*identifier.value = ""
+			}
+		}
+	}
+	for _, value := range quarantined {
+		value.Id = int64(len(r.quarantine) + 1)
+		r.quarantine = append(r.quarantine, value)
+	}
+
+	fields := etfDetailsFields(data)
+	for field, value := range fields {
+		column, ok := etfDetailsColumns[field]
+		if !ok {
+			continue
+		}
+		etf.columns[column] = nullValue(value)
+		if s, ok := etf.columns[column].(string); ok && etfJSONColumns[column] {
+			etf.columns[column] = json.RawMessage(s)
+		}
+	}
+	etf.scrapeDateDetails = now
+
+	// Keys listed twice in a dimension are summed up, like in t_etf_composition
+	etf.composition = []CompositionEntry{}
+	index := map[string]int{}
+	for _, entry := range compositionEntries(data) {
+		key := entry.Dimension + "\x00" + entry.Key
+		if i, ok := index[key]; ok {
+			etf.composition[i].Weight += entry.Weight
+			continue
+		}
+		index[key] = len(etf.composition)
+		etf.composition = append(etf.composition, entry)
+	}
+
+	r.recordSnapshot(data.Id, now)
+	return nil
+}
+
+func (r *MemoryRepository) ResolveEtfSymbol(ctx context.Context, symbol string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.etfs[strings.ToLower(symbol)]; ok {
+		return strings.ToLower(symbol), nil
+	}
+	upper := strings.ToUpper(symbol)
+	matchers := []func(etf *memoryEtf) bool{
+		func(etf *memoryEtf) bool { return etf.columns["isin"] == upper },
+		func(etf *memoryEtf) bool { return etf.columns["wkn"] == upper },
+		func(etf *memoryEtf) bool {
+			exchanges, _ := etf.columns["exchanges"].(json.RawMessage)
+			return slices.Contains(profileTickers(exchanges), upper)
+		},
+	}
+	var ids []string
+	for _, matches := range matchers {
+		for _, id := range sortedKeys(r.etfs) {
+			if matches(r.etfs[id]) {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			break
+		}
+	}
+	return resolvedId(symbol, ids)
+}
+
+func (r *MemoryRepository) GetEtfProfile(ctx context.Context, etfId string) (EtfProfile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	etf, ok := r.etfs[etfId]
+	if !ok {
+		return EtfProfile{}, wrapError(sql.ErrNoRows, "get profile of etf %s", etfId)
+	}
+	content := snapshotContent(etf)
+	content["status"] = etf.status
+	performance, _ := etf.columns["historical_performance"].(json.RawMessage)
+	content["performance_1y"] = etfPerformance(performance, "1 Jahr")
+	content["performance_3y"] = etfPerformance(performance, "3 Jahre")
+	content["performance_5y"] = etfPerformance(performance, "5 Jahre")
+	content["last_seen_at"] = etf.lastSeenAt
+	if !etf.scrapeDateDetails.IsZero() {
+		content["scrape_date_details"] = etf.scrapeDateDetails.Format(time.DateOnly)
+	}
+	data, _ := json.Marshal(content)
+	return decodeProfile(etfId, data)
+}
+
+func (r *MemoryRepository) ListEtfs(ctx context.Context, filter EtfListFilter) (EtfListPage, error) {
+	page := EtfListPage{Items: []EtfListItem{}}
+	if err := filter.validate(); err != nil {
+		return page, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var items []EtfListItem
+	for _, id := range sortedKeys(r.etfs) {
+		etf := r.etfs[id]
+		if item := memoryListItem(id, etf); matchesEtfListFilter(item, filter) && (filter.Screen == nil || filter.Screen.Match(memoryScreenRecord{etf})) {
+			items = append(items, item)
+		}
+	}
+	sortKey := filter.Sort
+	if sortKey == "" {
+		sortKey = EtfSortName
+	}
+	// Stable, so equal values stay ordered by id like in postgres
+	sort.SliceStable(items, func(i, j int) bool {
+		aNumber, aText, aOk := etfListSortValue(items[i], sortKey)
+		bNumber, bText, bOk := etfListSortValue(items[j], sortKey)
+		if !aOk || !bOk {
+			return aOk && !bOk // Nulls last
+		}
+		order := cmp.Or(cmp.Compare(aNumber, bNumber), strings.Compare(aText, bText))
+		if filter.Descending {
+			return order > 0
+		}
+		return order < 0
+	})
+
+	page.Total = len(items)
+	start := min(filter.Offset, len(items))
+	end := len(items)
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, end)
+	}
+	page.Items = append(page.Items, items[start:end]...)
+	return page, nil
+}
+
+func memoryListItem(id string, etf *memoryEtf) EtfListItem {
+	name, _ := etf.columns["name"].(string)
+	performance, _ := etf.columns["historical_performance"].(json.RawMessage)
+	return EtfListItem{
+		Id:                 id,
+		Name:               name,
+		ISIN:               columnValue[string](etf, "isin"),
+		Status:             etf.status,
+		TotalExpenseRatio:  columnValue[float64](etf, "totalexpenseratio"),
+		FundVolumeEur:      columnValue[float64](etf, "fund_volume_eur"),
+		IsDistributing:     columnValue[bool](etf, "isdistributing"),
+		ReplicationMethod:  columnValue[string](etf, "replicationmethod"),
+		ReleaseDate:        columnValue[string](etf, "releasedate"),
+		FundCurrency:       columnValue[string](etf, "fund_currency"),
+		FundDomicile:       columnValue[string](etf, "fund_domicile"),
+		FundProvider:       columnValue[string](etf, "fund_provider"),
+		HasCurrencyHedging: columnValue[bool](etf, "has_currency_hedging"),
+		Performance1y:      etfPerformance(performance, "1 Jahr"),
+		Performance3y:      etfPerformance(performance, "3 Jahre"),
+		Performance5y:      etfPerformance(performance, "5 Jahre"),
+	}
+}
+
+// columnValue returns a pointer to the value of a column, nil if it is null.
+func columnValue[T any](etf *memoryEtf, column string) *T {
+	if value, ok := etf.columns[column].(T); ok {
+		return &value
+	}
+	return nil
+}
+
+// etfPerformance mirrors the sql function etf_performance.
+func etfPerformance(historicalPerformance json.RawMessage, timespan string) *float64 {
+	var performances []struct {
+		Timespan    string `json:"timespan"`
+		Performance string `json:"performance"`
+	}
+	json.Unmarshal(historicalPerformance, &performances) // Anything but a list has no performance
+	for _, p := range performances {
+		if p.Timespan != timespan {
+			continue
+		}
+		if value, err := parse.Percent(p.Performance); err == nil && value.Valid {
+			return &value.Float64
+		}
+		return nil
+	}
+	return nil
+}
+
+func matchesEtfListFilter(item EtfListItem, filter EtfListFilter) bool {
+	equalFold := func(value *string, want string) bool {
+		return want == "" || (value != nil && strings.EqualFold(*value, want))
+	}
+	equalBool := func(value *bool, want *bool) bool {
+		return want == nil || (value != nil && *value == *want)
+	}
+	return (filter.IncludeInactive || item.Status == EtfStatusActive) &&
+		equalBool(item.IsDistributing, filter.IsDistributing) &&
+		equalFold(item.ReplicationMethod, filter.ReplicationMethod) &&
+		equalFold(item.FundCurrency, filter.FundCurrency) &&
+		equalFold(item.FundDomicile, filter.FundDomicile) &&
+		equalFold(item.FundProvider, filter.FundProvider) &&
+		equalBool(item.HasCurrencyHedging, filter.HasCurrencyHedging) &&
+		(filter.MinTer == nil || (item.TotalExpenseRatio != nil && *item.TotalExpenseRatio >= *filter.MinTer)) &&
+		(filter.MaxTer == nil || (item.TotalExpenseRatio != nil && *item.TotalExpenseRatio <= *filter.MaxTer))
+}
+
+// SearchEtfs is a rough stand-in for PostgresRepository.SearchEtfs. Instead of ts_rank, words score by the weight of the
+// best field containing them, and nothing matches fuzzily, so typos find nothing.
+func (r *MemoryRepository) SearchEtfs(ctx context.Context, search EtfSearch) ([]SearchHit, error) {
+	terms, identifier, err := search.prepare()
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hits := []SearchHit{}
+	for _, id := range sortedKeys(r.etfs) {
+		etf := r.etfs[id]
+		if etf.status != EtfStatusActive && !search.IncludeInactive {
+			continue
+		}
+		name, _ := etf.columns["name"].(string)
+		exchanges, _ := etf.columns["exchanges"].(json.RawMessage)
+		hit := SearchHit{
+			Id:           id,
+			Name:         name,
+			ISIN:         columnValue[string](etf, "isin"),
+			WKN:          columnValue[string](etf, "wkn"),
+			BaseIndex:    columnValue[string](etf, "base_index"),
+			FundProvider: columnValue[string](etf, "fund_provider"),
+			Tickers:      append([]string{}, profileTickers(exchanges)...),
+			Status:       etf.status,
+		}
+		slices.Sort(hit.Tickers)
+
+		identifierScore := searchIdentifierScore(hit, identifier, search.Prefix)
+		wordsScore, wordsMatch := searchWordsScore(hit, terms, search.Prefix)
+		if identifierScore == 0 && !wordsMatch {
+			continue
+		}
+		hit.Score = identifierScore + wordsScore
+		hits = append(hits, hit)
+	}
+	// Stable, so equal scores and names stay ordered by id
+	sort.SliceStable(hits, func(i, j int) bool {
+		return cmp.Or(cmp.Compare(hits[j].Score, hits[i].Score), strings.Compare(strings.ToLower(hits[i].Name), strings.ToLower(hits[j].Name))) < 0
+	})
+	if search.Limit > 0 && len(hits) > search.Limit {
+		hits = hits[:search.Limit]
+	}
+	return hits, nil
+}
+
+func searchIdentifierScore(hit SearchHit, identifier string, prefix bool) float64 {
+	if identifier == "" {
+		return 0
+	}
+	identifiers := slices.Clone(hit.Tickers)
+	for _, value := range []*string{hit.ISIN, hit.WKN} {
+		if value != nil {
+			identifiers = append(identifiers, *value)
+		}
+	}
+	if hit.Id == strings.ToLower(identifier) || slices.Contains(identifiers, identifier) {
+		return searchScoreIdentifier
+	}
+	if prefix && len(identifier) >= 3 && slices.ContainsFunc(identifiers, func(value string) bool { return strings.HasPrefix(value, identifier) }) {
+		return searchScoreIdentifierPrefix
+	}
+	return 0
+}
+
+// searchWordsScore stands in for ts_rank: 0.1 times the average weight of the best field containing each term,
+// with the name weighing 1, the base index 0.4 and the fund provider 0.2 like the default weights of ts_rank.
+// It returns false if a term is in no field.
+func searchWordsScore(hit SearchHit, terms []string, prefix bool) (float64, bool) {
+	fields := []struct {
+		value  *string
+		weight float64
+	}{{&hit.Name, 1}, {hit.BaseIndex, 0.4}, {hit.FundProvider, 0.2}}
+	total := 0.0
+	for _, term := range terms {
+		best := 0.0
+		for _, field := range fields {
+			if field.value == nil {
+				continue
+			}
+			matches := slices.ContainsFunc(searchTerms(*field.value), func(word string) bool {
+				return word == term || (prefix && strings.HasPrefix(word, term))
+			})
+			if matches {
+				best = max(best, field.weight)
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		total += best
+	}
+	return 0.1 * total / float64(len(terms)), true
+}
+
+// memoryScreenRecord provides the columns and composition of an etf to screener queries.
+type memoryScreenRecord struct {
+	etf *memoryEtf
+}
+
+func (r memoryScreenRecord) Value(column string) any {
+	performance, _ := r.etf.columns["historical_performance"].(json.RawMessage)
+	timespans := map[string]string{"performance_1y": "1 Jahr", "performance_3y": "3 Jahre", "performance_5y": "5 Jahre"}
+	switch {
+	case column == "status":
+		return r.etf.status
+	case timespans[column] != "":
+		if value := etfPerformance(performance, timespans[column]); value != nil {
+			return *value
+		}
+		return nil
+	}
+	return r.etf.columns[column]
+}
+
+func (r memoryScreenRecord) Weight(dimension string, key string) float64 {
+	for _, entry := range r.etf.composition {
+		if entry.Dimension == dimension && entry.Key == key {
+			return entry.Weight
+		}
+	}
+	return 0
+}
+
+// etfListSortValue returns the value of the sort key, either as number or as text, and false if it is null.
+func etfListSortValue(item EtfListItem, sortKey string) (float64, string, bool) {
+	number := func(value *float64) (float64, string, bool) {
+		if value == nil {
+			return 0, "", false
+		}
+		return *value, "", true
+	}
+	switch sortKey {
+	case EtfSortTer:
+		return number(item.TotalExpenseRatio)
+	case EtfSortVolume:
+		return number(item.FundVolumeEur)
+	case EtfSortPerformance1y:
+		return number(item.Performance1y)
+	case EtfSortPerformance3y:
+		return number(item.Performance3y)
+	case EtfSortPerformance5y:
+		return number(item.Performance5y)
+	case EtfSortReleaseDate:
+		if item.ReleaseDate == nil {
+			return 0, "", false
+		}
+		return 0, *item.ReleaseDate, true
+	default:
+		// Lower cased and byte by byte, which agrees with the collation of the database for names of letters, digits and spaces
+		return 0, strings.ToLower(item.Name), item.Name != ""
+	}
+}
+
+func (r *MemoryRepository) GetQuarantinedValues(ctx context.Context, etfId string) ([]QuarantinedValue, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values := []QuarantinedValue{}
+	for _, value := range r.quarantine {
+		if etfId == "" || value.EtfId == etfId {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+func (r *MemoryRepository) SaveScreen(ctx context.Context, screen SavedScreen) (SavedScreen, error) {
+	if err := screen.validate(); err != nil {
+		return screen, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	screen.UpdatedAt = time.Now()
+	screen.CreatedAt = screen.UpdatedAt
+	if existing, ok := r.screens[screen.Name]; ok {
+		screen.CreatedAt = existing.CreatedAt
+	}
+	r.screens[screen.Name] = screen
+	return screen, nil
+}
+
+func (r *MemoryRepository) GetSavedScreen(ctx context.Context, name string) (SavedScreen, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	screen, ok := r.screens[name]
+	if !ok {
+		return screen, wrapError(sql.ErrNoRows, "get screen %s", name)
+	}
+	return screen, nil
+}
+
+func (r *MemoryRepository) ListSavedScreens(ctx context.Context) ([]SavedScreen, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	screens := []SavedScreen{}
+	for _, name := range sortedKeys(r.screens) {
+		screens = append(screens, r.screens[name])
+	}
+	// Stable, so names equal but for case stay ordered byte by byte
+	sort.SliceStable(screens, func(i, j int) bool {
+		return strings.ToLower(screens[i].Name) < strings.ToLower(screens[j].Name)
+	})
+	return screens, nil
+}
+
+func (r *MemoryRepository) DeleteSavedScreen(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.screens[name]; !ok {
+		return wrapError(sql.ErrNoRows, "delete screen %s", name)
+	}
+	delete(r.screens, name)
+	return nil
+}
+
+func (r *MemoryRepository) GetAllIds(ctx context.Context) ([]string, error) {
+	return r.ids(func(etf *memoryEtf) bool { return etf.status == EtfStatusActive }), nil
+}
+
+func (r *MemoryRepository) GetAllIdsWhereNoDetails(ctx context.Context) ([]string, error) {
+	return r.ids(func(etf *memoryEtf) bool {
+		return etf.status == EtfStatusActive && etf.scrapeDateDetails.IsZero()
+	}), nil
+}
+
+func (r *MemoryRepository) ids(include func(etf *memoryEtf) bool) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := []string{}
+	for _, id := range sortedKeys(r.etfs) {
+		if include(r.etfs[id]) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (r *MemoryRepository) ReconcileListRun(ctx context.Context, runStartedAt time.Time, delistAfterMisses int) (ListRunReconciliation, error) {
+	if delistAfterMisses < 1 {
+		return ListRunReconciliation{}, validationError("delistAfterMisses must be at least 1, got %d", delistAfterMisses)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var reconciliation ListRunReconciliation
+	now := time.Now()
+
+	for _, id := range sortedKeys(r.etfs) {
+		etf := r.etfs[id]
+		if etf.status == EtfStatusDelisted || !etf.lastSeenAt.Before(runStartedAt) {
+			continue
+		}
+		etf.missedRuns++
+		etf.status = EtfStatusMissing
+		if etf.missedRuns >= delistAfterMisses {
+			etf.status = EtfStatusDelisted
+		}
+
+		reconciliation.Missing++
+		if etf.missedRuns == 1 {
+			r.addEvent(ChangeEvent{EtfId: id, Kind: ChangeKindVanished, DetectedAt: now})
+		}
+		if etf.status == EtfStatusDelisted {
+			reconciliation.Delisted++
+			r.addEvent(ChangeEvent{EtfId: id, Kind: ChangeKindDelisted, DetectedAt: now})
+		}
+	}
+	return reconciliation, nil
+}
+
+// EtfStatus returns the status of an etf, for assertions in tests.
+func (r *MemoryRepository) EtfStatus(etfId string) (status string, missedRuns int, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	etf, ok := r.etfs[etfId]
+	if !ok {
+		return "", 0, false
+	}
+	return etf.status, etf.missedRuns, true
+}
+
+// snapshotContent mirrors the sql function etf_snapshot_data.
+func snapshotContent(etf *memoryEtf) map[string]any {
+	content := map[string]any{}
+	for column, value := range etf.columns {
+		content[column] = value
+	}
+	composition := append([]CompositionEntry{}, etf.composition...)
+	sort.Slice(composition, func(i, j int) bool {
+		if composition[i].Dimension != composition[j].Dimension {
+			return composition[i].Dimension < composition[j].Dimension
+		}
+		return composition[i].Key < composition[j].Key
+	})
+	entries := []map[string]any{}
+	for _, entry := range composition {
+		entries = append(entries, map[string]any{"dimension": entry.Dimension, "key": entry.Key, "weight": entry.Weight})
+	}
+	content["composition"] = entries
+	return content
+}
+
+// recordSnapshot mirrors recordEtfSnapshot. The caller must hold r.mu.
+func (r *MemoryRepository) recordSnapshot(etfId string, now time.Time) {
+	data, _ := json.Marshal(snapshotContent(r.etfs[etfId])) // Map keys are sorted, so equal content has the same hash
+	sum := md5.Sum(data)
+	hash := hex.EncodeToString(sum[:])
+
+	var previous *EtfSnapshot
+	for i := len(r.snapshots) - 1; i >= 0; i-- {
+		if r.snapshots[i].EtfId == etfId {
+			previous = &r.snapshots[i]
+			break
+		}
+	}
+	if previous != nil && previous.ContentHash == hash {
+		return
+	}
+	r.snapshots = append(r.snapshots, EtfSnapshot{Id: int64(len(r.snapshots) + 1), EtfId: etfId, TakenAt: now, ContentHash: hash, Data: data})
+
+	if previous == nil {
+		r.addEvent(ChangeEvent{EtfId: etfId, Kind: ChangeKindListed, DetectedAt: now})
+		return
+	}
+	changes, _ := diff.Snapshots(previous.Data, data)
+	for _, change := range changes {
+		event := ChangeEvent{EtfId: etfId, Kind: ChangeKindChanged, Field: change.Field, DetectedAt: now}
+		if change.Old != nil {
+			event.OldValue, _ = json.Marshal(change.Old)
+		}
+		if change.New != nil {
+			event.NewValue, _ = json.Marshal(change.New)
+		}
+		r.addEvent(event)
+	}
+}
+
+// addEvent stores a change event. The caller must hold r.mu.
+func (r *MemoryRepository) addEvent(event ChangeEvent) {
+	event.Id = int64(len(r.events) + 1)
+	r.events = append(r.events, event)
+}
+
+func (r *MemoryRepository) GetEtfAsOf(ctx context.Context, etfId string, at time.Time) (EtfSnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.snapshots) - 1; i >= 0; i-- {
+		if r.snapshots[i].EtfId == etfId && !r.snapshots[i].TakenAt.After(at) {
+			return r.snapshots[i], nil
+		}
+	}
+	return EtfSnapshot{}, wrapError(sql.ErrNoRows, "get snapshot of etf %s as of %s", etfId, at.Format(time.RFC3339))
+}
+
+func (r *MemoryRepository) GetEtfTimeSeries(ctx context.Context, etfId string, field string, from time.Time, to time.Time) ([]TimeSeriesPoint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	points := []TimeSeriesPoint{}
+	for _, snapshot := range r.snapshots {
+		if snapshot.EtfId != etfId || snapshot.TakenAt.Before(from) || snapshot.TakenAt.After(to) {
+			continue
+		}
+		var content map[string]any
+		if err := json.Unmarshal(snapshot.Data, &content); err != nil {
+			return nil, err
+		}
+		point := TimeSeriesPoint{TakenAt: snapshot.TakenAt}
+		if value, ok := content[field].(float64); ok {
+			point.Value = sql.NullFloat64{Float64: value, Valid: true}
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+func (r *MemoryRepository) GetChangeEvents(ctx context.Context, filter ChangeEventFilter) ([]ChangeEvent, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := []ChangeEvent{}
+	for _, event := range r.events {
+		switch {
+		case filter.EtfId != "" && event.EtfId != filter.EtfId,
+			filter.Kind != "" && event.Kind != filter.Kind,
+			filter.Field != "" && event.Field != filter.Field && !strings.HasPrefix(event.Field, filter.Field+"."),
+			event.DetectedAt.Before(filter.Since),
+			event.Id <= filter.AfterId:
+			continue
+		}
+		events = append(events, event)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+func (r *MemoryRepository) StartScrapeRun(ctx context.Context, kind string, itemsTotal int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run := ScrapeRun{Id: int64(len(r.runs) + 1), Kind: kind, StartedAt: time.Now(), Status: ScrapeRunStatusRunning, ItemsTotal: itemsTotal}
+	r.runs = append(r.runs, run)
+	return run.Id, nil
+}
+
+func (r *MemoryRepository) UpdateScrapeRunTotal(ctx context.Context, runId int64, itemsTotal int) error {
+	return r.updateRun(runId, func(run *ScrapeRun) { run.ItemsTotal = itemsTotal })
+}
+
+func (r *MemoryRepository) FinishScrapeRun(ctx context.Context, runId int64, status string, statusReason string, succeeded int, skipped int, failed int) error {
+	return r.updateRun(runId, func(run *ScrapeRun) {
+		run.FinishedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		run.Status = status
+		run.StatusReason = statusReason
+		run.ItemsSucceeded = succeeded
+		run.ItemsSkipped = skipped
+		run.ItemsFailed = failed
+	})
+}
+
+func (r *MemoryRepository) ResumeScrapeRun(ctx context.Context, runId int64) error {
+	return r.updateRun(runId, func(run *ScrapeRun) {
+		run.Status = ScrapeRunStatusRunning
+		run.FinishedAt = sql.NullTime{}
+	})
+}
+
+func (r *MemoryRepository) AddScrapeRunUpsertCounts(ctx context.Context, runId int64, counts UpsertResult) error {
+	return r.updateRun(runId, func(run *ScrapeRun) { run.Upserted.Add(counts) })
+}
+
+// updateRun applies update to a run. Unknown runs are ignored, like an UPDATE matching no row.
+func (r *MemoryRepository) updateRun(runId int64, update func(run *ScrapeRun)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if runId >= 1 && runId <= int64(len(r.runs)) {
+		update(&r.runs[runId-1])
+	}
+	return nil
+}
+
+func (r *MemoryRepository) GetScrapeRun(ctx context.Context, runId int64) (ScrapeRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if runId < 1 || runId > int64(len(r.runs)) {
+		return ScrapeRun{}, wrapError(sql.ErrNoRows, "get scrape run %d", runId)
+	}
+	return r.runs[runId-1], nil
+}
+
+func (r *MemoryRepository) GetLatestScrapeRun(ctx context.Context, kind string) (ScrapeRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.latestRun(kind)
+	if !ok {
+		return ScrapeRun{}, wrapError(sql.ErrNoRows, "get latest %s scrape run", kind)
+	}
+	return run, nil
+}
+
+// latestRun returns the most recently started run of the kind. The caller must hold r.mu.
+func (r *MemoryRepository) latestRun(kind string) (ScrapeRun, bool) {
+	for i := len(r.runs) - 1; i >= 0; i-- {
+		if r.runs[i].Kind == kind {
+			return r.runs[i], true
+		}
+	}
+	return ScrapeRun{}, false
+}
+
+func (r *MemoryRepository) InsertScrapeItemResult(ctx context.Context, runId int64, itemId string, status string, errorMessage string, duration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.itemResults = append(r.itemResults, ScrapeItemResult{
+		RunId: runId, ItemId: itemId, Status: status, ErrorMessage: errorMessage, Duration: duration, CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (r *MemoryRepository) GetScrapeItemResults(ctx context.Context, runId int64, status string) ([]ScrapeItemResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := []ScrapeItemResult{}
+	for _, result := range r.itemResults {
+		if result.RunId == runId && (status == "" || result.Status == status) {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func (r *MemoryRepository) CountScrapeItemResults(ctx context.Context, runId int64) (succeeded int, skipped int, failed int, err error) {
+	results, _ := r.GetScrapeItemResults(ctx, runId, "")
+	for _, result := range results {
+		switch result.Status {
+		case ScrapeItemStatusSucceeded:
+			succeeded++
+		case ScrapeItemStatusSkipped:
+			skipped++
+		case ScrapeItemStatusFailed:
+			failed++
+		}
+	}
+	return
+}
+
+func (r *MemoryRepository) SaveListCheckpoint(ctx context.Context, checkpoint ListCheckpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	checkpoint.UpdatedAt = time.Now()
+	r.checkpoints[checkpoint.RunId] = checkpoint
+	return nil
+}
+
+func (r *MemoryRepository) GetResumableListRun(ctx context.Context) (ScrapeRun, ListCheckpoint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.latestRun(ScrapeRunKindList)
+	checkpoint, hasCheckpoint := r.checkpoints[run.Id]
+	if !ok || !hasCheckpoint || (run.Status != ScrapeRunStatusRunning && run.Status != ScrapeRunStatusFailed) {
+		return ScrapeRun{}, ListCheckpoint{}, wrapError(sql.ErrNoRows, "get resumable list run")
+	}
+	return run, checkpoint, nil
+}
+
+func (r *MemoryRepository) SaveScrapeRunFieldStats(ctx context.Context, runId int64, stats []FieldStat) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fieldStats[runId] == nil {
+		r.fieldStats[runId] = map[string]FieldStat{}
+	}
+	for _, stat := range stats {
+		saved := r.fieldStats[runId][stat.Field]
+		saved.Field = stat.Field
+		saved.Filled += stat.Filled
+		saved.Total += stat.Total
+		r.fieldStats[runId][stat.Field] = saved
+	}
+	return nil
+}
+
+func (r *MemoryRepository) GetFieldFillRateBaseline(ctx context.Context, kind string, runs int, excludeRunId int64) (map[string]float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	used := 0
+	for i := len(r.runs) - 1; i >= 0 && used < runs; i-- {
+		run := r.runs[i]
+		if run.Kind != kind || run.Status != ScrapeRunStatusCompleted || run.Id == excludeRunId {
+			continue
+		}
+		used++
+		for field, stat := range r.fieldStats[run.Id] {
+			if stat.Total > 0 {
+				sums[field] += float64(stat.Filled) / float64(stat.Total)
+				counts[field]++
+			}
+		}
+	}
+
+	baseline := map[string]float64{}
+	for field, sum := range sums {
+		baseline[field] = sum / float64(counts[field])
+	}
+	return baseline, nil
+}
+
+// nullValue returns the value of a sql.NullXXX, or nil if it is not valid. Other values are returned as is.
+func nullValue(value any) any {
+	switch v := value.(type) {
+	case sql.NullString:
+		if v.Valid {
+			return v.String
+		}
+	case sql.NullInt64:
+		if v.Valid {
+			return v.Int64
+		}
+	case sql.NullFloat64:
+		if v.Valid {
+			return v.Float64
+		}
+	case sql.NullBool:
+		if v.Valid {
+			return v.Bool
+		}
+	default:
+		return value
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,304 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEtf(id string, ter float64) EtfBaseData {
+	return EtfBaseData{
+		Id:                id,
+		Name:              "Fund " + id,
+		FundVolume:        "1,00 Mrd. €",
+		ReleaseDate:       time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC),
+		TotalExpenseRatio: sql.NullFloat64{Float64: ter, Valid: true},
+		FundVolumeEur:     sql.NullFloat64{Float64: 1e9, Valid: true},
+	}
+}
+
+func eventKinds(events []ChangeEvent) []string {
+	kinds := []string{}
+	for _, event := range events {
+		kinds = append(kinds, event.Kind+":"+event.Field)
+	}
+	return kinds
+}
+
+func TestMemoryRepositoryChangeEvents(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	repo.InsertOrUpdateEtf(ctx, testEtf("a", 0.002))
+	repo.InsertOrUpdateEtf(ctx, testEtf("a", 0.002))
+	repo.InsertOrUpdateEtf(ctx, testEtf("a", 0.0012))
+
+	events, err := repo.GetChangeEvents(ctx, ChangeEventFilter{EtfId: "a"})
+	if err != nil {
+		t.Fatalf("GetChangeEvents: %v", err)
+	}
+	if got := eventKinds(events); len(got) != 2 || got[0] != "listed:" || got[1] != "changed:totalexpenseratio" {
+		t.Fatalf("events = %v, want listed and a ter change", got)
+	}
+	if string(events[1].OldValue) != "0.002" || string(events[1].NewValue) != "0.0012" {
+		t.Errorf("ter change = %s -> %s, want 0.002 -> 0.0012", events[1].OldValue, events[1].NewValue)
+	}
+
+	series, err := repo.GetEtfTimeSeries(ctx, "a", "totalexpenseratio", time.Time{}, time.Now())
+	if err != nil {
+		t.Fatalf("GetEtfTimeSeries: %v", err)
+	}
+	if len(series) != 2 || series[0].Value.Float64 != 0.002 || series[1].Value.Float64 != 0.0012 {
+		t.Errorf("series = %v, want one point per distinct snapshot", series)
+	}
+}
+
+func TestMemoryRepositoryDetails(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	repo.InsertOrUpdateEtf(ctx, testEtf("a", 0.002))
+
+	var details EtfDetailsData
+	err := json.Unmarshal([]byte(`{
+		"isin": "IE00B4L5Y983",
+		"nr_positions": "1.513",
+		"country_composition": [{"country": "USA", "percentile": "71,89 %"}, {"country": "Japan", "percentile": "—"}]
+	}`), &details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	details.Id = "a"
+	if err := repo.UpdateEtfDetails(ctx, details); err != nil {
+		t.Fatalf("UpdateEtfDetails: %v", err)
+	}
+
+	ids, _ := repo.GetAllIdsWhereNoDetails(ctx)
+	if len(ids) != 0 {
+		t.Errorf("GetAllIdsWhereNoDetails = %v, want none", ids)
+	}
+	events, _ := repo.GetChangeEvents(ctx, ChangeEventFilter{Field: "composition"})
+	if len(events) != 1 || events[0].Field != "composition.country.USA" || string(events[0].NewValue) != "0.7189" {
+		t.Errorf("composition events = %+v, want USA with 0.7189", events)
+	}
+	events, _ = repo.GetChangeEvents(ctx, ChangeEventFilter{Field: "nr_positions"})
+	if len(events) != 1 || string(events[0].NewValue) != "1513" {
+		t.Errorf("nr_positions events = %+v, want 1513", events)
+	}
+
+	if err := repo.UpdateEtfDetails(ctx, EtfDetailsData{Id: "unknown"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("details of an unknown etf: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryRepositoryReconcileListRun(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	repo.InsertOrUpdateEtf(ctx, testEtf("gone", 0.002))
+
+	for run := 1; run <= 3; run++ {
+		time.Sleep(time.Millisecond)
+		runStart := time.Now()
+		repo.InsertOrUpdateEtf(ctx, testEtf("kept", 0.002))
+		reconciliation, err := repo.ReconcileListRun(ctx, runStart, 2)
+		if err != nil {
+			t.Fatalf("ReconcileListRun: %v", err)
+		}
+		if run <= 2 && reconciliation.Missing != 1 {
+			t.Errorf("run %d: Missing = %d, want 1", run, reconciliation.Missing)
+		}
+		if run == 3 && reconciliation.Missing != 0 {
+			t.Errorf("delisted etfs must not be counted again, got %d missing", reconciliation.Missing)
+		}
+		// Missing etfs are not current anymore, although they may come back
+		if ids, _ := repo.GetAllIdsWhereNoDetails(ctx); len(ids) != 1 || ids[0] != "kept" {
+			t.Errorf("run %d: GetAllIdsWhereNoDetails = %v, want only kept", run, ids)
+		}
+	}
+
+	if status, missed, _ := repo.EtfStatus("gone"); status != EtfStatusDelisted || missed != 2 {
+		t.Errorf("status = %s after %d misses, want delisted after 2", status, missed)
+	}
+	if status, _, _ := repo.EtfStatus("kept"); status != EtfStatusActive {
+		t.Errorf("status of kept = %s, want active", status)
+	}
+	if ids, _ := repo.GetAllIds(ctx); len(ids) != 1 || ids[0] != "kept" {
+		t.Errorf("GetAllIds = %v, want only kept", ids)
+	}
+
+	repo.InsertOrUpdateEtf(ctx, testEtf("gone", 0.002))
+	events, _ := repo.GetChangeEvents(ctx, ChangeEventFilter{EtfId: "gone"})
+	if got := eventKinds(events); len(got) != 4 || got[1] != "vanished:" || got[2] != "delisted:" || got[3] != "listed:" {
+		t.Errorf("events = %v, want listed, vanished, delisted, listed", got)
+	}
+}
+
+func TestMemoryRepositoryScrapeRuns(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	for i := 0; i < 2; i++ {
+		runId, _ := repo.StartScrapeRun(ctx, ScrapeRunKindList, 10)
+		repo.SaveScrapeRunFieldStats(ctx, runId, []FieldStat{{Field: "name", Filled: 9 - i, Total: 10}})
+		repo.FinishScrapeRun(ctx, runId, ScrapeRunStatusCompleted, "", 10, 0, 0)
+	}
+
+	runId, _ := repo.StartScrapeRun(ctx, ScrapeRunKindList, 10)
+	repo.InsertScrapeItemResult(ctx, runId, "page-1", ScrapeItemStatusSucceeded, "", time.Second)
+	repo.InsertScrapeItemResult(ctx, runId, "page-2", ScrapeItemStatusFailed, "timeout", time.Second)
+	repo.SaveListCheckpoint(ctx, ListCheckpoint{RunId: runId, TotalResults: 1000, TotalPages: 10, LastCompletedPage: 2})
+
+	run, checkpoint, err := repo.GetResumableListRun(ctx)
+	if err != nil || run.Id != runId || checkpoint.LastCompletedPage != 2 {
+		t.Errorf("GetResumableListRun = %+v, %+v, %v, want run %d after page 2", run, checkpoint, err, runId)
+	}
+	if succeeded, skipped, failed, _ := repo.CountScrapeItemResults(ctx, runId); succeeded != 1 || skipped != 0 || failed != 1 {
+		t.Errorf("counts = %d/%d/%d, want 1/0/1", succeeded, skipped, failed)
+	}
+	repo.AddScrapeRunUpsertCounts(ctx, runId, UpsertResult{Inserted: 1, Unchanged: 99})
+	repo.AddScrapeRunUpsertCounts(ctx, runId, UpsertResult{Updated: 2, Unchanged: 98})
+	if run, _ := repo.GetScrapeRun(ctx, runId); run.Upserted != (UpsertResult{Inserted: 1, Updated: 2, Unchanged: 197}) {
+		t.Errorf("Upserted = %+v, want the sum of both pages", run.Upserted)
+	}
+	baseline, _ := repo.GetFieldFillRateBaseline(ctx, ScrapeRunKindList, 5, runId)
+	if rate := baseline["name"]; rate < 0.849 || rate > 0.851 {
+		t.Errorf("baseline of name = %v, want 0.85", rate)
+	}
+
+	repo.FinishScrapeRun(ctx, runId, ScrapeRunStatusCompleted, "", 1, 0, 1)
+	if _, _, err := repo.GetResumableListRun(ctx); !errors.Is(err, ErrNotFound) || !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("completed run must not be resumable, got %v", err)
+	}
+}
+
+func TestMemoryRepositoryErrors(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	if err := repo.InsertOrUpdateEtf(ctx, EtfBaseData{Id: "a"}); !errors.Is(err, ErrValidation) {
+		t.Errorf("etf without name: got %v, want ErrValidation", err)
+	}
+	if _, err := repo.GetChangeEvents(ctx, ChangeEventFilter{Kind: "renamed"}); !errors.Is(err, ErrValidation) {
+		t.Errorf("unknown change kind: got %v, want ErrValidation", err)
+	}
+	if _, err := repo.GetEtfAsOf(ctx, "a", time.Now()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("snapshot of an unknown etf: got %v, want ErrNotFound", err)
+	}
+	if _, err := repo.ReconcileListRun(ctx, time.Now(), 0); !errors.Is(err, ErrValidation) {
+		t.Errorf("delisting after 0 misses: got %v, want ErrValidation", err)
+	}
+}
+
+func TestMemoryRepositoryUpsertEtfs(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	repo.InsertOrUpdateEtf(ctx, testEtf("a", 0.002))
+
+	repo.InsertOrUpdateEtf(ctx, testEtf("c", 0.002))
+
+	result, err := repo.UpsertEtfs(ctx, []EtfBaseData{testEtf("a", 0.002), testEtf("b", 0.002), testEtf("b", 0.0012), testEtf("c", 0.003)})
+	if err != nil {
+		t.Fatalf("UpsertEtfs: %v", err)
+	}
+	if want := (UpsertResult{Inserted: 1, Updated: 1, Unchanged: 1}); result != want {
+		t.Errorf("result = %+v, want b inserted once, c updated and a unchanged", result)
+	}
+	if events, _ := repo.GetChangeEvents(ctx, ChangeEventFilter{EtfId: "a"}); len(events) != 1 {
+		t.Errorf("events of a = %v, want only listed", eventKinds(events))
+	}
+	series, _ := repo.GetEtfTimeSeries(ctx, "b", "totalexpenseratio", time.Time{}, time.Now())
+	if len(series) != 1 || series[0].Value.Float64 != 0.0012 {
+		t.Errorf("series of b = %v, want only the last row", series)
+	}
+
+	_, err = repo.UpsertEtfs(ctx, []EtfBaseData{testEtf("d", 0.002), {Id: "e"}})
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("batch with an invalid etf: got %v, want ErrValidation", err)
+	}
+	if ids, _ := repo.GetAllIds(ctx); len(ids) != 3 {
+		t.Errorf("GetAllIds = %v, want nothing of the invalid batch", ids)
+	}
+}
+
+func TestMemoryRepositoryQuarantine(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	repo.InsertOrUpdateEtf(ctx, testEtf("a", 0.002))
+	repo.InsertOrUpdateEtf(ctx, testEtf("b", 0.002))
+
+	if err := repo.UpdateEtfDetails(ctx, EtfDetailsData{Id: "a", ISIN: "ie00b4l5y983", WKN: "A0RPWI"}); err != nil {
+		t.Fatalf("UpdateEtfDetails: %v", err)
+	}
+	if err := repo.UpdateEtfDetails(ctx, EtfDetailsData{Id: "b", ISIN: "IE00B4L5Y983", WKN: "—"}); err != nil {
+		t.Fatalf("UpdateEtfDetails: %v", err)
+	}
+
+	values, _ := repo.GetQuarantinedValues(ctx, "")
+	if len(values) != 2 || values[0].EtfId != "a" || values[0].Field != "wkn" || values[1].EtfId != "b" || values[1].Reason != "already used by etf a" {
+		t.Fatalf("quarantined = %+v, want the wkn of a and the duplicate isin of b", values)
+	}
+	snapshot, _ := repo.GetEtfAsOf(ctx, "a", time.Now())
+	if !strings.Contains(string(snapshot.Data), `"isin":"IE00B4L5Y983"`) || !strings.Contains(string(snapshot.Data), `"wkn":null`) {
+		t.Errorf("snapshot of a = %s, want the normalized isin and no wkn", snapshot.Data)
+	}
+}
+
+func TestMemoryRepositorySearchEtfs(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	for _, etf := range []struct{ id, name, details string }{
+		{"ie00bfy0gt14", "SPDR MSCI World UCITS ETF", `{"base_index": "MSCI World", "fund_provider": "SPDR"}`},
+		{"ie00b4l5y983", "iShares Core MSCI World UCITS ETF", `{"isin": "IE00B4L5Y983", "wkn": "A0RPWH", "base_index": "MSCI World", "fund_provider": "iShares", "exchanges": [{"ticker": "EUNL"}, {"ticker": "IWDA"}]}`},
+		{"ie00bk5bqt80", "Vanguard FTSE All-World UCITS ETF", `{"isin": "IE00BK5BQT80", "wkn": "A2PKXG", "base_index": "FTSE All-World", "fund_provider": "Vanguard", "exchanges": [{"ticker": "VWCE"}]}`},
+		{"lu0274208692", "Xtrackers MSCI World Swap UCITS ETF", `{"isin": "LU0274208692", "base_index": "MSCI World", "fund_provider": "Xtrackers"}`},
+	} {
+		if etf.id == "ie00b4l5y983" {
+			time.Sleep(time.Millisecond)
+		}
+		repo.InsertOrUpdateEtf(ctx, EtfBaseData{Id: etf.id, Name: etf.name})
+		var details EtfDetailsData
+		if err := json.Unmarshal([]byte(etf.details), &details); err != nil {
+			t.Fatal(err)
+		}
+		details.Id = etf.id
+		repo.UpdateEtfDetails(ctx, details)
+	}
+	spdr := repo.etfs["ie00bfy0gt14"]
+	repo.ReconcileListRun(ctx, spdr.lastSeenAt.Add(time.Nanosecond), 1) // Delists the spdr etf
+
+	search := func(search EtfSearch) []string {
+		hits, err := repo.SearchEtfs(ctx, search)
+		if err != nil {
+			t.Fatalf("SearchEtfs(%+v): %v", search, err)
+		}
+		ids := []string{}
+		for _, hit := range hits {
+			ids = append(ids, hit.Id)
+		}
+		return ids
+	}
+	// Ties are ordered by name, ignoring case
+	for query, want := range map[EtfSearch]string{
+		{Text: "msci world"}:                          "ie00b4l5y983,lu0274208692",
+		{Text: "msci world", IncludeInactive: true}:   "ie00b4l5y983,ie00bfy0gt14,lu0274208692",
+		{Text: "msci world", Limit: 1}:                "ie00b4l5y983",
+		{Text: "swap msci world"}:                     "lu0274208692",
+		{Text: "a0rpwh"}:                              "ie00b4l5y983",
+		{Text: "vwce"}:                                "ie00bk5bqt80",
+		{Text: "IE00BK5BQT80"}:                        "ie00bk5bqt80",
+		{Text: "ie00bfy0gt14", IncludeInactive: true}: "ie00bfy0gt14",
+		{Text: "xtrack", Prefix: true}:                "lu0274208692",
+		{Text: "ie00b", Prefix: true}:                 "ie00b4l5y983,ie00bk5bqt80",
+		{Text: "iwd", Prefix: true}:                   "ie00b4l5y983",
+		{Text: "iw", Prefix: true}:                    "", // Too short for identifier prefixes
+	} {
+		if got := strings.Join(search(query), ","); got != want {
+			t.Errorf("SearchEtfs(%+v) = %s, want %s", query, got, want)
+		}
+	}
+
+	if _, err := repo.SearchEtfs(ctx, EtfSearch{Text: " - "}); !errors.Is(err, ErrValidation) {
+		t.Errorf("SearchEtfs without words: err = %v, want ErrValidation", err)
+	}
+}
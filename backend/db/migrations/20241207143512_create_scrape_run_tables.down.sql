@@ -0,0 +1,4 @@
+-- Migration Down
+
+DROP TABLE IF EXISTS t_scrape_item_result;
+DROP TABLE IF EXISTS t_scrape_run;
@@ -0,0 +1,26 @@
+-- Migration Up
+
+CREATE TABLE IF NOT EXISTS t_scrape_run (
+  id SERIAL not null primary key,
+  kind VARCHAR(20) not null,
+  started_at TIMESTAMPTZ not null,
+  finished_at TIMESTAMPTZ,
+  status VARCHAR(20) not null,
+  items_total INT not null default 0,
+  items_succeeded INT not null default 0,
+  items_skipped INT not null default 0,
+  items_failed INT not null default 0
+);
+
+CREATE TABLE IF NOT EXISTS t_scrape_item_result (
+  id SERIAL not null primary key,
+  run_id INT not null references t_scrape_run(id) on delete cascade,
+  item_id VARCHAR(20) not null,
+  status VARCHAR(20) not null,
+  error_message TEXT,
+  duration_ms INT,
+  created_at TIMESTAMPTZ not null default now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_scrape_run_kind_started_at ON t_scrape_run (kind, started_at);
+CREATE INDEX IF NOT EXISTS idx_scrape_item_result_run_id_status ON t_scrape_item_result (run_id, status);
@@ -0,0 +1,9 @@
+-- Migration Up
+
+CREATE TABLE IF NOT EXISTS t_scrape_list_checkpoint (
+  run_id INT not null primary key references t_scrape_run(id) on delete cascade,
+  total_results INT not null,
+  total_pages INT not null,
+  last_completed_page INT not null default 0,
+  updated_at TIMESTAMPTZ not null default now()
+);
@@ -0,0 +1,4 @@
+-- Migration Down
+
+ALTER TABLE IF EXISTS t_etf
+DROP COLUMN IF EXISTS additional_attributes
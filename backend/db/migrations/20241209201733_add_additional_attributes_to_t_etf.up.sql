@@ -0,0 +1,4 @@
+-- Migration Up
+
+ALTER TABLE IF EXISTS t_etf
+ADD additional_attributes JSONB
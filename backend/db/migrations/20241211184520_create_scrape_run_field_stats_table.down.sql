@@ -0,0 +1,6 @@
+-- Migration Down
+
+DROP TABLE IF EXISTS t_scrape_run_field_stats;
+
+ALTER TABLE IF EXISTS t_scrape_run
+DROP COLUMN IF EXISTS status_reason;
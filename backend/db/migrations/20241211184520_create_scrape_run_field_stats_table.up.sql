@@ -0,0 +1,12 @@
+-- Migration Up
+
+ALTER TABLE IF EXISTS t_scrape_run
+ADD status_reason TEXT;
+
+CREATE TABLE IF NOT EXISTS t_scrape_run_field_stats (
+  run_id INT not null references t_scrape_run(id) on delete cascade,
+  field VARCHAR(50) not null,
+  filled INT not null,
+  total INT not null,
+  primary key (run_id, field)
+);
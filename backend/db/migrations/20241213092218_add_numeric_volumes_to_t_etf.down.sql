@@ -0,0 +1,7 @@
+-- Migration Down
+
+ALTER TABLE IF EXISTS t_etf
+DROP COLUMN IF EXISTS fund_volume_eur,
+DROP COLUMN IF EXISTS share_class_volume_eur;
+
+DROP FUNCTION IF EXISTS parse_german_number(TEXT);
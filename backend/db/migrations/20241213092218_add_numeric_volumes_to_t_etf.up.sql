@@ -0,0 +1,42 @@
+-- Migration Up
+
+-- Parses german formatted numbers like '1.234,56', '0,07 %' or '1,23 Mrd. €'.
+-- Magnitude suffixes (Tsd., Mio., Mrd., Bio.) are applied, currencies and a trailing percent sign ignored,
+-- like parse.Volume and parse.Percent do. The number itself must be formatted as parse.Number expects, so
+-- '1.23' or '1.2345,6' are NULL like empty values, '—' and anything else unparseable.
+CREATE OR REPLACE FUNCTION parse_german_number(value TEXT) RETURNS NUMERIC AS $$
+DECLARE
+  cleaned TEXT := btrim(translate(value, chr(160) || chr(8239) || chr(8722), '  -'));
+  factor NUMERIC := 1;
+BEGIN
+  IF cleaned IS NULL OR cleaned IN ('', '—', '–', '-') THEN
+    RETURN NULL;
+  END IF;
+
+  IF cleaned ~* '\mTsd\M' THEN factor := 1e3;
+  ELSIF cleaned ~* '\mMio\M' THEN factor := 1e6;
+  ELSIF cleaned ~* '\mMrd\M' THEN factor := 1e9;
+  ELSIF cleaned ~* '\mBio\M' THEN factor := 1e12;
+  END IF;
+
+  cleaned := regexp_replace(cleaned, '\m(Tsd|Mio|Mrd|Bio)\M\.?', '', 'gi');
+  cleaned := regexp_replace(cleaned, '(€|\$|£|¥|EUR|USD|GBP|CHF|JPY|Fr\.)', '', 'gi');
+  cleaned := btrim(regexp_replace(btrim(cleaned), '%$', ''));
+  IF cleaned !~ '^[+-]?([0-9]{1,3}(\.[0-9]{3})+|[0-9]+)(,[0-9]+)?$' THEN
+    RETURN NULL;
+  END IF;
+  RETURN replace(replace(cleaned, '.', ''), ',', '.')::NUMERIC * factor;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+ALTER TABLE IF EXISTS t_etf
+ADD fund_volume_eur NUMERIC,
+ADD share_class_volume_eur NUMERIC;
+
+-- Like parse.Amount.InBaseCurrency, volumes without currency are in EUR.
+-- Volumes in other currencies stay NULL, as no exchange rates are known
+UPDATE t_etf SET
+  fund_volume_eur = CASE WHEN fundVolume !~* '(\$|£|¥|USD|GBP|CHF|JPY|Fr\.)' THEN parse_german_number(fundVolume) END,
+  share_class_volume_eur = coalesce(
+    CASE WHEN shareClassVolume !~* '(\$|£|¥|USD|GBP|CHF|JPY|Fr\.)' THEN parse_german_number(shareClassVolume) END,
+    CASE WHEN share_class_volume !~* '(\$|£|¥|USD|GBP|CHF|JPY|Fr\.)' THEN parse_german_number(share_class_volume) END);
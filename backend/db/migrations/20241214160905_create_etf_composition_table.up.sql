@@ -0,0 +1,42 @@
+-- Migration Up
+
+CREATE TABLE IF NOT EXISTS t_etf_composition (
+  etf_id VARCHAR(20) not null references t_etf(id) on delete cascade,
+  dimension VARCHAR(20) not null,
+  key TEXT not null,
+  weight NUMERIC not null,
+  scrape_date DATE,
+  primary key (etf_id, dimension, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_etf_composition_dimension_key ON t_etf_composition (dimension, key, weight);
+
+-- Backfill from the json columns, which hold percentage strings like '71,89 %'.
+-- The json columns are kept as scraped, entries without a key or a parseable weight stay only there.
+WITH entries AS (
+  SELECT e.id AS etf_id, 'country' AS dimension, c->>'country' AS key, parse_german_number(c->>'percentile') / 100 AS weight, e.scrape_date_details AS scrape_date
+  FROM t_etf e, json_array_elements(e.country_composition) c
+  WHERE json_typeof(e.country_composition) = 'array'
+  UNION ALL
+  SELECT e.id, 'region', c->>'country', parse_german_number(c->>'percentile') / 100, e.scrape_date_details
+  FROM t_etf e, json_array_elements(e.region_composition) c
+  WHERE json_typeof(e.region_composition) = 'array'
+  UNION ALL
+  SELECT e.id, 'currency', c->>'country', parse_german_number(c->>'percentile') / 100, e.scrape_date_details
+  FROM t_etf e, json_array_elements(e.currency_distribution) c
+  WHERE json_typeof(e.currency_distribution) = 'array'
+  UNION ALL
+  SELECT e.id, 'holding', c->>'name', parse_german_number(c->>'percentile') / 100, e.scrape_date_details
+  FROM t_etf e, json_array_elements(e.top_10_holdings) c
+  WHERE json_typeof(e.top_10_holdings) = 'array'
+  UNION ALL
+  SELECT e.id, 'industry', c->>'name', parse_german_number(c->>'percentile') / 100, e.scrape_date_details
+  FROM t_etf e, json_array_elements(e.industry_distribution) c
+  WHERE json_typeof(e.industry_distribution) = 'array'
+)
+INSERT INTO t_etf_composition (etf_id, dimension, key, weight, scrape_date)
+SELECT etf_id, dimension, key, sum(weight), max(scrape_date)
+FROM entries
+WHERE key IS NOT NULL AND key <> '' AND weight IS NOT NULL
+GROUP BY etf_id, dimension, key
+ON CONFLICT (etf_id, dimension, key) DO NOTHING;
@@ -0,0 +1,5 @@
+-- Migration Down
+
+DROP TABLE IF EXISTS t_etf_snapshot;
+
+DROP FUNCTION IF EXISTS etf_snapshot_data(VARCHAR);
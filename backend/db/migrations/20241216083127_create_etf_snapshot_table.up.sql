@@ -0,0 +1,33 @@
+-- Migration Up
+
+-- Content of an etf snapshot: the t_etf row without volatile columns, plus its composition.
+-- The scraped composition columns are left out, changes to them show up in the parsed composition.
+-- Replace this function when adding volatile columns to t_etf, so they don't create new snapshots.
+CREATE OR REPLACE FUNCTION etf_snapshot_data(etf_id VARCHAR) RETURNS JSONB AS $$
+  SELECT (to_jsonb(e) - 'scrape_date_base_data' - 'scrape_date_details'
+      - 'country_composition' - 'region_composition' - 'currency_distribution' - 'top_10_holdings' - 'industry_distribution')
+    || jsonb_build_object('composition', coalesce((
+      SELECT jsonb_agg(jsonb_build_object('dimension', c.dimension, 'key', c.key, 'weight', c.weight) ORDER BY c.dimension, c.key)
+      FROM t_etf_composition c
+      WHERE c.etf_id = e.id), '[]'::JSONB))
+  FROM t_etf e
+  WHERE e.id = etf_snapshot_data.etf_id
+$$ LANGUAGE sql STABLE;
+
+CREATE TABLE IF NOT EXISTS t_etf_snapshot (
+  id BIGSERIAL primary key,
+  etf_id VARCHAR(20) not null references t_etf(id) on delete cascade,
+  taken_at TIMESTAMPTZ not null,
+  content_hash CHAR(32) not null,
+  data JSONB not null
+);
+
+CREATE INDEX IF NOT EXISTS idx_etf_snapshot_etf_taken_at ON t_etf_snapshot (etf_id, taken_at);
+
+-- Start the history of existing etfs with their current state
+INSERT INTO t_etf_snapshot (etf_id, taken_at, content_hash, data)
+SELECT s.id, s.taken_at, md5(s.data::TEXT), s.data
+FROM (
+  SELECT id, coalesce(greatest(scrape_date_base_data, scrape_date_details)::TIMESTAMPTZ, now()) AS taken_at, etf_snapshot_data(id) AS data
+  FROM t_etf
+) s;
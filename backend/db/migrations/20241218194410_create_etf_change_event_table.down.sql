@@ -0,0 +1,3 @@
+-- Migration Down
+
+DROP TABLE IF EXISTS t_etf_change_event;
@@ -0,0 +1,14 @@
+-- Migration Up
+
+CREATE TABLE IF NOT EXISTS t_etf_change_event (
+  id BIGSERIAL primary key,
+  etf_id VARCHAR(20) not null references t_etf(id) on delete cascade,
+  kind VARCHAR(20) not null,
+  field TEXT,
+  old_value JSONB,
+  new_value JSONB,
+  detected_at TIMESTAMPTZ not null
+);
+
+CREATE INDEX IF NOT EXISTS idx_etf_change_event_etf ON t_etf_change_event (etf_id, id);
+CREATE INDEX IF NOT EXISTS idx_etf_change_event_detected_at ON t_etf_change_event (detected_at);
@@ -0,0 +1,19 @@
+-- Migration Down
+
+CREATE OR REPLACE FUNCTION etf_snapshot_data(etf_id VARCHAR) RETURNS JSONB AS $$
+  SELECT (to_jsonb(e) - 'scrape_date_base_data' - 'scrape_date_details'
+      - 'country_composition' - 'region_composition' - 'currency_distribution' - 'top_10_holdings' - 'industry_distribution')
+    || jsonb_build_object('composition', coalesce((
+      SELECT jsonb_agg(jsonb_build_object('dimension', c.dimension, 'key', c.key, 'weight', c.weight) ORDER BY c.dimension, c.key)
+      FROM t_etf_composition c
+      WHERE c.etf_id = e.id), '[]'::JSONB))
+  FROM t_etf e
+  WHERE e.id = etf_snapshot_data.etf_id
+$$ LANGUAGE sql STABLE;
+
+DROP INDEX IF EXISTS idx_etf_status;
+
+ALTER TABLE IF EXISTS t_etf
+DROP COLUMN IF EXISTS last_seen_at,
+DROP COLUMN IF EXISTS status,
+DROP COLUMN IF EXISTS missed_runs;
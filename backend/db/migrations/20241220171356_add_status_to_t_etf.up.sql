@@ -0,0 +1,22 @@
+-- Migration Up
+
+ALTER TABLE IF EXISTS t_etf
+ADD last_seen_at TIMESTAMPTZ,
+ADD status VARCHAR(20) not null default 'active',
+ADD missed_runs INT not null default 0;
+
+UPDATE t_etf SET last_seen_at = scrape_date_base_data::TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_etf_status ON t_etf (status);
+
+-- The status columns are tracked by list runs and change events, not by snapshots
+CREATE OR REPLACE FUNCTION etf_snapshot_data(etf_id VARCHAR) RETURNS JSONB AS $$
+  SELECT (to_jsonb(e) - 'scrape_date_base_data' - 'scrape_date_details' - 'last_seen_at' - 'status' - 'missed_runs'
+      - 'country_composition' - 'region_composition' - 'currency_distribution' - 'top_10_holdings' - 'industry_distribution')
+    || jsonb_build_object('composition', coalesce((
+      SELECT jsonb_agg(jsonb_build_object('dimension', c.dimension, 'key', c.key, 'weight', c.weight) ORDER BY c.dimension, c.key)
+      FROM t_etf_composition c
+      WHERE c.etf_id = e.id), '[]'::JSONB))
+  FROM t_etf e
+  WHERE e.id = etf_snapshot_data.etf_id
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,6 @@
+-- Migration Down
+
+ALTER TABLE IF EXISTS t_scrape_run
+DROP COLUMN IF EXISTS rows_inserted,
+DROP COLUMN IF EXISTS rows_updated,
+DROP COLUMN IF EXISTS rows_unchanged;
@@ -0,0 +1,6 @@
+-- Migration Up
+
+ALTER TABLE IF EXISTS t_scrape_run
+ADD rows_inserted INT not null default 0,
+ADD rows_updated INT not null default 0,
+ADD rows_unchanged INT not null default 0;
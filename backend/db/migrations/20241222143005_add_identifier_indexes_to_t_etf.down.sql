@@ -0,0 +1,8 @@
+-- Migration Down
+
+DROP INDEX IF EXISTS idx_etf_wkn;
+DROP INDEX IF EXISTS idx_etf_isin;
+DROP FUNCTION IF EXISTS isin_check_digit(TEXT);
+
+-- Quarantined values are not restored to t_etf, they get scraped again
+DROP TABLE IF EXISTS t_etf_quarantine;
@@ -0,0 +1,84 @@
+-- Migration Up
+
+CREATE TABLE IF NOT EXISTS t_etf_quarantine (
+  id SERIAL not null primary key,
+  etf_id VARCHAR(20) not null references t_etf(id) on delete cascade,
+  field VARCHAR(50) not null,
+  value TEXT not null,
+  reason TEXT not null,
+  detected_at TIMESTAMPTZ not null default now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_etf_quarantine_etf_id ON t_etf_quarantine (etf_id);
+
+-- Normalize the stored identifiers like validate.ISIN and validate.WKN do
+UPDATE t_etf SET
+  isin = nullif(upper(trim(isin)), ''),
+  wkn = nullif(upper(trim(wkn)), '')
+WHERE isin IS NOT NULL OR wkn IS NOT NULL;
+
+UPDATE t_etf SET isin = NULL WHERE isin IN ('—', '–', '-');
+UPDATE t_etf SET wkn = NULL WHERE wkn IN ('—', '–', '-');
+
+-- Quarantine values validate.ISIN and validate.WKN reject, first those of the wrong format
+WITH invalid AS (
+  SELECT id, isin FROM t_etf WHERE isin !~ '^[A-Z]{2}[A-Z0-9]{9}[0-9]$'
+), cleared AS (
+  UPDATE t_etf SET isin = NULL FROM invalid WHERE t_etf.id = invalid.id RETURNING invalid.id, invalid.isin
+)
+INSERT INTO t_etf_quarantine (etf_id, field, value, reason)
+SELECT id, 'isin', isin, 'invalid isin format' FROM cleared;
+
+-- Check digit of the first 11 characters of an isin, computed like validate.ISIN does:
+-- Luhn over the characters with letters expanded to numbers (A=10 ... Z=35)
+CREATE OR REPLACE FUNCTION isin_check_digit(payload TEXT) RETURNS TEXT AS $$
+  WITH expanded AS (
+    SELECT string_agg(CASE WHEN c ~ '^[0-9]$' THEN c ELSE (ascii(c) - 55)::TEXT END, '' ORDER BY i) AS digits
+    FROM unnest(string_to_array(payload, NULL)) WITH ORDINALITY AS chars(c, i)
+  ), luhn AS (
+    -- Every second digit is doubled, starting with the rightmost one as the check digit is appended to it
+    SELECT CASE WHEN (length(digits) - i) % 2 = 0 THEN substr(digits, i, 1)::INT * 2 ELSE substr(digits, i, 1)::INT END AS d
+    FROM expanded, generate_series(1, length(digits)) AS i
+  )
+  SELECT ((10 - sum(d / 10 + d % 10) % 10) % 10)::TEXT FROM luhn
+$$ LANGUAGE sql IMMUTABLE;
+
+WITH invalid AS (
+  SELECT id, isin FROM t_etf WHERE right(isin, 1) <> isin_check_digit(left(isin, 11))
+), cleared AS (
+  UPDATE t_etf SET isin = NULL FROM invalid WHERE t_etf.id = invalid.id RETURNING invalid.id, invalid.isin
+)
+INSERT INTO t_etf_quarantine (etf_id, field, value, reason)
+SELECT id, 'isin', isin, 'invalid isin check digit' FROM cleared;
+
+WITH invalid AS (
+  SELECT id, wkn FROM t_etf WHERE wkn !~ '^[0-9A-HJ-NP-Z]{6}$'
+), cleared AS (
+  UPDATE t_etf SET wkn = NULL FROM invalid WHERE t_etf.id = invalid.id RETURNING invalid.id, invalid.wkn
+)
+INSERT INTO t_etf_quarantine (etf_id, field, value, reason)
+SELECT id, 'wkn', wkn, 'invalid wkn format' FROM cleared;
+
+-- An identifier used by several etfs stays with the one whose details were scraped last
+WITH ranked AS (
+  SELECT id, isin, first_value(id) OVER w AS owner, row_number() OVER w AS n
+  FROM t_etf WHERE isin IS NOT NULL
+  WINDOW w AS (PARTITION BY isin ORDER BY scrape_date_details DESC NULLS LAST, id)
+), cleared AS (
+  UPDATE t_etf SET isin = NULL FROM ranked WHERE t_etf.id = ranked.id AND ranked.n > 1 RETURNING ranked.id, ranked.isin, ranked.owner
+)
+INSERT INTO t_etf_quarantine (etf_id, field, value, reason)
+SELECT id, 'isin', isin, 'already used by etf ' || owner FROM cleared;
+
+WITH ranked AS (
+  SELECT id, wkn, first_value(id) OVER w AS owner, row_number() OVER w AS n
+  FROM t_etf WHERE wkn IS NOT NULL
+  WINDOW w AS (PARTITION BY wkn ORDER BY scrape_date_details DESC NULLS LAST, id)
+), cleared AS (
+  UPDATE t_etf SET wkn = NULL FROM ranked WHERE t_etf.id = ranked.id AND ranked.n > 1 RETURNING ranked.id, ranked.wkn, ranked.owner
+)
+INSERT INTO t_etf_quarantine (etf_id, field, value, reason)
+SELECT id, 'wkn', wkn, 'already used by etf ' || owner FROM cleared;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_etf_isin ON t_etf (isin);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_etf_wkn ON t_etf (wkn);
@@ -0,0 +1,22 @@
+-- Migration Down
+
+CREATE OR REPLACE FUNCTION etf_snapshot_data(etf_id VARCHAR) RETURNS JSONB AS $$
+  SELECT (to_jsonb(e) - 'scrape_date_base_data' - 'scrape_date_details' - 'last_seen_at' - 'status' - 'missed_runs'
+      - 'country_composition' - 'region_composition' - 'currency_distribution' - 'top_10_holdings' - 'industry_distribution')
+    || jsonb_build_object('composition', coalesce((
+      SELECT jsonb_agg(jsonb_build_object('dimension', c.dimension, 'key', c.key, 'weight', c.weight) ORDER BY c.dimension, c.key)
+      FROM t_etf_composition c
+      WHERE c.etf_id = e.id), '[]'::JSONB))
+  FROM t_etf e
+  WHERE e.id = etf_snapshot_data.etf_id
+$$ LANGUAGE sql STABLE;
+
+DROP INDEX IF EXISTS idx_etf_fund_volume_eur;
+DROP INDEX IF EXISTS idx_etf_total_expense_ratio;
+
+ALTER TABLE IF EXISTS t_etf
+DROP COLUMN IF EXISTS performance_1y,
+DROP COLUMN IF EXISTS performance_3y,
+DROP COLUMN IF EXISTS performance_5y;
+
+DROP FUNCTION IF EXISTS etf_performance(JSON, TEXT);
@@ -0,0 +1,31 @@
+-- Migration Up
+
+-- Cumulative performance of a timespan like '1 Jahr' from the historical_performance column, as a fraction
+CREATE OR REPLACE FUNCTION etf_performance(performance JSON, timespan TEXT) RETURNS NUMERIC AS $$
+  SELECT parse_german_number(p->>'performance') / 100
+  FROM json_array_elements(CASE WHEN json_typeof(performance) = 'array' THEN performance ELSE '[]'::JSON END) p
+  WHERE p->>'timespan' = timespan
+  LIMIT 1
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Numeric copies to sort and filter by
+ALTER TABLE IF EXISTS t_etf
+ADD performance_1y NUMERIC GENERATED ALWAYS AS (etf_performance(historical_performance, '1 Jahr')) STORED,
+ADD performance_3y NUMERIC GENERATED ALWAYS AS (etf_performance(historical_performance, '3 Jahre')) STORED,
+ADD performance_5y NUMERIC GENERATED ALWAYS AS (etf_performance(historical_performance, '5 Jahre')) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_etf_total_expense_ratio ON t_etf (totalExpenseRatio);
+CREATE INDEX IF NOT EXISTS idx_etf_fund_volume_eur ON t_etf (fund_volume_eur);
+
+-- The generated columns are already part of snapshots as historical_performance
+CREATE OR REPLACE FUNCTION etf_snapshot_data(etf_id VARCHAR) RETURNS JSONB AS $$
+  SELECT (to_jsonb(e) - 'scrape_date_base_data' - 'scrape_date_details' - 'last_seen_at' - 'status' - 'missed_runs'
+      - 'performance_1y' - 'performance_3y' - 'performance_5y'
+      - 'country_composition' - 'region_composition' - 'currency_distribution' - 'top_10_holdings' - 'industry_distribution')
+    || jsonb_build_object('composition', coalesce((
+      SELECT jsonb_agg(jsonb_build_object('dimension', c.dimension, 'key', c.key, 'weight', c.weight) ORDER BY c.dimension, c.key)
+      FROM t_etf_composition c
+      WHERE c.etf_id = e.id), '[]'::JSONB))
+  FROM t_etf e
+  WHERE e.id = etf_snapshot_data.etf_id
+$$ LANGUAGE sql STABLE;
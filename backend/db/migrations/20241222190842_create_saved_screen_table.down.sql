@@ -0,0 +1,3 @@
+-- Migration Down
+
+DROP TABLE IF EXISTS t_saved_screen;
@@ -0,0 +1,9 @@
+-- Migration Up
+
+CREATE TABLE IF NOT EXISTS t_saved_screen (
+  name VARCHAR(100) not null primary key,
+  query TEXT not null,
+  description TEXT not null default '',
+  created_at TIMESTAMPTZ not null default now(),
+  updated_at TIMESTAMPTZ not null default now()
+);
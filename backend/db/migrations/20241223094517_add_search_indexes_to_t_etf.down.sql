@@ -0,0 +1,14 @@
+-- Migration Down
+
+DROP INDEX IF EXISTS idx_etf_wkn_pattern;
+DROP INDEX IF EXISTS idx_etf_isin_pattern;
+DROP INDEX IF EXISTS idx_etf_tickers_trgm;
+DROP INDEX IF EXISTS idx_etf_fund_provider_trgm;
+DROP INDEX IF EXISTS idx_etf_base_index_trgm;
+DROP INDEX IF EXISTS idx_etf_name_trgm;
+DROP INDEX IF EXISTS idx_etf_search_vector;
+
+DROP FUNCTION IF EXISTS etf_tickers(JSON);
+DROP FUNCTION IF EXISTS etf_search_vector(TEXT, TEXT, TEXT);
+
+-- pg_trgm is left installed, other database objects may use it
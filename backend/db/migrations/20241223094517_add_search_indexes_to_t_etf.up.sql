@@ -0,0 +1,29 @@
+-- Migration Up
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Words of the searchable texts, weighted by where they appear. The 'simple' config neither stems nor drops
+-- stop words, so names like "iShares Core MSCI World" are matched word by word and by prefix
+CREATE OR REPLACE FUNCTION etf_search_vector(name TEXT, base_index TEXT, fund_provider TEXT) RETURNS TSVECTOR AS $$
+  SELECT setweight(to_tsvector('simple', coalesce(name, '')), 'A')
+    || setweight(to_tsvector('simple', coalesce(base_index, '')), 'B')
+    || setweight(to_tsvector('simple', coalesce(fund_provider, '')), 'C')
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Exchange tickers from the exchanges column, upper case and separated by spaces
+CREATE OR REPLACE FUNCTION etf_tickers(exchanges JSON) RETURNS TEXT AS $$
+  SELECT coalesce(string_agg(upper(x->>'ticker'), ' ' ORDER BY upper(x->>'ticker')), '')
+  FROM json_array_elements(CASE WHEN json_typeof(exchanges) = 'array' THEN exchanges ELSE '[]'::JSON END) x
+  WHERE coalesce(x->>'ticker', '') <> ''
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Queries have to use the same expressions to use the indexes
+CREATE INDEX IF NOT EXISTS idx_etf_search_vector ON t_etf USING GIN (etf_search_vector(name, base_index, fund_provider));
+CREATE INDEX IF NOT EXISTS idx_etf_name_trgm ON t_etf USING GIN (lower(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_etf_base_index_trgm ON t_etf USING GIN (lower(base_index) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_etf_fund_provider_trgm ON t_etf USING GIN (lower(fund_provider) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_etf_tickers_trgm ON t_etf USING GIN (etf_tickers(exchanges) gin_trgm_ops);
+
+-- Prefix matches of identifiers, e.g. isin LIKE 'IE00B4%'
+CREATE INDEX IF NOT EXISTS idx_etf_isin_pattern ON t_etf (isin text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_etf_wkn_pattern ON t_etf (wkn text_pattern_ops);
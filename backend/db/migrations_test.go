@@ -0,0 +1,102 @@
+package db
+
+import (
+	"backend/parse"
+	"backend/validate"
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+)
+
+// The sql function parse_german_number backfills what package parse computes for new scrapes, so both must agree.
+func TestParseGermanNumberMatchesParse(t *testing.T) {
+	type parser func(string) (sql.NullFloat64, error)
+	number := parse.Number
+	percent := func(s string) (sql.NullFloat64, error) {
+		value, err := parse.Percent(s)
+		value.Float64 *= 100 // parse_german_number ignores the percent sign
+		return value, err
+	}
+	volume := func(s string) (sql.NullFloat64, error) {
+		amount, err := parse.Volume(s)
+		return sql.NullFloat64{Float64: amount.Value, Valid: amount.Valid}, err
+	}
+
+	tests := []struct {
+		in    string
+		parse parser
+		want  float64
+		valid bool // false for null and invalid values
+	}{
+		{"1.234,56", number, 1234.56, true},
+		{"1234,5", number, 1234.5, true},
+		{" -0,5 ", number, -0.5, true},
+		{"−0,5", number, -0.5, true},
+		{"1.234.567", number, 1234567, true},
+		{"—", number, 0, false},
+		{"", number, 0, false},
+		{"1.23", number, 0, false},
+		{"1,2,3", number, 0, false},
+		{"1.2345,6", number, 0, false},
+		{"abc", number, 0, false},
+		{"71,89 %", percent, 71.89, true},
+		{"+26,54 %", percent, 26.54, true},
+		{"12,5%", percent, 12.5, true},
+		{"1,23 Mrd. €", volume, 1.23e9, true},
+		{"845,12 Mio. EUR", volume, 845.12e6, true},
+		{"$ 12.345", volume, 12345, true},
+		{"12,5€", volume, 12.5, true},
+		{"1.23 Mio. €", volume, 0, false},
+		{"1,2 3,4 Mio.", volume, 0, false},
+	}
+	for _, test := range tests {
+		got, err := test.parse(test.in)
+		if valid := err == nil && got.Valid; valid != test.valid || (valid && !almostEqual(got.Float64, test.want)) {
+			t.Errorf("package parse: %q = %v, %v, want %v (valid %v)", test.in, got, err, test.want, test.valid)
+		}
+	}
+
+	repo := newTestPostgres(t)
+	for _, test := range tests {
+		got := queryFloat(t, repo, `SELECT parse_german_number($1)`, test.in)
+		if got.Valid != test.valid || (got.Valid && !almostEqual(got.Float64, test.want)) {
+			t.Errorf("parse_german_number(%q) = %v, want %v (valid %v)", test.in, got, test.want, test.valid)
+		}
+	}
+}
+
+// The migration adding the identifier indexes quarantines stored isins validate.ISIN rejects for their check digit.
+func TestIsinCheckDigitMatchesValidate(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{"IE00B4L5Y98", "3"},
+		{"IE00BK5BQT8", "0"},
+		{"US037833100", "5"},
+		{"DE000514000", "8"},
+		{"LU027420869", "2"},
+		{"IE00BFY0GT1", "4"},
+	}
+	for _, test := range tests {
+		if _, err := validate.ISIN(test.payload + test.want); err != nil {
+			t.Errorf("validate.ISIN: %v", err)
+		}
+	}
+
+	repo := newTestPostgres(t)
+	for _, test := range tests {
+		var got string
+		if err := repo.db.QueryRowContext(context.Background(), `SELECT isin_check_digit($1)`, test.payload).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("isin_check_digit(%q) = %s, want %s", test.payload, got, test.want)
+		}
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9*math.Max(1, math.Abs(b))
+}
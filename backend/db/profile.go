@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// EtfProfile is the stored record of an etf with typed values and its parsed compositions.
+// Fields are named after their t_etf columns in snake_case, e.g. total_expense_ratio for the column totalexpenseratio,
+// which snapshots and change events keep as it is. Empty columns are null.
+type EtfProfile struct {
+	Id                         string             `json:"id"`
+	Name                       string             `json:"name"`
+	ISIN                       *string            `json:"isin"`
+	WKN                        *string            `json:"wkn"`
+	Status                     string             `json:"status"`
+	FundVolume                 *string            `json:"fund_volume"` // As displayed
+	FundVolumeEur              *float64           `json:"fund_volume_eur"`
+	ShareClassVolume           *string            `json:"share_class_volume"` // As displayed in the search results
+	ShareClassVolumeEur        *float64           `json:"share_class_volume_eur"`
+	IsDistributing             *bool              `json:"is_distributing"`
+	ReleaseDate                *string            `json:"release_date"` // YYYY-MM-DD
+	ReplicationMethod          *string            `json:"replication_method"`
+	TotalExpenseRatio          *float64           `json:"total_expense_ratio"` // Fraction, e.g. 0.002 for 0,20 %
+	NrPositions                *int64             `json:"nr_positions"`
+	BaseIndex                  *string            `json:"base_index"`
+	FundDomicile               *string            `json:"fund_domicile"`
+	FundCurrency               *string            `json:"fund_currency"`
+	TradeCurrency              *string            `json:"trade_currency"`
+	SecuritiesLendingPermitted *bool              `json:"securities_lending_permitted"`
+	HasCurrencyHedging         *bool              `json:"has_currency_hedging"`
+	HasSpecialAssets           *bool              `json:"has_special_assets"`
+	FundProvider               *string            `json:"fund_provider"`
+	LegalStructure             *string            `json:"legal_structure"`
+	FundStructure              *string            `json:"fund_structure"`
+	Administrator              *string            `json:"administrator"`
+	Depotbank                  *string            `json:"depotbank"`
+	Auditor                    *string            `json:"auditor"`
+	WeightTop10                *float64           `json:"weight_top_10"` // Fraction
+	NrStockPositions           *int64             `json:"nr_stock_positions"`
+	NrBondPositions            *int64             `json:"nr_bond_positions"`
+	NrCashAndOtherPositions    *int64             `json:"nr_cash_and_other_positions"`
+	Composition                []CompositionEntry `json:"composition"` // Sorted by dimension and key
+	ActivityDistribution       json.RawMessage    `json:"activity_distribution"`
+	HistoricalPerformance      json.RawMessage    `json:"historical_performance"`
+	Performance1y              *float64           `json:"performance_1y"` // Cumulative, as a fraction. Parsed from historical_performance
+	Performance3y              *float64           `json:"performance_3y"`
+	Performance5y              *float64           `json:"performance_5y"`
+	HistoricalVolatility       json.RawMessage    `json:"historical_volatility"`
+	HistoricalMaxDrawdown      json.RawMessage    `json:"historical_max_drawdown"`
+	HistoricalSharpeRatio      json.RawMessage    `json:"historical_sharpe_ratio"`
+	Exchanges                  json.RawMessage    `json:"exchanges"`
+	AdditionalAttributes       json.RawMessage    `json:"additional_attributes"`
+	LastSeenAt                 *time.Time         `json:"last_seen_at"`
+	ScrapeDateBaseData         *string            `json:"scrape_date_base_data"` // YYYY-MM-DD
+	ScrapeDateDetails          *string            `json:"scrape_date_details"`
+}
+
+// ResolveEtfSymbol returns the id of the etf a symbol stands for. A symbol is tried, in this order, as
+// finanzfluss id, isin, wkn and exchange ticker (from the exchanges column), ignoring case.
+// ErrNotFound is returned for unknown symbols, ErrConflict if a ticker is used by several etfs.
+func (r *PostgresRepository) ResolveEtfSymbol(ctx context.Context, symbol string) (string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		WITH matches AS (
+			SELECT id, 1 AS rank FROM t_etf WHERE id = lower($1)
+			UNION ALL
+			SELECT id, 2 FROM t_etf WHERE isin = upper($1)
+			UNION ALL
+			SELECT id, 3 FROM t_etf WHERE wkn = upper($1)
+			UNION ALL
+			SELECT e.id, 4 FROM t_etf e, json_array_elements(e.exchanges) x
+			WHERE json_typeof(e.exchanges) = 'array' AND upper(x->>'ticker') = upper($1)
+		)
+		SELECT DISTINCT id FROM matches
+		WHERE rank = (SELECT min(rank) FROM matches)
+		ORDER BY id
+		LIMIT 2`, symbol)
+	if err != nil {
+		return "", wrapError(err, "resolve etf %q", symbol)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return "", wrapError(err, "resolve etf %q", symbol)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return "", wrapError(err, "resolve etf %q", symbol)
+	}
+	return resolvedId(symbol, ids)
+}
+
+// resolvedId turns the matches of the best ranked kind of identifier into the result of ResolveEtfSymbol.
+func resolvedId(symbol string, ids []string) (string, error) {
+	switch len(ids) {
+	case 0:
+		return "", wrapError(ErrNotFound, "resolve etf %q", symbol)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", wrapError(ErrConflict, "resolve etf %q: ticker of several etfs, use the isin instead", symbol)
+	}
+}
+
+// GetEtfProfile returns the stored record of an etf. ErrNotFound is returned for unknown ids.
+func (r *PostgresRepository) GetEtfProfile(ctx context.Context, etfId string) (EtfProfile, error) {
+	var data json.RawMessage
+	err := r.db.QueryRowContext(ctx, `
+		SELECT etf_snapshot_data(e.id) || jsonb_build_object(
+			'status', e.status,
+			'performance_1y', e.performance_1y,
+			'performance_3y', e.performance_3y,
+			'performance_5y', e.performance_5y,
+			'last_seen_at', e.last_seen_at,
+			'scrape_date_base_data', e.scrape_date_base_data,
+			'scrape_date_details', e.scrape_date_details)
+		FROM t_etf e
+		WHERE e.id = $1`, etfId).Scan(&data)
+	if err != nil {
+		return EtfProfile{}, wrapError(err, "get profile of etf %s", etfId)
+	}
+	return decodeProfile(etfId, data)
+}
+
+// Columns of t_etf named without underscores, by their EtfProfile field name
+var profileColumns = map[string]string{
+	"fund_volume":         "fundvolume",
+	"share_class_volume":  "shareclassvolume",
+	"is_distributing":     "isdistributing",
+	"release_date":        "releasedate",
+	"replication_method":  "replicationmethod",
+	"total_expense_ratio": "totalexpenseratio",
+}
+
+// decodeProfile decodes the snapshot content of an etf, extended by its status columns.
+func decodeProfile(etfId string, data json.RawMessage) (EtfProfile, error) {
+	var profile EtfProfile
+	var columns map[string]json.RawMessage
+	if err := json.Unmarshal(data, &columns); err != nil {
+		return profile, wrapError(err, "decode profile of etf %s", etfId)
+	}
+	for field, column := range profileColumns {
+		if value, ok := columns[column]; ok {
+			columns[field] = value
+			delete(columns, column)
+		}
+	}
+	data, _ = json.Marshal(columns) // Values are valid json already
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return profile, wrapError(err, "decode profile of etf %s", etfId)
+	}
+	if profile.Composition == nil {
+		profile.Composition = []CompositionEntry{}
+	}
+	return profile, nil
+}
+
+// profileTickers returns the upper cased tickers of the exchanges column.
+func profileTickers(exchanges json.RawMessage) []string {
+	var listings []struct {
+		Ticker string `json:"ticker"`
+	}
+	json.Unmarshal(exchanges, &listings) // Anything but a list has no tickers
+	var tickers []string
+	for _, listing := range listings {
+		if listing.Ticker != "" {
+			tickers = append(tickers, strings.ToUpper(listing.Ticker))
+		}
+	}
+	return tickers
+}
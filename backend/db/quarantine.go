@@ -0,0 +1,120 @@
+package db
+
+import (
+	"backend/validate"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuarantinedValue is a scraped value that failed validation. It is kept in t_etf_quarantine for inspection
+// instead of being stored in t_etf, where the column stays empty.
+type QuarantinedValue struct {
+	Id         int64
+	EtfId      string
+	Field      string // Column of t_etf the value was scraped for, e.g. "isin"
+	Value      string
+	Reason     string
+	DetectedAt time.Time
+}
+
+// checkIdentifiers validates the isin and wkn of scraped details and returns the details with normalized identifiers.
+// Invalid identifiers are cleared and returned as quarantined values, so the remaining details can still be stored.
+func checkIdentifiers(data EtfDetailsData, now time.Time) (EtfDetailsData, []QuarantinedValue) {
+	var quarantined []QuarantinedValue
+	check := func(field string, value *string, validate func(string) (string, error)) {
+		if isPlaceholder(*value) {
+			*value = ""
+			return
+		}
+		normalized, err := validate(*value)
+		if err != nil {
+			quarantined = append(quarantined, QuarantinedValue{EtfId: data.Id, Field: field, Value: *value, Reason: err.Error(), DetectedAt: now})
+		}
+		*value = normalized
+	}
+	check("isin", &data.ISIN, validate.ISIN)
+	check("wkn", &data.WKN, validate.WKN)
+	return data, quarantined
+}
+
+// isPlaceholder reports whether a scraped value stands for "no value", like in package parse.
+func isPlaceholder(value string) bool {
+	value = strings.TrimSpace(value)
+	return value == "" || value == "—" || value == "–" || value == "-"
+}
+
+// claimIdentifiers quarantines identifiers of the details that already belong to another etf, as t_etf has unique indexes on them.
+// Every identifier is locked until the end of tx, so etfs claiming the same value concurrently are quarantined one after another
+// instead of failing on the unique index.
+func claimIdentifiers(ctx context.Context, tx *sql.Tx, data *EtfDetailsData, now time.Time) ([]QuarantinedValue, error) {
+	var quarantined []QuarantinedValue
+	identifiers := []struct {
+		column string
+		value  *string
+	}{{"isin", &data.ISIN}, {"wkn", &data.WKN}}
+	for _, identifier := range identifiers {
+		column, value := identifier.column, identifier.value
+		if *value == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", column+":"+*value); err != nil {
+			return nil, err
+		}
+		var owner string
+		// column is one of the fixed keys above. Read after the lock, so it sees the claims committed while waiting for it
+		err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT id FROM t_etf WHERE %s = $1 AND id <> $2 LIMIT 1", column), *value, data.Id).Scan(&owner)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		quarantined = append(quarantined, duplicateIdentifier(data.Id, column, *value, owner, now))
+		*value = ""
+	}
+	return quarantined, nil
+}
+
+func duplicateIdentifier(etfId string, field string, value string, owner string, now time.Time) QuarantinedValue {
+	return QuarantinedValue{EtfId: etfId, Field: field, Value: value, Reason: "already used by etf " + owner, DetectedAt: now}
+}
+
+func insertQuarantinedValues(ctx context.Context, tx *sql.Tx, values []QuarantinedValue) error {
+	for _, value := range values {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO t_etf_quarantine (etf_id, field, value, reason, detected_at)
+			VALUES ($1, $2, $3, $4, $5)`,
+			value.EtfId, value.Field, value.Value, value.Reason, value.DetectedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetQuarantinedValues returns the quarantined values of an etf, or of all etfs if etfId is empty, oldest first.
+func (r *PostgresRepository) GetQuarantinedValues(ctx context.Context, etfId string) ([]QuarantinedValue, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, etf_id, field, value, reason, detected_at
+		FROM t_etf_quarantine
+		WHERE $1 = '' OR etf_id = $1
+		ORDER BY id`, etfId)
+	if err != nil {
+		return nil, wrapError(err, "get quarantined values")
+	}
+	defer rows.Close()
+
+	values := []QuarantinedValue{}
+	for rows.Next() {
+		var value QuarantinedValue
+		if err := rows.Scan(&value.Id, &value.EtfId, &value.Field, &value.Value, &value.Reason, &value.DetectedAt); err != nil {
+			return nil, wrapError(err, "get quarantined values")
+		}
+		values = append(values, value)
+	}
+	return values, wrapError(rows.Err(), "get quarantined values")
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// EtfRepository stores the scraped etfs, their history and the scrape runs.
+// PostgresRepository is used in production, MemoryRepository in unit tests.
+// Errors are wrapped with their kind, see ErrNotFound, ErrConflict, ErrValidation and ErrTransient.
+type EtfRepository interface {
+	// Etfs
+	InsertOrUpdateEtf(ctx context.Context, data EtfBaseData) error
+	UpsertEtfs(ctx context.Context, batch []EtfBaseData) (UpsertResult, error)
+	UpdateEtfDetails(ctx context.Context, data EtfDetailsData) error
+	GetAllIds(ctx context.Context) ([]string, error)
+	GetAllIdsWhereNoDetails(ctx context.Context) ([]string, error)
+	ReconcileListRun(ctx context.Context, runStartedAt time.Time, delistAfterMisses int) (ListRunReconciliation, error)
+	GetQuarantinedValues(ctx context.Context, etfId string) ([]QuarantinedValue, error)
+	ResolveEtfSymbol(ctx context.Context, symbol string) (string, error)
+	GetEtfProfile(ctx context.Context, etfId string) (EtfProfile, error)
+	ListEtfs(ctx context.Context, filter EtfListFilter) (EtfListPage, error)
+	SearchEtfs(ctx context.Context, search EtfSearch) ([]SearchHit, error)
+
+	// Screens
+	SaveScreen(ctx context.Context, screen SavedScreen) (SavedScreen, error)
+	GetSavedScreen(ctx context.Context, name string) (SavedScreen, error)
+	ListSavedScreens(ctx context.Context) ([]SavedScreen, error)
+	DeleteSavedScreen(ctx context.Context, name string) error
+
+	// History
+	GetEtfAsOf(ctx context.Context, etfId string, at time.Time) (EtfSnapshot, error)
+	GetEtfTimeSeries(ctx context.Context, etfId string, field string, from time.Time, to time.Time) ([]TimeSeriesPoint, error)
+	GetChangeEvents(ctx context.Context, filter ChangeEventFilter) ([]ChangeEvent, error)
+
+	// Scrape runs
+	StartScrapeRun(ctx context.Context, kind string, itemsTotal int) (int64, error)
+	UpdateScrapeRunTotal(ctx context.Context, runId int64, itemsTotal int) error
+	FinishScrapeRun(ctx context.Context, runId int64, status string, statusReason string, succeeded int, skipped int, failed int) error
+	ResumeScrapeRun(ctx context.Context, runId int64) error
+	AddScrapeRunUpsertCounts(ctx context.Context, runId int64, counts UpsertResult) error
+	GetScrapeRun(ctx context.Context, runId int64) (ScrapeRun, error)
+	GetLatestScrapeRun(ctx context.Context, kind string) (ScrapeRun, error)
+	InsertScrapeItemResult(ctx context.Context, runId int64, itemId string, status string, errorMessage string, duration time.Duration) error
+	GetScrapeItemResults(ctx context.Context, runId int64, status string) ([]ScrapeItemResult, error)
+	CountScrapeItemResults(ctx context.Context, runId int64) (succeeded int, skipped int, failed int, err error)
+	SaveListCheckpoint(ctx context.Context, checkpoint ListCheckpoint) error
+	GetResumableListRun(ctx context.Context) (ScrapeRun, ListCheckpoint, error)
+	SaveScrapeRunFieldStats(ctx context.Context, runId int64, stats []FieldStat) error
+	GetFieldFillRateBaseline(ctx context.Context, kind string, runs int, excludeRunId int64) (map[string]float64, error)
+}
+
+var (
+	_ EtfRepository = (*PostgresRepository)(nil)
+	_ EtfRepository = (*MemoryRepository)(nil)
+)
+
+// PostgresRepository is the EtfRepository backed by the tables created by the migrations in db/migrations.
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(conn *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: conn}
+}
@@ -0,0 +1,273 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	ScrapeRunKindList = "list"
+	ScrapeRunKindEtf  = "etf"
+)
+
+const (
+	ScrapeRunStatusRunning   = "running"
+	ScrapeRunStatusCompleted = "completed"
+	ScrapeRunStatusFailed    = "failed"
+	ScrapeRunStatusDegraded  = "degraded"  // Finished or aborted with signs of changed markup
+	ScrapeRunStatusAbandoned = "abandoned" // Interrupted run whose checkpoint is no longer valid
+)
+
+const (
+	ScrapeItemStatusSucceeded = "succeeded"
+	ScrapeItemStatusSkipped   = "skipped"
+	ScrapeItemStatusFailed    = "failed"
+)
+
+type ScrapeRun struct {
+	Id             int64
+	Kind           string
+	StartedAt      time.Time
+	FinishedAt     sql.NullTime
+	Status         string
+	StatusReason   string
+	ItemsTotal     int
+	ItemsSucceeded int
+	ItemsSkipped   int
+	ItemsFailed    int
+	Upserted       UpsertResult // Etf rows written by the run, summed up over its pages
+}
+
+type ScrapeItemResult struct {
+	RunId        int64
+	ItemId       string
+	Status       string
+	ErrorMessage string
+	Duration     time.Duration
+	CreatedAt    time.Time
+}
+
+// StartScrapeRun records a new running scrape run and returns its id.
+func (r *PostgresRepository) StartScrapeRun(ctx context.Context, kind string, itemsTotal int) (int64, error) {
+	var runId int64
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO t_scrape_run (kind, started_at, status, items_total)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		kind, time.Now(), ScrapeRunStatusRunning, itemsTotal).Scan(&runId)
+	return runId, wrapError(err, "start %s scrape run", kind)
+}
+
+// UpdateScrapeRunTotal sets the number of items a run is going to process once it is known.
+func (r *PostgresRepository) UpdateScrapeRunTotal(ctx context.Context, runId int64, itemsTotal int) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE t_scrape_run SET items_total = $2 WHERE id = $1", runId, itemsTotal)
+	return wrapError(err, "update total of scrape run %d", runId)
+}
+
+// FinishScrapeRun stores the final status and counts of a run. statusReason explains non completed statuses.
+func (r *PostgresRepository) FinishScrapeRun(ctx context.Context, runId int64, status string, statusReason string, succeeded int, skipped int, failed int) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE t_scrape_run SET
+			finished_at = $2,
+			status = $3,
+			status_reason = $4,
+			items_succeeded = $5,
+			items_skipped = $6,
+			items_failed = $7
+		WHERE id = $1`,
+		runId, time.Now(), status, sql.NullString{String: statusReason, Valid: statusReason != ""}, succeeded, skipped, failed)
+	return wrapError(err, "finish scrape run %d", runId)
+}
+
+// AddScrapeRunUpsertCounts adds the outcome of an upsert, e.g. of a list page, to the totals of a run.
+func (r *PostgresRepository) AddScrapeRunUpsertCounts(ctx context.Context, runId int64, counts UpsertResult) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE t_scrape_run SET
+			rows_inserted = rows_inserted + $2,
+			rows_updated = rows_updated + $3,
+			rows_unchanged = rows_unchanged + $4
+		WHERE id = $1`,
+		runId, counts.Inserted, counts.Updated, counts.Unchanged)
+	return wrapError(err, "add upsert counts to scrape run %d", runId)
+}
+
+// InsertScrapeItemResult records the outcome of scraping a single item (etf id or list page) of a run.
+func (r *PostgresRepository) InsertScrapeItemResult(ctx context.Context, runId int64, itemId string, status string, errorMessage string, duration time.Duration) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO t_scrape_item_result (run_id, item_id, status, error_message, duration_ms)
+		VALUES ($1, $2, $3, $4, $5)`,
+		runId, itemId, status, sql.NullString{String: errorMessage, Valid: errorMessage != ""}, duration.Milliseconds())
+	return wrapError(err, "insert result of %s in scrape run %d", itemId, runId)
+}
+
+func (r *PostgresRepository) GetScrapeRun(ctx context.Context, runId int64) (ScrapeRun, error) {
+	run, err := scanScrapeRun(r.db.QueryRowContext(ctx, scrapeRunSelect+" WHERE id = $1", runId))
+	return run, wrapError(err, "get scrape run %d", runId)
+}
+
+// GetLatestScrapeRun returns the most recently started run of the given kind.
+// ErrNotFound is returned if there is none.
+func (r *PostgresRepository) GetLatestScrapeRun(ctx context.Context, kind string) (ScrapeRun, error) {
+	run, err := scanScrapeRun(r.db.QueryRowContext(ctx, scrapeRunSelect+" WHERE kind = $1 ORDER BY started_at DESC LIMIT 1", kind))
+	return run, wrapError(err, "get latest %s scrape run", kind)
+}
+
+// GetScrapeItemResults returns the item outcomes of a run, optionally filtered by status.
+func (r *PostgresRepository) GetScrapeItemResults(ctx context.Context, runId int64, status string) ([]ScrapeItemResult, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT run_id, item_id, status, coalesce(error_message, ''), coalesce(duration_ms, 0), created_at
+		FROM t_scrape_item_result
+		WHERE run_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id`, runId, status)
+	if err != nil {
+		return nil, wrapError(err, "get results of scrape run %d", runId)
+	}
+	defer rows.Close()
+
+	results := []ScrapeItemResult{}
+	for rows.Next() {
+		var result ScrapeItemResult
+		var durationMs int64
+		if err := rows.Scan(&result.RunId, &result.ItemId, &result.Status, &result.ErrorMessage, &durationMs, &result.CreatedAt); err != nil {
+			return nil, wrapError(err, "get results of scrape run %d", runId)
+		}
+		result.Duration = time.Duration(durationMs) * time.Millisecond
+		results = append(results, result)
+	}
+	return results, wrapError(rows.Err(), "get results of scrape run %d", runId)
+}
+
+const scrapeRunSelect = `
+	SELECT id, kind, started_at, finished_at, status, coalesce(status_reason, ''), items_total, items_succeeded, items_skipped, items_failed,
+		rows_inserted, rows_updated, rows_unchanged
+	FROM t_scrape_run`
+
+func scanScrapeRun(row *sql.Row) (ScrapeRun, error) {
+	var run ScrapeRun
+	err := row.Scan(&run.Id, &run.Kind, &run.StartedAt, &run.FinishedAt, &run.Status, &run.StatusReason, &run.ItemsTotal, &run.ItemsSucceeded, &run.ItemsSkipped, &run.ItemsFailed,
+		&run.Upserted.Inserted, &run.Upserted.Updated, &run.Upserted.Unchanged)
+	return run, err
+}
+
+// ListCheckpoint is the progress of a list scrape run, saved after every page.
+type ListCheckpoint struct {
+	RunId             int64
+	TotalResults      int
+	TotalPages        int
+	LastCompletedPage int
+	UpdatedAt         time.Time
+}
+
+func (r *PostgresRepository) SaveListCheckpoint(ctx context.Context, checkpoint ListCheckpoint) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO t_scrape_list_checkpoint (run_id, total_results, total_pages, last_completed_page, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (run_id)
+		DO UPDATE SET
+			total_results = EXCLUDED.total_results,
+			total_pages = EXCLUDED.total_pages,
+			last_completed_page = EXCLUDED.last_completed_page,
+			updated_at = EXCLUDED.updated_at`,
+		checkpoint.RunId, checkpoint.TotalResults, checkpoint.TotalPages, checkpoint.LastCompletedPage, time.Now())
+	return wrapError(err, "save checkpoint of scrape run %d", checkpoint.RunId)
+}
+
+// GetResumableListRun returns the latest list run that did not finish together with its checkpoint.
+// ErrNotFound is returned if the latest list run completed or has no checkpoint.
+func (r *PostgresRepository) GetResumableListRun(ctx context.Context) (ScrapeRun, ListCheckpoint, error) {
+	var run ScrapeRun
+	var checkpoint ListCheckpoint
+	err := r.db.QueryRowContext(ctx, `
+		SELECT r.id, r.kind, r.started_at, r.finished_at, r.status, coalesce(r.status_reason, ''), r.items_total, r.items_succeeded, r.items_skipped, r.items_failed,
+			c.run_id, c.total_results, c.total_pages, c.last_completed_page, c.updated_at
+		FROM t_scrape_run r
+		JOIN t_scrape_list_checkpoint c ON c.run_id = r.id
+		WHERE r.id = (SELECT id FROM t_scrape_run WHERE kind = $1 ORDER BY started_at DESC LIMIT 1)
+			AND r.status IN ($2, $3)`,
+		ScrapeRunKindList, ScrapeRunStatusRunning, ScrapeRunStatusFailed).Scan(
+		&run.Id, &run.Kind, &run.StartedAt, &run.FinishedAt, &run.Status, &run.StatusReason, &run.ItemsTotal, &run.ItemsSucceeded, &run.ItemsSkipped, &run.ItemsFailed,
+		&checkpoint.RunId, &checkpoint.TotalResults, &checkpoint.TotalPages, &checkpoint.LastCompletedPage, &checkpoint.UpdatedAt)
+	return run, checkpoint, wrapError(err, "get resumable list run")
+}
+
+// ResumeScrapeRun marks an interrupted run as running again.
+func (r *PostgresRepository) ResumeScrapeRun(ctx context.Context, runId int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE t_scrape_run SET status = $2, finished_at = NULL WHERE id = $1", runId, ScrapeRunStatusRunning)
+	return wrapError(err, "resume scrape run %d", runId)
+}
+
+// CountScrapeItemResults returns the number of succeeded, skipped and failed items of a run.
+func (r *PostgresRepository) CountScrapeItemResults(ctx context.Context, runId int64) (succeeded int, skipped int, failed int, err error) {
+	err = r.db.QueryRowContext(ctx, `
+		SELECT
+			count(*) FILTER (WHERE status = $2),
+			count(*) FILTER (WHERE status = $3),
+			count(*) FILTER (WHERE status = $4)
+		FROM t_scrape_item_result
+		WHERE run_id = $1`,
+		runId, ScrapeItemStatusSucceeded, ScrapeItemStatusSkipped, ScrapeItemStatusFailed).Scan(&succeeded, &skipped, &failed)
+	err = wrapError(err, "count results of scrape run %d", runId)
+	return
+}
+
+// FieldStat is how many of the items scraped in a run had a value for a field.
+type FieldStat struct {
+	Field  string
+	Filled int
+	Total  int
+}
+
+// SaveScrapeRunFieldStats adds the stats to those already stored for the run (e.g. by an interrupted session of it).
+func (r *PostgresRepository) SaveScrapeRunFieldStats(ctx context.Context, runId int64, stats []FieldStat) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(err, "save field stats of scrape run %d", runId)
+	}
+	defer tx.Rollback()
+
+	for _, stat := range stats {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO t_scrape_run_field_stats (run_id, field, filled, total)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (run_id, field)
+			DO UPDATE SET
+				filled = t_scrape_run_field_stats.filled + EXCLUDED.filled,
+				total = t_scrape_run_field_stats.total + EXCLUDED.total`,
+			runId, stat.Field, stat.Filled, stat.Total)
+		if err != nil {
+			return wrapError(err, "save field stats of scrape run %d", runId)
+		}
+	}
+	return wrapError(tx.Commit(), "save field stats of scrape run %d", runId)
+}
+
+// GetFieldFillRateBaseline returns the average fill rate per field over the last
+// completed runs of the given kind, not counting the run excludeRunId.
+func (r *PostgresRepository) GetFieldFillRateBaseline(ctx context.Context, kind string, runs int, excludeRunId int64) (map[string]float64, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT s.field, avg(s.filled::float / s.total)
+		FROM t_scrape_run_field_stats s
+		WHERE s.total > 0 AND s.run_id IN (
+			SELECT id FROM t_scrape_run
+			WHERE kind = $1 AND status = $2 AND id <> $3
+			ORDER BY started_at DESC
+			LIMIT $4)
+		GROUP BY s.field`,
+		kind, ScrapeRunStatusCompleted, excludeRunId, runs)
+	if err != nil {
+		return nil, wrapError(err, "get %s fill rate baseline", kind)
+	}
+	defer rows.Close()
+
+	baseline := map[string]float64{}
+	for rows.Next() {
+		var field string
+		var rate float64
+		if err := rows.Scan(&field, &rate); err != nil {
+			return nil, wrapError(err, "get %s fill rate baseline", kind)
+		}
+		baseline[field] = rate
+	}
+	return baseline, wrapError(rows.Err(), "get %s fill rate baseline", kind)
+}
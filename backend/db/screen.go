@@ -0,0 +1,91 @@
+package db
+
+import (
+	"backend/screener"
+	"context"
+	"database/sql"
+	"regexp"
+	"time"
+)
+
+// SavedScreen is a named screener query, see package screener. Saved screens are listed like ad-hoc screens via ListEtfs.
+type SavedScreen struct {
+	Name        string    `json:"name"`
+	Query       string    `json:"query"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Names are used in urls
+var screenNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,100}$`)
+
+// validate checks the name and parses the query, so only valid screens get saved.
+func (s SavedScreen) validate() error {
+	if !screenNamePattern.MatchString(s.Name) {
+		return validationError("screen name %q must be 1 to 100 letters, digits, dashes or underscores", s.Name)
+	}
+	if _, err := screener.Parse(s.Query); err != nil {
+		return validationError("%v", err)
+	}
+	return nil
+}
+
+// SaveScreen creates the screen or replaces the query and description of the screen with the same name.
+func (r *PostgresRepository) SaveScreen(ctx context.Context, screen SavedScreen) (SavedScreen, error) {
+	if err := screen.validate(); err != nil {
+		return screen, err
+	}
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO t_saved_screen (name, query, description)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET
+			query = EXCLUDED.query,
+			description = EXCLUDED.description,
+			updated_at = now()
+		RETURNING created_at, updated_at`,
+		screen.Name, screen.Query, screen.Description).Scan(&screen.CreatedAt, &screen.UpdatedAt)
+	return screen, wrapError(err, "save screen %s", screen.Name)
+}
+
+func (r *PostgresRepository) GetSavedScreen(ctx context.Context, name string) (SavedScreen, error) {
+	var screen SavedScreen
+	err := r.db.QueryRowContext(ctx, `
+		SELECT name, query, description, created_at, updated_at
+		FROM t_saved_screen
+		WHERE name = $1`, name).Scan(&screen.Name, &screen.Query, &screen.Description, &screen.CreatedAt, &screen.UpdatedAt)
+	return screen, wrapError(err, "get screen %s", name)
+}
+
+// ListSavedScreens returns all saved screens, ordered by name ignoring case like the etf listing.
+func (r *PostgresRepository) ListSavedScreens(ctx context.Context) ([]SavedScreen, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT name, query, description, created_at, updated_at
+		FROM t_saved_screen
+		ORDER BY lower(name), name`)
+	if err != nil {
+		return nil, wrapError(err, "list screens")
+	}
+	defer rows.Close()
+
+	screens := []SavedScreen{}
+	for rows.Next() {
+		var screen SavedScreen
+		if err := rows.Scan(&screen.Name, &screen.Query, &screen.Description, &screen.CreatedAt, &screen.UpdatedAt); err != nil {
+			return nil, wrapError(err, "list screens")
+		}
+		screens = append(screens, screen)
+	}
+	return screens, wrapError(rows.Err(), "list screens")
+}
+
+func (r *PostgresRepository) DeleteSavedScreen(ctx context.Context, name string) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM t_saved_screen WHERE name = $1", name)
+	if err != nil {
+		return wrapError(err, "delete screen %s", name)
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return wrapError(sql.ErrNoRows, "delete screen %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// EtfSearch is a search of SearchEtfs.
+type EtfSearch struct {
+	Text            string // Words of the name, base index or fund provider, or an id, isin, wkn or ticker
+	Prefix          bool   // For typeaheads: words and identifiers match by their start and nothing matches fuzzily
+	IncludeInactive bool   // Also missing and delisted etfs
+	Limit           int    // 0 returns all
+}
+
+// SearchHit is an etf found by SearchEtfs. Fields are named like in EtfProfile.
+type SearchHit struct {
+	Id           string   `json:"id"`
+	Name         string   `json:"name"`
+	ISIN         *string  `json:"isin"`
+	WKN          *string  `json:"wkn"`
+	BaseIndex    *string  `json:"base_index"`
+	FundProvider *string  `json:"fund_provider"`
+	Tickers      []string `json:"tickers"`
+	Status       string   `json:"status"`
+	Score        float64  `json:"score"` // Higher is better. Identifier matches score at least searchScoreIdentifierPrefix
+}
+
+const (
+	maxSearchTextLength = 200
+
+	searchScoreIdentifier       = 4 // Id, isin, wkn or ticker equal to the search text
+	searchScoreIdentifierPrefix = 2 // Isin, wkn or ticker starting with the search text, for prefix searches
+)
+
+// Identifiers are only looked for in texts like symbols of ResolveEtfSymbol
+var searchIdentifierPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]{0,19}$`)
+
+// searchTerms splits a text into lower case words of letters and digits, like the 'simple' text search config does.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+// prepare returns the words of the search text and the text as upper case identifier, empty if it can't be one.
+func (s EtfSearch) prepare() (terms []string, identifier string, err error) {
+	text := strings.TrimSpace(s.Text)
+	if len(text) > maxSearchTextLength {
+		return nil, "", validationError("search text is longer than %d characters", maxSearchTextLength)
+	}
+	if s.Limit < 0 {
+		return nil, "", validationError("limit must not be negative")
+	}
+	terms = searchTerms(text)
+	if len(terms) == 0 {
+		return nil, "", validationError("search text %q contains no letters or digits", s.Text)
+	}
+	if searchIdentifierPattern.MatchString(text) {
+		identifier = strings.ToUpper(text)
+	}
+	return terms, identifier, nil
+}
+
+// tsQuery joins the terms to a tsquery matching etfs with all of them. Terms only consist of letters and digits,
+// so they need no quoting.
+func tsQuery(terms []string, prefix bool) string {
+	if !prefix {
+		return strings.Join(terms, " & ")
+	}
+	return strings.Join(terms, ":* & ") + ":*"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike escapes the wildcards of a text for LIKE patterns with ESCAPE '\'.
+func escapeLike(text string) string {
+	return likeEscaper.Replace(text)
+}
+
+// SearchEtfs finds etfs by words of their name, base index and fund provider, and by their identifiers, best first.
+// Words are matched by full text search with names weighted over indices over providers. Unless searching by prefix,
+// texts similar to a part of the name, index or provider match too, to forgive typos. Ties are ordered by name, ignoring case.
+func (r *PostgresRepository) SearchEtfs(ctx context.Context, search EtfSearch) ([]SearchHit, error) {
+	terms, identifier, err := search.prepare()
+	if err != nil {
+		return nil, err
+	}
+	text := strings.ToLower(strings.TrimSpace(search.Text))
+
+	// The WHERE clause uses the expressions of the indexes added by the search migration and is
+	// refined by the flags below
+	rows, err := r.db.QueryContext(ctx, `
+		WITH candidates AS (
+			SELECT id, name, isin, wkn, base_index, fund_provider, status,
+				string_to_array(etf_tickers(exchanges), ' ') AS tickers,
+				etf_search_vector(name, base_index, fund_provider) AS words
+			FROM t_etf
+			WHERE ($5 OR status = 'active')
+				AND (etf_search_vector(name, base_index, fund_provider) @@ to_tsquery('simple', $3)
+					OR ($2 <> '' AND (id = lower($2) OR isin = $2 OR wkn = $2 OR etf_tickers(exchanges) LIKE '%' || $9::text || '%' ESCAPE '\'
+						OR ($4 AND length($2) >= 3 AND (isin LIKE $9 || '%' ESCAPE '\' OR wkn LIKE $9 || '%' ESCAPE '\'))))
+					OR (NOT $4 AND ($1 <% lower(name) OR $1 <% lower(base_index) OR $1 <% lower(fund_provider))))
+		), scored AS (
+			SELECT *,
+				CASE
+					WHEN $2 = '' THEN 0
+					WHEN id = lower($2) OR isin = $2 OR wkn = $2 OR $2 = ANY(tickers) THEN $7
+					WHEN $4 AND length($2) >= 3 AND (isin LIKE $9 || '%' ESCAPE '\' OR wkn LIKE $9 || '%' ESCAPE '\'
+						OR EXISTS (SELECT FROM unnest(tickers) t WHERE t LIKE $9 || '%' ESCAPE '\')) THEN $8
+					ELSE 0
+				END AS identifier_score,
+				words @@ to_tsquery('simple', $3) AS words_match,
+				coalesce(NOT $4 AND ($1 <% lower(name) OR $1 <% lower(base_index) OR $1 <% lower(fund_provider)), false) AS fuzzy_match
+			FROM candidates
+		)
+		SELECT id, coalesce(name, ''), isin, wkn, base_index, fund_provider, status, tickers,
+			identifier_score + ts_rank(words, to_tsquery('simple', $3))
+				+ CASE WHEN $4 THEN 0 ELSE word_similarity($1, lower(coalesce(name, ''))) END AS score
+		FROM scored
+		WHERE identifier_score > 0 OR words_match OR fuzzy_match
+		ORDER BY score DESC, lower(name), id
+		LIMIT $6`,
+		text, identifier, tsQuery(terms, search.Prefix), search.Prefix, search.IncludeInactive,
+		sql.NullInt64{Int64: int64(search.Limit), Valid: search.Limit > 0}, searchScoreIdentifier, searchScoreIdentifierPrefix, escapeLike(identifier))
+	if err != nil {
+		return nil, wrapError(err, "search etfs for %q", search.Text)
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		var hit SearchHit
+		hit.Tickers = []string{}
+		err := rows.Scan(&hit.Id, &hit.Name, &hit.ISIN, &hit.WKN, &hit.BaseIndex, &hit.FundProvider, &hit.Status, pq.Array(&hit.Tickers), &hit.Score)
+		if err != nil {
+			return nil, wrapError(err, "search etfs for %q", search.Text)
+		}
+		hits = append(hits, hit)
+	}
+	return hits, wrapError(rows.Err(), "search etfs for %q", search.Text)
+}
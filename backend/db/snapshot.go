@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// EtfSnapshot is the state of an etf (its t_etf row and compositions) at the time it was scraped.
+// Snapshots are only recorded when the content changed since the previous one.
+type EtfSnapshot struct {
+	Id          int64
+	EtfId       string
+	TakenAt     time.Time
+	ContentHash string
+	Data        json.RawMessage // t_etf columns by (lower case) column name, plus "composition"
+}
+
+// TimeSeriesPoint is the value of a field from TakenAt until the next point.
+type TimeSeriesPoint struct {
+	TakenAt time.Time
+	Value   sql.NullFloat64
+}
+
+// GetEtfAsOf returns the latest snapshot of the etf taken at or before at.
+// ErrNotFound is returned if the etf has no snapshot that old.
+func (r *PostgresRepository) GetEtfAsOf(ctx context.Context, etfId string, at time.Time) (EtfSnapshot, error) {
+	var snapshot EtfSnapshot
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, etf_id, taken_at, content_hash, data
+		FROM t_etf_snapshot
+		WHERE etf_id = $1 AND taken_at <= $2
+		ORDER BY taken_at DESC, id DESC
+		LIMIT 1`, etfId, at).Scan(&snapshot.Id, &snapshot.EtfId, &snapshot.TakenAt, &snapshot.ContentHash, &snapshot.Data)
+	return snapshot, wrapError(err, "get snapshot of etf %s as of %s", etfId, at.Format(time.RFC3339))
+}
+
+// GetEtfTimeSeries returns the values a numeric field (a t_etf column, e.g. "totalexpenseratio" or "fund_volume_eur")
+// had in the snapshots of the etf between from and to, oldest first.
+// The value is null where the field was empty or not a number.
+func (r *PostgresRepository) GetEtfTimeSeries(ctx context.Context, etfId string, field string, from time.Time, to time.Time) ([]TimeSeriesPoint, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT taken_at, CASE WHEN jsonb_typeof(data -> $2) = 'number' THEN (data ->> $2)::NUMERIC END
+		FROM t_etf_snapshot
+		WHERE etf_id = $1 AND taken_at BETWEEN $3 AND $4
+		ORDER BY taken_at, id`, etfId, field, from, to)
+	if err != nil {
+		return nil, wrapError(err, "get %s time series of etf %s", field, etfId)
+	}
+	defer rows.Close()
+
+	points := []TimeSeriesPoint{}
+	for rows.Next() {
+		var point TimeSeriesPoint
+		if err := rows.Scan(&point.TakenAt, &point.Value); err != nil {
+			return nil, wrapError(err, "get %s time series of etf %s", field, etfId)
+		}
+		points = append(points, point)
+	}
+	return points, wrapError(rows.Err(), "get %s time series of etf %s", field, etfId)
+}
@@ -0,0 +1,104 @@
+// Package diff compares two states of an etf, as stored in its snapshots, field by field.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Change is a single field whose value differs between two states.
+// Old or New is nil if the field did not exist in the respective state.
+type Change struct {
+	Field string // Dotted path, e.g. "totalexpenseratio", "additional_attributes.Fondsgröße" or "composition.country.USA"
+	Old   any
+	New   any
+}
+
+// Snapshots returns the changes between two snapshot contents (see db.EtfSnapshot), sorted by field.
+// Nested objects are compared per key. The "composition" list is compared per dimension and key, other lists as a whole.
+func Snapshots(old json.RawMessage, new json.RawMessage) ([]Change, error) {
+	oldFields, err := flattenSnapshot(old)
+	if err != nil {
+		return nil, fmt.Errorf("old snapshot: %w", err)
+	}
+	newFields, err := flattenSnapshot(new)
+	if err != nil {
+		return nil, fmt.Errorf("new snapshot: %w", err)
+	}
+	return Fields(oldFields, newFields), nil
+}
+
+// Fields returns the changes between two flat maps of field -> value, sorted by field.
+func Fields(old map[string]any, new map[string]any) []Change {
+	changes := []Change{}
+	for field, oldValue := range old {
+		newValue, ok := new[field]
+		if !ok {
+			if oldValue != nil {
+				changes = append(changes, Change{Field: field, Old: oldValue})
+			}
+			continue
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, Change{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+	for field, newValue := range new {
+		if _, ok := old[field]; !ok && newValue != nil {
+			changes = append(changes, Change{Field: field, New: newValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// compositionEntry is an element of the "composition" list of a snapshot.
+type compositionEntry struct {
+	Dimension string  `json:"dimension"`
+	Key       string  `json:"key"`
+	Weight    float64 `json:"weight"`
+}
+
+func flattenSnapshot(data json.RawMessage) (map[string]any, error) {
+	fields := map[string]any{}
+	if len(data) == 0 {
+		return fields, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	for name, value := range raw {
+		if name == "composition" {
+			var entries []compositionEntry
+			if err := json.Unmarshal(value, &entries); err != nil {
+				return nil, fmt.Errorf("composition: %w", err)
+			}
+			for _, entry := range entries {
+				fields["composition."+entry.Dimension+"."+entry.Key] = entry.Weight
+			}
+			continue
+		}
+
+		var v any
+		if err := json.Unmarshal(value, &v); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		flatten(name, v, fields)
+	}
+	return fields, nil
+}
+
+func flatten(path string, value any, fields map[string]any) {
+	object, ok := value.(map[string]any)
+	if !ok {
+		fields[path] = value
+		return
+	}
+	for key, v := range object {
+		flatten(path+"."+key, v, fields)
+	}
+}
@@ -0,0 +1,84 @@
+package diff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshots(t *testing.T) {
+	old := json.RawMessage(`{
+		"id": "ie00b4l5y983",
+		"totalexpenseratio": 0.002,
+		"base_index": "MSCI World",
+		"fund_provider": "iShares",
+		"exchanges": [{"name": "Xetra", "ticker": "EUNL"}],
+		"additional_attributes": {"Fondsgröße": "88,93 Mrd. €", "Alt": "x"},
+		"composition": [
+			{"dimension": "country", "key": "USA", "weight": 0.7189},
+			{"dimension": "country", "key": "Japan", "weight": 0.0552}
+		]
+	}`)
+	new := json.RawMessage(`{
+		"id": "ie00b4l5y983",
+		"totalexpenseratio": 0.0012,
+		"base_index": "MSCI ACWI",
+		"fund_provider": "iShares",
+		"exchanges": [{"name": "Xetra", "ticker": "EUNL"}, {"name": "gettex", "ticker": "EUNL"}],
+		"additional_attributes": {"Fondsgröße": "88,93 Mrd. €", "Neu": "y"},
+		"wkn": "A0RPWH",
+		"composition": [
+			{"dimension": "country", "key": "USA", "weight": 0.6}
+		]
+	}`)
+
+	changes, err := Snapshots(old, new)
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+
+	want := []Change{
+		{Field: "additional_attributes.Alt", Old: "x"},
+		{Field: "additional_attributes.Neu", New: "y"},
+		{Field: "base_index", Old: "MSCI World", New: "MSCI ACWI"},
+		{Field: "composition.country.Japan", Old: 0.0552},
+		{Field: "composition.country.USA", Old: 0.7189, New: 0.6},
+		{Field: "exchanges",
+			Old: []any{map[string]any{"name": "Xetra", "ticker": "EUNL"}},
+			New: []any{map[string]any{"name": "Xetra", "ticker": "EUNL"}, map[string]any{"name": "gettex", "ticker": "EUNL"}}},
+		{Field: "totalexpenseratio", Old: 0.002, New: 0.0012},
+		{Field: "wkn", New: "A0RPWH"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got changes\n%#v\nwant\n%#v", changes, want)
+	}
+}
+
+func TestSnapshotsUnchanged(t *testing.T) {
+	data := json.RawMessage(`{"id": "x", "name": "Fund", "composition": [{"dimension": "holding", "key": "Apple", "weight": 0.05}]}`)
+	changes, err := Snapshots(data, data)
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
+
+func TestSnapshotsNullFields(t *testing.T) {
+	changes, err := Snapshots(json.RawMessage(`{"isin": null}`), json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("a field going from null to missing is no change, got %v", changes)
+	}
+
+	changes, err = Snapshots(nil, json.RawMessage(`{"isin": "IE00B4L5Y983"}`))
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	if len(changes) != 1 || changes[0].New != "IE00B4L5Y983" {
+		t.Errorf("expected isin to be added, got %v", changes)
+	}
+}
@@ -1,51 +1,200 @@
 package main
 
 import (
+	"backend/api"
+	"backend/config"
 	"backend/db"
 	"backend/scraper"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
 func main() {
+	// Define flags for command-line arguments
+	operation := flag.String("op", "", "Operation to perform: serve, scrape-list, scrape-etf, changes")
+	etfId := flag.String("id", "", "Id of a single etf to scrape (optional for scrape-etf) or show changes of (optional for changes)")
+	resume := flag.Bool("resume", false, "Continue the last interrupted list scrape (only for scrape-list)")
+	since := flag.String("since", "", "Only show changes detected since this RFC 3339 timestamp or YYYY-MM-DD date (only for changes)")
+	kind := flag.String("kind", "", "Only show changes of this kind: listed, changed, vanished, delisted (only for changes)")
+	field := flag.String("field", "", "Only show changes of this field, e.g. totalexpenseratio or composition.country (only for changes)")
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+	if err := setupLogging(cfg.Logging); err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+
+	// Check the arguments before connecting, so mistakes exit with the usage even if the database is down
+	var changeFilter db.ChangeEventFilter
+	switch *operation {
+	case "serve", "scrape-list", "scrape-etf":
+	case "changes":
+		changeFilter, err = parseChangeFilter(*etfId, *kind, *field, *since)
+		if err != nil {
+			log.Println(err)
+			os.Exit(2)
+		}
+	default:
+		log.Println("Usage: go run main.go -op <serve|scrape-list|scrape-etf|changes> [-resume] [-id <etf id>] [-since <date>] [-kind <kind>] [-field <field>] [-config <file>]")
+		os.Exit(2)
+	}
+
 	log.Println("Starting assertforge_v2 backend ...")
 
-	// Establish connection to db
-	db.Establish_db_conn()
+	// Cancelled on Ctrl-C or SIGTERM, which stops scrapers and the server gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	//id := "ie00b579f325"
+	// Establish connection to db
+	conn, err := db.Connect(ctx, cfg.DB.ConnString())
+	if err != nil {
+		exit(err)
+	}
+	defer conn.Close()
+	repo := db.NewPostgresRepository(conn)
 
-	scraper.ScrapeEtf(nil)
-	os.Exit(0)
+	switch *operation {
+	case "serve":
+		err = start_server(ctx, repo, cfg.HTTP)
+	case "scrape-list":
+		err = scraper.ScrapeList(ctx, repo, cfg.Scraper, *resume)
+	case "scrape-etf":
+		if *etfId != "" {
+			err = scraper.ScrapeEtf(ctx, repo, cfg.Scraper, etfId)
+		} else {
+			err = scraper.ScrapeEtf(ctx, repo, cfg.Scraper, nil)
+		}
+	case "changes":
+		err = printChanges(ctx, repo, changeFilter)
+	}
+	if err != nil {
+		conn.Close()
+		exit(err)
+	}
+}
 
-	// Start Server
-	start_server()
+// exit logs err and exits with a code schedulers can act on:
+// 3 for degraded runs (the markup probably changed), 4 for transient errors worth retrying later and 1 otherwise.
+func exit(err error) {
+	switch {
+	case errors.Is(err, scraper.ErrRunDegraded):
+		log.Println(err)
+		os.Exit(3)
+	case errors.Is(err, db.ErrTransient):
+		log.Println("Operation failed temporarily:", err)
+		os.Exit(4)
+	default:
+		log.Println("Operation failed:", err)
+		os.Exit(1)
+	}
 }
 
-func start_server() {
+// start_server serves until ctx is cancelled, then waits for running requests to finish.
+func start_server(ctx context.Context, repo db.EtfRepository, cfg config.HTTP) error {
 	// Serve webpage
-	http.HandleFunc("/", serveRoot)
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		log.Print("Received request to serveRoot")
+		http.ServeFile(w, r, filepath.Join(cfg.FrontendDir, "index.html"))
+	})
 
 	// Serve api endpoints
-	http.HandleFunc("/api/fetchEtfProfile", fetchEtfProfile)
+	api.NewServer(repo).Register(http.DefaultServeMux)
 
 	// Start the server
-	port := ":8080"
-	log.Print("Server started at http://localhost:", port)
-	log.Fatal(http.ListenAndServe(port, nil))
+	server := &http.Server{Addr: cfg.Addr}
+	go func() {
+		<-ctx.Done()
+		log.Println("Shutting down server ...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
+	log.Print("Server listening on ", cfg.Addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// setupLogging applies the logging config to the standard logger.
+func setupLogging(cfg config.Logging) error {
+	flags := log.LstdFlags
+	if cfg.UTC {
+		flags |= log.LUTC
+	}
+	if cfg.Microseconds {
+		flags |= log.Lmicroseconds
+	}
+	log.SetFlags(flags)
+
+	if cfg.File != "" {
+		file, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("opening log file: %w", err)
+		}
+		log.SetOutput(file)
+	}
+	return nil
+}
+
+// parseChangeFilter builds the filter of the changes operation from its flags.
+func parseChangeFilter(etfId string, kind string, field string, since string) (db.ChangeEventFilter, error) {
+	filter := db.ChangeEventFilter{EtfId: etfId, Kind: kind, Field: field}
+	switch kind {
+	case "", db.ChangeKindListed, db.ChangeKindChanged, db.ChangeKindVanished, db.ChangeKindDelisted:
+	default:
+		return filter, fmt.Errorf("invalid -kind %q: must be one of listed, changed, vanished, delisted", kind)
+	}
+	if since != "" {
+		parsed, err := api.ParseTime(since)
+		if err != nil {
+			return filter, fmt.Errorf("invalid -since: %w", err)
+		}
+		filter.Since = parsed
+	}
+	return filter, nil
 }
 
-func serveRoot(w http.ResponseWriter, r *http.Request) {
-	log.Print("Received request to serveRoot")
-	http.ServeFile(w, r, "./frontend/dist/index.html")
+// printChanges writes the matching change events to stdout, one per line.
+func printChanges(ctx context.Context, repo db.EtfRepository, filter db.ChangeEventFilter) error {
+	events, err := repo.GetChangeEvents(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		switch event.Kind {
+		case db.ChangeKindChanged:
+			fmt.Printf("%s %-14s %-9s %s: %s -> %s\n", event.DetectedAt.Format(time.DateTime), event.EtfId, event.Kind, event.Field, jsonOrNone(event.OldValue), jsonOrNone(event.NewValue))
+		default:
+			fmt.Printf("%s %-14s %s\n", event.DetectedAt.Format(time.DateTime), event.EtfId, event.Kind)
+		}
+	}
+	return nil
 }
 
-func fetchEtfProfile(w http.ResponseWriter, r *http.Request) {
-	log.Print("Received request to fetchEtfProfile with params: ", r.URL.Query())
-	var symbol = r.URL.Query().Get("symbol")
-	fmt.Fprintf(w, `{"symbol": "%s"}`, symbol)
+func jsonOrNone(value []byte) string {
+	if value == nil {
+		return "(none)"
+	}
+	return string(value)
 }
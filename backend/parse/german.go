@@ -0,0 +1,167 @@
+// Package parse converts the german formatted values displayed on finanzfluss
+// (e.g. "1.234,56", "0,07 %", "1,23 Mrd. €") into numbers.
+// Empty values and "—" are null: the returned sql.Null* value is not Valid and no error is returned.
+package parse
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BaseCurrency is the currency volumes are stored in for comparison across etfs.
+const BaseCurrency = "EUR"
+
+var ErrInvalidNumber = errors.New("invalid german number")
+
+// Either grouped with thousand dots ("1.234.567,8") or ungrouped ("1234567,8")
+var germanNumber = regexp.MustCompile(`^[+-]?(\d{1,3}(\.\d{3})+|\d+)(,\d+)?$`)
+
+// Multipliers of the abbreviated magnitudes, matched case insensitively with or without trailing dot
+var magnitudes = map[string]float64{
+	"tsd": 1e3,
+	"mio": 1e6,
+	"mrd": 1e9,
+	"bio": 1e12,
+}
+
+// ISO codes of the currency symbols and codes values may be suffixed or prefixed with
+var currencies = map[string]string{
+	"€":   "EUR",
+	"eur": "EUR",
+	"$":   "USD",
+	"usd": "USD",
+	"£":   "GBP",
+	"gbp": "GBP",
+	"chf": "CHF",
+	"fr.": "CHF",
+	"¥":   "JPY",
+	"jpy": "JPY",
+}
+
+// Amount is a (currency) value like a fund volume.
+type Amount struct {
+	Value    float64
+	Currency string // ISO code, empty if the value had no currency
+	Valid    bool   // false for null values
+}
+
+// InBaseCurrency returns the amount in BaseCurrency.
+// Amounts without currency are assumed to be in BaseCurrency; other currencies are null, as no exchange rates are known.
+func (a Amount) InBaseCurrency() sql.NullFloat64 {
+	if !a.Valid || (a.Currency != "" && a.Currency != BaseCurrency) {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: a.Value, Valid: true}
+}
+
+// Number parses a german formatted number like "1.234,56" or "-0,5".
+func Number(s string) (sql.NullFloat64, error) {
+	s = normalize(s)
+	if isNull(s) {
+		return sql.NullFloat64{}, nil
+	}
+	value, err := number(s)
+	if err != nil {
+		return sql.NullFloat64{}, err
+	}
+	return sql.NullFloat64{Float64: value, Valid: true}, nil
+}
+
+// Int parses a german formatted integer like "1.234".
+func Int(s string) (sql.NullInt64, error) {
+	s = normalize(s)
+	if isNull(s) {
+		return sql.NullInt64{}, nil
+	}
+	value, err := number(s)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+	if value != math.Trunc(value) {
+		return sql.NullInt64{}, fmt.Errorf("%w: %q is not an integer", ErrInvalidNumber, s)
+	}
+	return sql.NullInt64{Int64: int64(value), Valid: true}, nil
+}
+
+// Percent parses a percentage like "0,07 %" into a fraction (0.0007).
+// The percent sign is optional.
+func Percent(s string) (sql.NullFloat64, error) {
+	s = normalize(s)
+	s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
+	if isNull(s) {
+		return sql.NullFloat64{}, nil
+	}
+	value, err := number(s)
+	if err != nil {
+		return sql.NullFloat64{}, err
+	}
+	return sql.NullFloat64{Float64: value / 100, Valid: true}, nil
+}
+
+// Volume parses an amount with optional magnitude and currency, like "1,23 Mrd. €", "845,12 Mio. EUR" or "$ 12.345".
+func Volume(s string) (Amount, error) {
+	var amount Amount
+	fields := strings.Fields(normalize(s))
+	if len(fields) == 0 || (len(fields) == 1 && isNull(fields[0])) {
+		return amount, nil
+	}
+
+	factor := 1.0
+	var digits []string
+	for _, field := range fields {
+		key := strings.ToLower(field)
+		if currency, ok := currencies[key]; ok {
+			amount.Currency = currency
+			continue
+		}
+		// Currency symbols may be attached to the number, e.g. "12,5€"
+		for symbol, currency := range currencies {
+			if len(key) > len(symbol) && (strings.HasPrefix(key, symbol) || strings.HasSuffix(key, symbol)) {
+				key = strings.TrimSuffix(strings.TrimPrefix(key, symbol), symbol)
+				field = key
+				amount.Currency = currency
+				break
+			}
+		}
+		if multiplier, ok := magnitudes[strings.TrimSuffix(key, ".")]; ok {
+			factor = multiplier
+			continue
+		}
+		digits = append(digits, field)
+	}
+	if len(digits) != 1 {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidNumber, s)
+	}
+
+	value, err := number(digits[0])
+	if err != nil {
+		return Amount{}, err
+	}
+	amount.Value = value * factor
+	amount.Valid = true
+	return amount, nil
+}
+
+// normalize replaces non breaking spaces with regular ones, unicode minus signs with "-" and trims the value.
+func normalize(s string) string {
+	s = strings.NewReplacer("\u00a0", " ", "\u202f", " ", "\u2212", "-").Replace(s)
+	return strings.TrimSpace(s)
+}
+
+func isNull(s string) bool {
+	return s == "" || s == "—" || s == "–" || s == "-"
+}
+
+func number(s string) (float64, error) {
+	if !germanNumber.MatchString(s) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidNumber, s)
+	}
+	s = strings.ReplaceAll(s, ".", "")
+	s = strings.ReplaceAll(s, ",", ".")
+	return strconv.ParseFloat(s, 64)
+}
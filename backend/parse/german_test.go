@@ -0,0 +1,130 @@
+package parse
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9*math.Max(1, math.Abs(b))
+}
+
+func TestNumber(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		want  float64
+		valid bool
+	}{
+		{"1.234,56", 1234.56, true},
+		{"1234,5", 1234.5, true},
+		{"12", 12, true},
+		{" -0,5 ", -0.5, true},
+		{"−0,5", -0.5, true},
+		{"1.234.567", 1234567, true},
+		{"—", 0, false},
+		{"", 0, false},
+	} {
+		got, err := Number(tc.in)
+		if err != nil {
+			t.Errorf("Number(%q): %v", tc.in, err)
+			continue
+		}
+		if got.Valid != tc.valid || !almostEqual(got.Float64, tc.want) {
+			t.Errorf("Number(%q) = %v, want %v (valid %v)", tc.in, got, tc.want, tc.valid)
+		}
+	}
+}
+
+func TestNumberInvalid(t *testing.T) {
+	for _, in := range []string{"1.23", "1,2,3", "abc", "12 %", "1.2345,6"} {
+		if _, err := Number(in); !errors.Is(err, ErrInvalidNumber) {
+			t.Errorf("Number(%q) error = %v, want ErrInvalidNumber", in, err)
+		}
+	}
+}
+
+func TestInt(t *testing.T) {
+	got, err := Int("1.513")
+	if err != nil || !got.Valid || got.Int64 != 1513 {
+		t.Errorf(`Int("1.513") = %v, %v, want 1513`, got, err)
+	}
+	if _, err := Int("12,5"); !errors.Is(err, ErrInvalidNumber) {
+		t.Errorf(`Int("12,5") error = %v, want ErrInvalidNumber`, err)
+	}
+	if got, err := Int("—"); err != nil || got.Valid {
+		t.Errorf(`Int("—") = %v, %v, want null`, got, err)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		want  float64
+		valid bool
+	}{
+		{"0,07 %", 0.0007, true},
+		{"0,20 %", 0.002, true},
+		{"26,41%", 0.2641, true},
+		{"-3,1 %", -0.031, true},
+		{"12", 0.12, true},
+		{"—", 0, false},
+		{"— %", 0, false},
+	} {
+		got, err := Percent(tc.in)
+		if err != nil {
+			t.Errorf("Percent(%q): %v", tc.in, err)
+			continue
+		}
+		if got.Valid != tc.valid || !almostEqual(got.Float64, tc.want) {
+			t.Errorf("Percent(%q) = %v, want %v (valid %v)", tc.in, got, tc.want, tc.valid)
+		}
+	}
+}
+
+func TestVolume(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Amount
+	}{
+		{"88,93 Mrd. €", Amount{Value: 88.93e9, Currency: "EUR", Valid: true}},
+		{"845,12 Mio. €", Amount{Value: 845.12e6, Currency: "EUR", Valid: true}},
+		{"1,5 mrd EUR", Amount{Value: 1.5e9, Currency: "EUR", Valid: true}},
+		{"$ 12.345", Amount{Value: 12345, Currency: "USD", Valid: true}},
+		{"12,5€", Amount{Value: 12.5, Currency: "EUR", Valid: true}},
+		{"300 Tsd.", Amount{Value: 300e3, Valid: true}},
+		{"—", Amount{}},
+		{"", Amount{}},
+	} {
+		got, err := Volume(tc.in)
+		if err != nil {
+			t.Errorf("Volume(%q): %v", tc.in, err)
+			continue
+		}
+		if got.Valid != tc.want.Valid || got.Currency != tc.want.Currency || !almostEqual(got.Value, tc.want.Value) {
+			t.Errorf("Volume(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"Mrd. €", "1,2 3,4 Mio.", "viel"} {
+		if _, err := Volume(in); !errors.Is(err, ErrInvalidNumber) {
+			t.Errorf("Volume(%q) error = %v, want ErrInvalidNumber", in, err)
+		}
+	}
+}
+
+func TestInBaseCurrency(t *testing.T) {
+	if got := (Amount{Value: 5, Currency: "EUR", Valid: true}).InBaseCurrency(); !got.Valid || got.Float64 != 5 {
+		t.Errorf("EUR amount = %v, want 5", got)
+	}
+	// Like the backfill of 20241213092218_add_numeric_volumes_to_t_etf
+	if got := (Amount{Value: 5, Valid: true}).InBaseCurrency(); !got.Valid || got.Float64 != 5 {
+		t.Errorf("amount without currency = %v, want 5", got)
+	}
+	if got := (Amount{Value: 5, Currency: "USD", Valid: true}).InBaseCurrency(); got.Valid {
+		t.Errorf("USD amount = %v, want null", got)
+	}
+	if got := (Amount{}).InBaseCurrency(); got.Valid {
+		t.Errorf("null amount = %v, want null", got)
+	}
+}
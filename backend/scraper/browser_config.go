@@ -0,0 +1,50 @@
+package scraper
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// Candidate executables searched in PATH when no exec path is configured.
+var chromeExecNames = []string{
+	"google-chrome",
+	"google-chrome-stable",
+	"chromium",
+	"chromium-browser",
+	"chrome",
+	"headless-shell",
+}
+
+// Well known install locations checked after PATH.
+var chromeExecPaths = map[string][]string{
+	"darwin": {
+		"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+		"/Applications/Chromium.app/Contents/MacOS/Chromium",
+	},
+	"linux": {
+		"/usr/bin/google-chrome",
+		"/usr/bin/chromium",
+		"/usr/bin/chromium-browser",
+		"/snap/bin/chromium",
+		"/opt/google/chrome/chrome",
+		"/headless-shell/headless-shell",
+	},
+}
+
+// findChromeExecPath returns the first Chrome executable found, or "" to let chromedp decide.
+func findChromeExecPath() string {
+	for _, name := range chromeExecNames {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	for _, path := range chromeExecPaths[runtime.GOOS] {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	log.Println("No chrome executable found. Falling back to chromedp default lookup.")
+	return ""
+}
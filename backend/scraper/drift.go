@@ -0,0 +1,176 @@
+package scraper
+
+import (
+	"backend/config"
+	"backend/db"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// ErrRunDegraded is returned by the scrapers if a run shows signs of changed markup.
+var ErrRunDegraded = errors.New("scrape run degraded")
+
+// DriftConfig controls when a scrape run is considered degraded.
+type DriftConfig struct {
+	MaxFillRateDrop     float64 // Max allowed drop of a fields fill rate below its baseline, e.g. 0.25 for 25 percentage points.
+	BaselineRuns        int     // Number of previous completed runs the baseline is averaged over.
+	MinSamples          int     // Items needed before fill rates are compared.
+	MaxConsecutiveEmpty int     // Abort after this many consecutive etfs without isin or list pages without rows. 0 disables.
+}
+
+func NewDriftConfig(c config.Scraper) DriftConfig {
+	return DriftConfig{
+		MaxFillRateDrop:     c.DriftMaxFillRateDrop,
+		BaselineRuns:        c.DriftBaselineRuns,
+		MinSamples:          c.DriftMinSamples,
+		MaxConsecutiveEmpty: c.DriftMaxConsecutiveEmpty,
+	}
+}
+
+// DriftDetector tracks per field fill rates of a run and consecutive empty results.
+// It is safe for concurrent use.
+type DriftDetector struct {
+	config DriftConfig
+
+	mu               sync.Mutex
+	filled           map[string]int
+	total            int
+	consecutiveEmpty int
+	abortReason      string
+}
+
+func NewDriftDetector(config DriftConfig) *DriftDetector {
+	return &DriftDetector{config: config, filled: map[string]int{}}
+}
+
+// ObserveItem counts which fields of a scraped item (etf details or list row) have a value.
+// Booleans and the id are ignored, as they are never empty.
+func (d *DriftDetector) ObserveItem(item any) {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.total++
+	for name, value := range fields {
+		if _, isBool := value.(bool); isBool || strings.EqualFold(name, "id") {
+			continue
+		}
+		if _, ok := d.filled[name]; !ok {
+			d.filled[name] = 0
+		}
+		if isFilled(value) {
+			d.filled[name]++
+		}
+	}
+}
+
+func isFilled(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return v != "" && v != "—"
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
+
+// ObserveEmpty records whether the latest etf (in scrape order) had no isin or list page had no rows.
+// It returns true once MaxConsecutiveEmpty empty results occurred in a row and the run should be aborted.
+func (d *DriftDetector) ObserveEmpty(empty bool, what string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !empty {
+		d.consecutiveEmpty = 0
+		return false
+	}
+	d.consecutiveEmpty++
+	if d.config.MaxConsecutiveEmpty > 0 && d.consecutiveEmpty >= d.config.MaxConsecutiveEmpty {
+		if d.abortReason == "" {
+			d.abortReason = fmt.Sprintf("%d consecutive %s", d.consecutiveEmpty, what)
+		}
+		return true
+	}
+	return false
+}
+
+// FieldStats returns the fill counts observed so far, sorted by field.
+func (d *DriftDetector) FieldStats() []db.FieldStat {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := []db.FieldStat{}
+	for _, field := range sortedKeys(d.filled) {
+		stats = append(stats, db.FieldStat{Field: field, Filled: d.filled[field], Total: d.total})
+	}
+	return stats
+}
+
+// Evaluate compares the fill rates of the run with the baseline of previous runs.
+// The returned reason is empty if the run is not degraded.
+func (d *DriftDetector) Evaluate(baseline map[string]float64) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var reasons []string
+	if d.abortReason != "" {
+		reasons = append(reasons, "aborted after "+d.abortReason)
+	}
+	if d.total >= d.config.MinSamples {
+		for _, field := range sortedKeys(d.filled) {
+			base, ok := baseline[field]
+			if !ok {
+				continue
+			}
+			rate := float64(d.filled[field]) / float64(d.total)
+			if base-rate > d.config.MaxFillRateDrop {
+				reasons = append(reasons, fmt.Sprintf("%s filled %.0f%% (baseline %.0f%%)", field, rate*100, base*100))
+			}
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// finishDriftCheck persists the field stats of the run, compares them to the baseline
+// and returns the reason the run is degraded, if it is.
+func finishDriftCheck(ctx context.Context, repo db.EtfRepository, runId int64, kind string, detector *DriftDetector) string {
+	stats := detector.FieldStats()
+	var baseline map[string]float64
+	if runId != 0 {
+		if err := repo.SaveScrapeRunFieldStats(ctx, runId, stats); err != nil {
+			log.Printf("Failed to save field stats of scrape run %d: %v", runId, err)
+		}
+		var err error
+		baseline, err = repo.GetFieldFillRateBaseline(ctx, kind, detector.config.BaselineRuns, runId)
+		if err != nil {
+			log.Printf("Failed to load fill rate baseline: %v", err)
+		}
+	}
+
+	for _, stat := range stats {
+		if stat.Total > 0 {
+			log.Printf("Fill rate %s: %.1f%% (baseline %.1f%%)", stat.Field, float64(stat.Filled)/float64(stat.Total)*100, baseline[stat.Field]*100)
+		}
+	}
+
+	reason := detector.Evaluate(baseline)
+	if reason != "" {
+		log.Printf("WARNING: scrape run %d is degraded, the site markup probably changed: %s", runId, reason)
+	}
+	return reason
+}
@@ -0,0 +1,77 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDriftDetectorEvaluate(t *testing.T) {
+	config := DriftConfig{MaxFillRateDrop: 0.25, MinSamples: 4}
+	baseline := map[string]float64{"name": 1, "replication_method": 0.9, "fund_volume": 0.8}
+	for _, test := range []struct {
+		name       string
+		rows       []ListRow
+		wantReason string // Empty if the run is not degraded
+	}{
+		{
+			name: "fill rates above the baseline",
+			rows: []ListRow{{Name: "a", ReplicationMethod: "x", FundVolume: "1"}, {Name: "b", ReplicationMethod: "x", FundVolume: "1"}, {Name: "c", ReplicationMethod: "x", FundVolume: "1"}, {Name: "d", ReplicationMethod: "x", FundVolume: "1"}},
+		},
+		{
+			name: "drop within the threshold",
+			rows: []ListRow{{Name: "a", ReplicationMethod: "x", FundVolume: "1"}, {Name: "b", ReplicationMethod: "x", FundVolume: "1"}, {Name: "c", ReplicationMethod: "x"}, {Name: "d", FundVolume: "1"}},
+		},
+		{
+			name:       "drop above the threshold",
+			rows:       []ListRow{{Name: "a", ReplicationMethod: "x"}, {Name: "b", ReplicationMethod: "x"}, {Name: "c", ReplicationMethod: "x"}, {Name: "d", ReplicationMethod: "x"}},
+			wantReason: "fund_volume filled 0% (baseline 80%)",
+		},
+		{
+			name:       "several fields dropped",
+			rows:       []ListRow{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}},
+			wantReason: "fund_volume filled 0% (baseline 80%); replication_method filled 0% (baseline 90%)",
+		},
+		{
+			name: "too few samples",
+			rows: []ListRow{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+		},
+	} {
+		detector := NewDriftDetector(config)
+		for _, row := range test.rows {
+			detector.ObserveItem(row)
+		}
+		if reason := detector.Evaluate(baseline); reason != test.wantReason {
+			t.Errorf("%s: reason = %q, want %q", test.name, reason, test.wantReason)
+		}
+	}
+
+	detector := NewDriftDetector(config)
+	for i := 0; i < 4; i++ {
+		detector.ObserveItem(ListRow{})
+	}
+	if reason := detector.Evaluate(nil); reason != "" {
+		t.Errorf("reason without baseline = %q, want none", reason)
+	}
+}
+
+func TestDriftDetectorObserveEmpty(t *testing.T) {
+	detector := NewDriftDetector(DriftConfig{MaxConsecutiveEmpty: 3})
+	for i, empty := range []bool{true, true, false, true, true} {
+		if detector.ObserveEmpty(empty, "list pages without rows") {
+			t.Fatalf("aborted after result %d, but only 2 empty results were in a row", i+1)
+		}
+	}
+	if !detector.ObserveEmpty(true, "list pages without rows") {
+		t.Fatal("not aborted after 3 empty results in a row")
+	}
+	if reason := detector.Evaluate(nil); !strings.Contains(reason, "aborted after 3 consecutive list pages without rows") {
+		t.Errorf("reason = %q, want the abort", reason)
+	}
+
+	disabled := NewDriftDetector(DriftConfig{})
+	for i := 0; i < 100; i++ {
+		if disabled.ObserveEmpty(true, "etfs without isin") {
+			t.Fatal("aborted although MaxConsecutiveEmpty is 0")
+		}
+	}
+}
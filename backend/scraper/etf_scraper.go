@@ -1,18 +1,24 @@
 package scraper
 
 import (
+	"backend/config"
 	"backend/db"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
-	//"encoding/json"
-
 	"github.com/chromedp/chromedp"
 )
 
-func ScrapeEtf(id *string) {
+// ScrapeEtf scrapes the details of the given etf, or of all etfs without details.
+// ErrRunDegraded is returned if the run finished but its results indicate changed markup.
+// Cancelling ctx stops the run, which is then recorded as failed.
+func ScrapeEtf(ctx context.Context, repo db.EtfRepository, cfg config.Scraper, id *string) error {
+	// The outcome of the run is recorded even if ctx got cancelled
+	recordCtx := context.WithoutCancel(ctx)
 
 	idsToScrape := []string{}
 
@@ -20,191 +26,157 @@ func ScrapeEtf(id *string) {
 	if id != nil {
 		idsToScrape = append(idsToScrape, *id)
 	} else {
-		rows, err := db.GetAllIdsWhereNoDetails()
+		ids, err := repo.GetAllIdsWhereNoDetails(ctx)
 		if err != nil {
-			log.Println("Error retrieving all Ids to scrape:", err)
-			panic(err)
-		}
-		defer rows.Close()
-		// Collect ids in slice
-		for rows.Next() {
-			var id string
-			err := rows.Scan(&id)
-			if err != nil {
-				log.Println("Error collecting retrieved rows:", err)
-				panic(err)
-			}
-			idsToScrape = append(idsToScrape, id)
+			return fmt.Errorf("loading ids to scrape: %w", err)
 		}
+		idsToScrape = append(idsToScrape, ids...)
 	}
 
-	log.Println("Starting etf scraper for", len(idsToScrape), "ids")
+	pool := NewPoolConfig(cfg)
+	selectorConfig, err := LoadSelectorConfig(cfg.SelectorsFile)
+	if err != nil {
+		return fmt.Errorf("loading selector config: %w", err)
+	}
+	extractor := NewHtmlExtractor(selectorConfig)
+	log.Println("Starting etf scraper for", len(idsToScrape), "ids with", pool.Concurrency, "tabs at", pool.RequestsPerSecond, "requests/s")
 
 	const urlBaseSrting = "https://www.finanzfluss.de/informer/etf/%s"
 
-	ctx, cancel := getChromdpCtx()
+	browserCtx, cancel := getChromdpCtx(ctx, cfg.Chrome)
 	defer cancel()
 
-	count := 0
-	for _, id := range idsToScrape {
-		count++
-		var url = fmt.Sprintf(urlBaseSrting, id)
-		log.Println(count, "Scraping url ", url)
+	runId, err := repo.StartScrapeRun(ctx, db.ScrapeRunKindEtf, len(idsToScrape))
+	if err != nil {
+		log.Printf("Failed to record scrape run: %v", err)
+	}
+
+	// Start the browser once so all worker tabs share it
+	if err := chromedp.Run(browserCtx); err != nil {
+		finishScrapeRun(recordCtx, repo, runId, db.ScrapeRunStatusFailed, err.Error(), 0, 0, 0)
+		return fmt.Errorf("starting browser: %w", err)
+	}
 
-		doContinue := true
+	limiter := NewHostRateLimiter(pool.RequestsPerSecond, pool.Burst)
+	retryPolicy := NewRetryPolicy(cfg)
+	detector := NewDriftDetector(NewDriftConfig(cfg))
 
-		err := chromedp.Run(ctx,
-			chromedp.Navigate(url),
-			closePopup(),
-			chromedp.Sleep(1*time.Second),
-			waitForIsin(&doContinue),
-			scrapeEtf(id, &doContinue),
-		)
+	// Cancelled if too many etfs in a row have no isin, as the markup probably changed
+	poolCtx, abort := context.WithCancel(browserCtx)
+	defer abort()
+
+	summary := runPool(poolCtx, pool, idsToScrape, func(tabCtx context.Context, id string) (taskStatus, error) {
+		var url = fmt.Sprintf(urlBaseSrting, id)
+		err := retryPolicy.Do(tabCtx, "Scraping "+id, func(ctx context.Context, attempt int) error {
+			if err := limiter.Wait(ctx, url); err != nil {
+				return err
+			}
+			attemptCtx, attemptCancel := context.WithTimeout(ctx, navigationTimeout)
+			defer attemptCancel()
+			return chromedp.Run(attemptCtx,
+				chromedp.Navigate(url),
+				closePopup(),
+				waitForIsin(),
+				expandSections(selectorConfig.ExpandSelectors),
+				scrapeEtf(repo, id, extractor, detector),
+			)
+		})
+		if errors.Is(err, errIsinMissing) {
+			return statusSkipped, err
+		}
 		if err != nil {
-			log.Printf("Failed to execute chromedp tasks: %v", err)
+			return statusFailed, err
+		}
+		return statusSucceeded, nil
+	}, func(result taskResult) {
+		recordItemResult(recordCtx, repo, runId, result.Id, result.Status, result.Err, result.Duration)
+		if result.Status == statusSucceeded || errors.Is(result.Err, errIsinMissing) {
+			if detector.ObserveEmpty(result.Status == statusSkipped, "etfs without isin") {
+				log.Println("Aborting etf scraper: too many consecutive etfs without isin")
+				abort()
+			}
 		}
+	})
+
+	log.Printf("Etf scraper finished in %v: %d succeeded, %d skipped, %d failed",
+		summary.Duration.Round(time.Second), summary.Succeeded, summary.Skipped, summary.Failed)
+
+	if err := ctx.Err(); err != nil {
+		finishScrapeRun(recordCtx, repo, runId, db.ScrapeRunStatusFailed, "interrupted", summary.Succeeded, summary.Skipped, summary.Failed)
+		return fmt.Errorf("etf scraper interrupted: %w", err)
+	}
+	if reason := finishDriftCheck(recordCtx, repo, runId, db.ScrapeRunKindEtf, detector); reason != "" {
+		finishScrapeRun(recordCtx, repo, runId, db.ScrapeRunStatusDegraded, reason, summary.Succeeded, summary.Skipped, summary.Failed)
+		return fmt.Errorf("%w: %s", ErrRunDegraded, reason)
 	}
+	finishScrapeRun(recordCtx, repo, runId, db.ScrapeRunStatusCompleted, "", summary.Succeeded, summary.Skipped, summary.Failed)
+	return nil
 }
 
-func waitForIsin(doContinue *bool) chromedp.Tasks {
+const (
+	// How long to wait for the isin to render before skipping an etf
+	isinTimeout = 10 * time.Second
+	// Upper bound for a single attempt at loading and scraping a page
+	navigationTimeout = 45 * time.Second
+)
+
+func waitForIsin() chromedp.Tasks {
 	return chromedp.Tasks{
 		chromedp.ActionFunc(func(ctx context.Context) error {
-			var isinExists bool
-			err := chromedp.EvaluateAsDevTools(`!!document.querySelector('#Copy-ISIN-Matomo .value')`, &isinExists).Do(ctx)
-			if err != nil || !isinExists {
+			start := time.Now()
+			for {
+				var isinExists bool
+				err := chromedp.EvaluateAsDevTools(`!!document.querySelector('#Copy-ISIN-Matomo .value')`, &isinExists).Do(ctx)
 				if err != nil {
-					log.Println("Error reading isin:", err)
-				} else {
-					log.Println("Isin didnt show. skipping")
+					return fmt.Errorf("%w: reading isin: %w", errEvaluation, err)
+				}
+				if isinExists {
+					return nil
+				}
+				if time.Since(start) > isinTimeout {
+					return errIsinMissing
+				}
+				if !sleep(ctx, 200*time.Millisecond) {
+					return ctx.Err()
+				}
+			}
+		}),
+	}
+}
+
+// expandSections clicks collapsed sections (e.g. the activity distribution) so all their rows are rendered.
+func expandSections(selectors []string) chromedp.Tasks {
+	return chromedp.Tasks{
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			for _, selector := range selectors {
+				err := chromedp.Evaluate(fmt.Sprintf(`document.querySelector(%q)?.click()`, selector), nil).Do(ctx)
+				if err != nil {
+					return fmt.Errorf("%w: expanding %s: %w", errEvaluation, selector, err)
 				}
-				*doContinue = false
-				return nil
 			}
 			return nil
 		}),
 	}
 }
 
-func scrapeEtf(id string, doContinue *bool) chromedp.Tasks {
+func scrapeEtf(repo db.EtfRepository, id string, extractor Extractor, detector *DriftDetector) chromedp.Tasks {
 	return chromedp.Tasks{
 		chromedp.ActionFunc(func(ctx context.Context) error {
-			if !*doContinue {
-				return nil
+			var snapshot string
+			if err := pageSnapshot(&snapshot).Do(ctx); err != nil {
+				return fmt.Errorf("%w: %w", errEvaluation, err)
 			}
 
-			var results db.EtfDetailsData
-			results.Id = id
-			log.Println("Scraping..........")
-			err := chromedp.Evaluate(`(function() {
-        // Expand activity_distribution if element exists
-        document.querySelector("#main > div.page-content > div > div.mx-auto.my-0.max-w-\\[960px\\].space-y-\\[40px\\].md\\:space-y-\\[64px\\] > div:nth-child(4) > div:nth-child(2) > div > div > div.show-more-less")?.click();
-
-        // Gather data
-        return {
-            isin: document.querySelector("#Copy-ISIN-Matomo .value")?.innerText ?? "",
-            wkn: document.querySelector("#Copy-WKN-Matomo .value")?.innerText ?? "",
-            nr_positions: document.querySelector(".etf-data-wrapper > :nth-child(5) .value")?.innerText ?? "",
-            base_index: document.querySelector("div.etf-profile-page-basic-informations > div.show-more-cards-wrapper > div.show-more-card.base-data > div > div.content > div:nth-child(1) .right-side")?.innerText ?? "",
-            share_class_volume: document.querySelector("div.etf-profile-page-basic-informations > div.show-more-cards-wrapper > div.show-more-card.base-data > div > div.content > div:nth-child(6) .right-side")?.innerText ?? "",
-            fund_domicile: document.querySelector("div.etf-profile-page-basic-informations > div.show-more-cards-wrapper > div.show-more-card.base-data > div > div.content > div:nth-child(8) .right-side")?.innerText ?? "",
-            fund_currency: document.querySelector("div.etf-profile-page-basic-informations > div.show-more-cards-wrapper > div.show-more-card.base-data > div > div.content > div:nth-child(9) .right-side")?.innerText ?? "",
-            securities_lending_permitted: document.querySelector("div.etf-profile-page-basic-informations > div.show-more-cards-wrapper > div.show-more-card.base-data > div > div.content > div:nth-child(10) .right-side")?.innerText === "Ja",
-            trade_currency: document.querySelector("div.etf-profile-page-basic-informations > div.show-more-cards-wrapper > div.show-more-card.base-data > div > div.content > div:nth-child(11) .right-side")?.innerText ?? "",
-            has_currency_hedging: document.querySelector("div.etf-profile-page-basic-informations > div.show-more-cards-wrapper > div.show-more-card.base-data > div > div.content > div:nth-child(12) .right-side")?.innerText === "Ja",
-            has_special_assets: document.querySelector("div.etf-profile-page-basic-informations > div.show-more-cards-wrapper > div.show-more-card.base-data > div > div.content > div:nth-child(6) .right-side")?.innerText === "Ja",
-            fund_provider: document.querySelector("div.show-more-card.legal-structure > div > div.content > div:nth-child(1) .right-side")?.innerText ?? "",
-            legal_structure: document.querySelector("div.show-more-card.legal-structure > div > div.content > div:nth-child(2) .right-side")?.innerText ?? "",
-            fund_structure: document.querySelector("div.show-more-card.legal-structure > div > div.content > div:nth-child(4) .right-side")?.innerText ?? "",
-            administrator: document.querySelector("div.show-more-card.legal-structure > div > div.content > div:nth-child(5) .right-side")?.innerText ?? "",
-            depotbank: document.querySelector("div.show-more-card.legal-structure > div > div.content > div:nth-child(6) .right-side")?.innerText ?? "",
-            auditor: document.querySelector("div.show-more-card.legal-structure > div > div.content > div:nth-child(7) .right-side")?.innerText ?? "",
-            country_composition: Array.from(document.querySelectorAll(".countries-card .content .country-item-wrapper") ?? []).map(wrapper => {
-                return {
-                    country: wrapper.querySelector(".country-name")?.innerText ?? "",
-                    percentile: wrapper.querySelector(".progress-bar")?.firstChild?.data ?? "",
-                };
-            }),
-            region_composition: Array.from(document.querySelectorAll(".regions-card .region") ?? []).map(wrapper => {
-                return {
-                    country: wrapper.querySelector(".name")?.innerText ?? "",
-                    percentile: wrapper.querySelector(".progress-bar")?.firstChild?.data ?? "",
-                };
-            }),
-            currency_distribution: Array.from(document.querySelectorAll(".currency-card .currency-item") ?? []).map(wrapper => {
-                return {
-                    country: wrapper.querySelector(".currency-wrapper :nth-child(2)")?.innerText ?? "",
-                    percentile: wrapper.querySelector(".percentage")?.firstChild?.data ?? "",
-                };
-            }),
-            weight_top_10: document.querySelector(".diversification-card .row:nth-child(1) .percentage")?.innerText ?? "",
-            nr_stock_positions: document.querySelector(".diversification-card .row:nth-child(3) .right-label")?.innerText ?? "",
-            nr_bond_positions: document.querySelector(".diversification-card .row:nth-child(4) .right-label")?.innerText ?? "",
-            nr_cash_and_other_positions: document.querySelector(".diversification-card .row:nth-child(5) .right-label")?.innerText ?? "",
-            top_10_holdings: Array.from(document.querySelectorAll(".top-10-holdings-card-row") ?? []).map(wrapper => {
-                return {
-                    name: wrapper.querySelector(".icon-name")?.innerText ?? "",
-                    percentile: wrapper.querySelector(".percentage")?.innerText ?? "",
-                };
-            }),
-            industry_distribution: Array.from(document.querySelectorAll(".sector-card .sector-card-row") ?? []).map(wrapper => {
-                return {
-                    name: wrapper.querySelector(".label")?.innerText ?? "",
-                    percentile: wrapper.querySelector(".percentage")?.innerText ?? "",
-                };
-            }),
-            activity_distribution: Array.from(document.querySelectorAll("#main > div.page-content > div > div.mx-auto.my-0.max-w-\\[960px\\].space-y-\\[40px\\].md\\:space-y-\\[64px\\] > div:nth-child(4) > div:nth-child(2) > div > div > div.grid") ?? []).map(wrapper => {
-                return {
-                    name: wrapper.querySelector(".label")?.innerText ?? "",
-                    percentiles: {
-                        min: wrapper.querySelector("input")?.min ?? "",
-                        value: wrapper.querySelector("input")?.value ?? "",
-                        max: wrapper.querySelector("input")?.max ?? "",
-                    },
-                };
-            }),
-            historical_performance: Array.from(document.querySelectorAll(".performance-card-table tr:has(td)") ?? []).map(wrapper => {
-                return {
-                    timespan: wrapper.cells?.[0]?.firstChild?.data ?? "",
-                    performance: wrapper.cells?.[1]?.innerText ?? "",
-                    return: wrapper.cells?.[2]?.innerText ?? "",
-                };
-            }),
-            historical_volatility: Array.from(document.querySelectorAll(".risk-metrics-item")?.[0]?.querySelectorAll(".risk-value-box") ?? []).map(wrapper => {
-                return {
-                    period: wrapper.querySelector(".period")?.innerText ?? "",
-                    value: wrapper.querySelector(".value")?.innerText ?? "",
-                };
-            }),
-            historical_max_drawdown: Array.from(document.querySelectorAll(".risk-metrics-item")?.[1]?.querySelectorAll(".risk-value-box") ?? []).map(wrapper => {
-                return {
-                    period: wrapper.querySelector(".period")?.innerText ?? "",
-                    value: wrapper.querySelector(".value")?.innerText ?? "",
-                };
-            }),
-            historical_sharpe_ratio: Array.from(document.querySelectorAll(".risk-metrics-item")?.[2]?.querySelectorAll(".risk-value-box") ?? []).map(wrapper => {
-                return {
-                    period: wrapper.querySelector(".period")?.innerText ?? "",
-                    value: wrapper.querySelector(".value")?.innerText ?? "",
-                };
-            }),
-            exchanges: Array.from(document.querySelectorAll(".available-exchanges-data-table tr:has(td)") ?? []).map(wrapper => {
-                return {
-                    name: wrapper.querySelector(".exchange-name")?.innerText ?? "",
-                    currency: wrapper.querySelector(".currency")?.innerText ?? "",
-                    ticker: wrapper.querySelector(".ticker")?.innerText ?? "",
-                };
-            })
-        };
-      })();`, &results).Do(ctx)
+			results, err := extractor.ExtractEtfDetails(id, strings.NewReader(snapshot))
 			if err != nil {
 				return err
 			}
-			//log.Println("Raw result:")
-			//output, _ := json.MarshalIndent(results, "", "  ")
-			//fmt.Println(string(output))
+			detector.ObserveItem(results)
 
 			//parse and insert into db
-			db.UpdateEtfDetails(results)
+			if err := repo.UpdateEtfDetails(ctx, results); err != nil {
+				return fmt.Errorf("%w: %w", errDatabase, err)
+			}
 			return nil
 		}),
 	}
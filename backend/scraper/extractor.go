@@ -0,0 +1,304 @@
+package scraper
+
+import (
+	"backend/db"
+	"backend/parse"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chromedp/chromedp"
+	"golang.org/x/net/html"
+)
+
+// ListRow is a single row of the etf search results table, as displayed.
+type ListRow struct {
+	Id                string `json:"id"`
+	Name              string `json:"name"`
+	TotalExpenseRatio string `json:"total_expense_ratio"`
+	IsDistributing    bool   `json:"is_distributing"`
+	ReplicationMethod string `json:"replication_method"`
+	FundVolume        string `json:"fund_volume"`
+	ShareClassVolume  string `json:"share_class_volume"`
+	ReleaseDate       string `json:"release_date"`
+}
+
+// ListPage is everything extracted from one page of the etf search.
+type ListPage struct {
+	RenderedPage int       `json:"rendered_page"`
+	ResultCount  int       `json:"result_count"`
+	Rows         []ListRow `json:"rows"`
+}
+
+// Extractor turns a html snapshot of a finanzfluss page into structured data.
+// Snapshots come from the live browser (see pageSnapshot) or from saved fixtures.
+type Extractor interface {
+	ExtractEtfDetails(id string, snapshot io.Reader) (db.EtfDetailsData, error)
+	ExtractListPage(snapshot io.Reader) (ListPage, error)
+}
+
+// pageSnapshot captures the rendered html of the current page for an Extractor.
+func pageSnapshot(snapshot *string) chromedp.Action {
+	return chromedp.OuterHTML("html", snapshot, chromedp.ByQuery)
+}
+
+// HtmlExtractor extracts data by querying the parsed html with the css selectors of a SelectorConfig.
+type HtmlExtractor struct {
+	config SelectorConfig
+}
+
+func NewHtmlExtractor(config SelectorConfig) *HtmlExtractor {
+	return &HtmlExtractor{config: config}
+}
+
+// listPageRaw is the list page as read via the selector config, before converting it to a ListPage.
+type listPageRaw struct {
+	RenderedPage string `json:"rendered_page"`
+	ResultCount  string `json:"result_count"`
+	Rows         []struct {
+		ListRow
+		Href string `json:"id"`
+	} `json:"rows"`
+}
+
+func (e *HtmlExtractor) ExtractEtfDetails(id string, snapshot io.Reader) (db.EtfDetailsData, error) {
+	var details db.EtfDetailsData
+	raw, unmatched, err := e.extractEtf(snapshot)
+	if err != nil {
+		return details, err
+	}
+	if len(unmatched) > 0 {
+		log.Printf("Selectors of %s matched nothing: %s", id, strings.Join(unmatched, ", "))
+	}
+
+	// Round trip through json to fill the nested anonymous structs of EtfDetailsData
+	if err := remarshal(raw, &details); err != nil {
+		return details, err
+	}
+	details.Id = id
+	return details, nil
+}
+
+func (e *HtmlExtractor) ExtractListPage(snapshot io.Reader) (ListPage, error) {
+	var page ListPage
+	raw, unmatched, err := e.extractList(snapshot)
+	if err != nil {
+		return page, err
+	}
+	if len(unmatched) > 0 {
+		log.Printf("Selectors of list page matched nothing: %s", strings.Join(unmatched, ", "))
+	}
+
+	var parsed listPageRaw
+	if err := remarshal(raw, &parsed); err != nil {
+		return page, err
+	}
+	page.RenderedPage, _ = strconv.Atoi(parsed.RenderedPage)
+	if resultCount, err := parse.Int(parsed.ResultCount); err == nil {
+		page.ResultCount = int(resultCount.Int64)
+	}
+	page.Rows = []ListRow{}
+	for _, row := range parsed.Rows {
+		row.ListRow.Id = idFromHref(row.Href)
+		page.Rows = append(page.Rows, row.ListRow)
+	}
+	return page, nil
+}
+
+// UnmatchedSelectors returns the configured etf detail or list page fields
+// (kind "etf_details" or "list_page") whose selectors or labels match nothing in the snapshot.
+func (e *HtmlExtractor) UnmatchedSelectors(kind string, snapshot io.Reader) ([]string, error) {
+	if kind == "list_page" {
+		_, unmatched, err := e.extractList(snapshot)
+		return unmatched, err
+	}
+	_, unmatched, err := e.extractEtf(snapshot)
+	return unmatched, err
+}
+
+// extractEtf reads the selector and label based etf detail fields.
+// Additionally the paths of fields that matched nothing are returned.
+func (e *HtmlExtractor) extractEtf(snapshot io.Reader) (map[string]any, []string, error) {
+	doc, err := goquery.NewDocumentFromReader(snapshot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: parsing html: %w", errEvaluation, err)
+	}
+	matched := map[string]bool{}
+	raw := extractFields(e.config.EtfDetails, doc.Selection, matched)
+	for field, value := range extractLabels(e.config, doc.Selection, matched) {
+		raw[field] = value
+	}
+	return raw, unmatchedPaths(matched), nil
+}
+
+func (e *HtmlExtractor) extractList(snapshot io.Reader) (map[string]any, []string, error) {
+	doc, err := goquery.NewDocumentFromReader(snapshot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: parsing html: %w", errEvaluation, err)
+	}
+	matched := map[string]bool{}
+	raw := extractFields(e.config.ListPage, doc.Selection, matched)
+	return raw, unmatchedPaths(matched), nil
+}
+
+// extractFields reads all fields of specs below scope.
+func extractFields(specs map[string]FieldSpec, scope *goquery.Selection, matched map[string]bool) map[string]any {
+	raw := map[string]any{}
+	for name, spec := range specs {
+		raw[name] = spec.extract(scope, name, matched)
+	}
+	return raw
+}
+
+// extractLabels reads the rows of the label cards (e.g. "Basisdaten") and assigns each value
+// to the field its left side label maps to. Values of unknown labels are collected under additional_attributes.
+func extractLabels(config SelectorConfig, scope *goquery.Selection, matched map[string]bool) map[string]any {
+	raw := map[string]any{}
+	additional := map[string]string{}
+
+	// Known fields default to empty values, so missing rows don't keep stale data
+	for _, label := range config.Labels {
+		if _, ok := matched["label:"+label.Field]; !ok {
+			matched["label:"+label.Field] = false
+		}
+		if label.TrueValue != "" {
+			raw[label.Field] = false
+		} else {
+			raw[label.Field] = ""
+		}
+	}
+
+	labels := map[string]LabelSpec{}
+	for label, spec := range config.Labels {
+		labels[normalizeLabel(label)] = spec
+	}
+
+	for i, card := range config.LabelCards {
+		path := fmt.Sprintf("label_cards[%d]", i)
+		rows := scope.Find(card.Rows)
+		matched[path] = matched[path] || rows.Length() > 0
+		rows.Each(func(_ int, row *goquery.Selection) {
+			label := innerText(row.Find(card.Label))
+			value := innerText(row.Find(card.Value))
+			if label == "" {
+				return
+			}
+			spec, ok := labels[normalizeLabel(label)]
+			if !ok {
+				additional[label] = value
+				return
+			}
+			matched["label:"+spec.Field] = true
+			if spec.TrueValue != "" {
+				raw[spec.Field] = value == spec.TrueValue
+			} else {
+				raw[spec.Field] = value
+			}
+		})
+	}
+
+	if len(config.LabelCards) > 0 {
+		raw["additional_attributes"] = additional
+	}
+	return raw
+}
+
+// normalizeLabel makes labels comparable regardless of case, surrounding whitespace and a trailing colon.
+func normalizeLabel(label string) string {
+	label = strings.Join(strings.Fields(label), " ")
+	return strings.ToLower(strings.TrimSuffix(label, ":"))
+}
+
+func unmatchedPaths(matched map[string]bool) []string {
+	var unmatched []string
+	for path, ok := range matched {
+		if !ok {
+			unmatched = append(unmatched, path)
+		}
+	}
+	sort.Strings(unmatched)
+	return unmatched
+}
+
+// extract reads the value of the field below scope. matched[path] is set to whether the selector matched at least once.
+func (f FieldSpec) extract(scope *goquery.Selection, path string, matched map[string]bool) any {
+	if f.Within != "" {
+		scope = scope.Find(f.Within).Eq(f.WithinIndex)
+	}
+	selection := scope.Find(f.Selector)
+	matched[path] = matched[path] || selection.Length() > 0
+	match := selection.Eq(f.Index)
+
+	switch f.Type {
+	case FieldTypeText:
+		return innerText(match)
+	case FieldTypeFirstText:
+		return firstTextNode(match)
+	case FieldTypeBoolean:
+		return innerText(match) == f.TrueValue
+	case FieldTypeExists:
+		return selection.Length() > 0
+	case FieldTypeAttribute:
+		return match.AttrOr(f.Attribute, "")
+	case FieldTypeAttributes:
+		values := map[string]any{}
+		for key, attribute := range f.Attributes {
+			values[key] = match.AttrOr(attribute, "")
+		}
+		return values
+	case FieldTypeList:
+		items := []map[string]any{}
+		selection.Each(func(_ int, item *goquery.Selection) {
+			values := map[string]any{}
+			for name, field := range f.Fields {
+				values[name] = field.extract(item, path+"."+name, matched)
+			}
+			items = append(items, values)
+		})
+		return items
+	default:
+		return nil
+	}
+}
+
+func remarshal(raw map[string]any, target any) error {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errEvaluation, err)
+	}
+	if err := json.Unmarshal(b, target); err != nil {
+		return fmt.Errorf("%w: %w", errEvaluation, err)
+	}
+	return nil
+}
+
+// idFromHref returns the last path segment of an etf profile link, e.g. ".../etf/ie00b4l5y983/" -> "ie00b4l5y983".
+func idFromHref(href string) string {
+	href = strings.TrimSuffix(href, "/")
+	return href[strings.LastIndex(href, "/")+1:]
+}
+
+// innerText approximates the browsers innerText of the first matched element:
+// its text with ascii whitespace collapsed. Non breaking spaces are kept, like in the browser.
+func innerText(s *goquery.Selection) string {
+	return strings.Join(strings.FieldsFunc(s.First().Text(), isAsciiSpace), " ")
+}
+
+func isAsciiSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f'
+}
+
+// firstTextNode returns the trimmed text of the first child node of the first matched element,
+// if it is a text node. Mirrors el.firstChild.data.
+func firstTextNode(s *goquery.Selection) string {
+	node := s.First().Nodes
+	if len(node) == 0 || node[0].FirstChild == nil || node[0].FirstChild.Type != html.TextNode {
+		return ""
+	}
+	return strings.Trim(node[0].FirstChild.Data, " \t\n\r\f")
+}
@@ -0,0 +1,188 @@
+package scraper
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// assertGolden compares got, encoded as indented json, with testdata/<name>.golden.json.
+func assertGolden(t *testing.T, name string, got any) {
+	t.Helper()
+	actual, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal result: %v", err)
+	}
+	actual = append(actual, '\n')
+
+	goldenPath := filepath.Join("testdata", name+".golden.json")
+	if *update {
+		if err := os.WriteFile(goldenPath, actual, 0644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+	}
+
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("read golden file (run with -update to create it): %v", err)
+	}
+	if string(actual) != string(expected) {
+		t.Errorf("result differs from %s (run with -update to accept)\ngot:\n%s", goldenPath, actual)
+	}
+}
+
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("open fixture: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func newTestExtractor(t *testing.T) *HtmlExtractor {
+	t.Helper()
+	config, err := LoadSelectorConfig("")
+	if err != nil {
+		t.Fatalf("LoadSelectorConfig: %v", err)
+	}
+	return NewHtmlExtractor(config)
+}
+
+func TestExtractEtfDetails(t *testing.T) {
+	details, err := newTestExtractor(t).ExtractEtfDetails("ie00b4l5y983", openFixture(t, "etf_profile.html"))
+	if err != nil {
+		t.Fatalf("ExtractEtfDetails: %v", err)
+	}
+
+	if details.Id != "ie00b4l5y983" {
+		t.Errorf("Id = %q, want %q", details.Id, "ie00b4l5y983")
+	}
+	if details.ISIN != "IE00B4L5Y983" {
+		t.Errorf("ISIN = %q, want %q", details.ISIN, "IE00B4L5Y983")
+	}
+	assertGolden(t, "etf_profile", details)
+}
+
+func TestExtractListPage(t *testing.T) {
+	page, err := newTestExtractor(t).ExtractListPage(openFixture(t, "etf_search.html"))
+	if err != nil {
+		t.Fatalf("ExtractListPage: %v", err)
+	}
+
+	if page.RenderedPage != 2 {
+		t.Errorf("RenderedPage = %d, want 2", page.RenderedPage)
+	}
+	if page.ResultCount != 4218 {
+		t.Errorf("ResultCount = %d, want 4218", page.ResultCount)
+	}
+	if len(page.Rows) != 4 {
+		t.Fatalf("got %d rows, want 4", len(page.Rows))
+	}
+	assertGolden(t, "etf_search", page)
+}
+
+func TestExtractEmptyPage(t *testing.T) {
+	details, err := newTestExtractor(t).ExtractEtfDetails("unknown", openFixture(t, "etf_search.html"))
+	if err != nil {
+		t.Fatalf("ExtractEtfDetails: %v", err)
+	}
+	if details.ISIN != "" || len(details.CountryComposition) != 0 {
+		t.Errorf("expected no details from a search page, got %+v", details)
+	}
+}
+
+func TestDefaultSelectorsMatchFixtures(t *testing.T) {
+	extractor := newTestExtractor(t)
+	for kind, fixture := range map[string]string{"etf_details": "etf_profile.html", "list_page": "etf_search.html"} {
+		unmatched, err := extractor.UnmatchedSelectors(kind, openFixture(t, fixture))
+		if err != nil {
+			t.Fatalf("UnmatchedSelectors(%s): %v", kind, err)
+		}
+		if len(unmatched) > 0 {
+			t.Errorf("selectors of %s matched nothing in %s: %v", kind, fixture, unmatched)
+		}
+	}
+}
+
+func TestUnmatchedSelectors(t *testing.T) {
+	unmatched, err := newTestExtractor(t).UnmatchedSelectors("etf_details", openFixture(t, "etf_search.html"))
+	if err != nil {
+		t.Fatalf("UnmatchedSelectors: %v", err)
+	}
+	if len(unmatched) == 0 || unmatched[0] != "activity_distribution" {
+		t.Errorf("expected all etf selectors to be reported, got %v", unmatched)
+	}
+}
+
+func TestSelectorConfigValidate(t *testing.T) {
+	config := SelectorConfig{
+		Version: 2,
+		EtfDetails: map[string]FieldSpec{
+			"isin":                         {Type: FieldTypeText},
+			"securities_lending_permitted": {Type: FieldTypeBoolean, Selector: ".x"},
+			"exchanges":                    {Type: "table", Selector: ".x"},
+		},
+		ListPage: map[string]FieldSpec{"rows": {Type: FieldTypeList, Selector: "tr"}},
+	}
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{
+		"unsupported version 2",
+		"list_page.rendered_page: missing",
+		"etf_details.isin: selector missing",
+		"etf_details.securities_lending_permitted: true_value missing",
+		`etf_details.exchanges: unknown type "table"`,
+		"list_page.rows: fields missing",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("validation error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestExtractLabelsIgnoresRowOrder(t *testing.T) {
+	snapshot := `<div class="etf-profile-page-basic-informations"><div class="show-more-cards-wrapper">
+		<div class="show-more-card base-data"><div><div class="content">
+			<div><span class="left-side">Sondervermögen</span><span class="right-side">Ja</span></div>
+			<div><span class="left-side">Neue Zeile</span><span class="right-side">Neuer Wert</span></div>
+			<div><span class="left-side"> fondsdomizil: </span><span class="right-side">Luxemburg</span></div>
+			<div><span class="left-side">Index</span><span class="right-side">MSCI ACWI</span></div>
+		</div></div></div>
+		<div class="show-more-card legal-structure"><div><div class="content">
+			<div><span class="left-side">Depotbank</span><span class="right-side">BNP Paribas</span></div>
+		</div></div></div>
+	</div></div>`
+
+	details, err := newTestExtractor(t).ExtractEtfDetails("lu0000000000", strings.NewReader(snapshot))
+	if err != nil {
+		t.Fatalf("ExtractEtfDetails: %v", err)
+	}
+
+	if !details.HasSpecialAssets {
+		t.Error("HasSpecialAssets = false, want true")
+	}
+	if details.FundDomicile != "Luxemburg" {
+		t.Errorf("FundDomicile = %q, want %q", details.FundDomicile, "Luxemburg")
+	}
+	if details.BaseIndex != "MSCI ACWI" {
+		t.Errorf("BaseIndex = %q, want %q", details.BaseIndex, "MSCI ACWI")
+	}
+	if details.Depotbank != "BNP Paribas" {
+		t.Errorf("Depotbank = %q, want %q", details.Depotbank, "BNP Paribas")
+	}
+	if details.ShareClassVolume != "" {
+		t.Errorf("ShareClassVolume = %q, want empty", details.ShareClassVolume)
+	}
+	if got := details.AdditionalAttributes["Neue Zeile"]; got != "Neuer Wert" {
+		t.Errorf(`AdditionalAttributes["Neue Zeile"] = %q, want %q`, got, "Neuer Wert")
+	}
+}
@@ -1,90 +1,260 @@
 package scraper
 
 import (
+	"backend/config"
 	"backend/db"
+	"backend/parse"
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strconv"
+	"math"
 	"strings"
 	"time"
 
 	"github.com/chromedp/chromedp"
 )
 
-func ScrapeList() {
+// ScrapeList scrapes all result pages of the etf search.
+// With resume set, an interrupted run continues after its last completed page,
+// unless the number of search results changed since, in which case a new run is started.
+// ErrRunDegraded is returned if the run finished or was aborted with signs of changed markup.
+// Cancelling ctx stops the run after the current page. It is recorded as failed and can be resumed.
+func ScrapeList(ctx context.Context, repo db.EtfRepository, cfg config.Scraper, resume bool) error {
+	// The outcome of pages and the run is recorded even if ctx got cancelled
+	recordCtx := context.WithoutCancel(ctx)
 
 	const urlBaseSrting = "https://www.finanzfluss.de/informer/etf/suche?page=%d&per=100"
 
 	log.Println("Starting list scraper ...")
 
-	ctx, cancel := getChromdpCtx()
+	browserCtx, cancel := getChromdpCtx(ctx, cfg.Chrome)
 	defer cancel() // Make sure to clean up when done.
 
-	var maxPage int
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(fmt.Sprintf(urlBaseSrting, 1)),
-		getMaxPage(&maxPage),
-	)
-	if err != nil {
-		log.Printf("Failed to execute chromedp tasks: %v", err)
+	// Start the browser on browserCtx, otherwise it is tied to the timeout of the first page load
+	if err := chromedp.Run(browserCtx); err != nil {
+		return fmt.Errorf("starting browser: %w", err)
 	}
 
-	var currPage = 1
-	log.Println("Maxpage:", maxPage)
-	var renderedPageNr int
-
-	for currPage <= maxPage {
-		var url = fmt.Sprintf(urlBaseSrting, currPage)
-		log.Println("##### Scraping url ", url)
+	retryPolicy := NewRetryPolicy(cfg)
+	// How often a page is reloaded when a different page than requested got rendered
+	maxPageMismatches := cfg.MaxPageMismatches
+	selectorConfig, err := LoadSelectorConfig(cfg.SelectorsFile)
+	if err != nil {
+		return fmt.Errorf("loading selector config: %w", err)
+	}
+	extractor := NewHtmlExtractor(selectorConfig)
 
-		err := chromedp.Run(ctx,
+	// loadPage loads a search results page and extracts it from a snapshot of the rendered html
+	loadPage := func(ctx context.Context, url string) (ListPage, error) {
+		attemptCtx, attemptCancel := context.WithTimeout(ctx, navigationTimeout)
+		defer attemptCancel()
+		var snapshot string
+		err := chromedp.Run(attemptCtx,
 			chromedp.Navigate(url),
 			closePopup(),
 			awaitTableLoad(),
-			getRenderedPage(&renderedPageNr),
+			pageSnapshot(&snapshot),
 		)
 		if err != nil {
-			log.Printf("Failed to execute chromedp tasks: %v", err)
-		}
-		if renderedPageNr == currPage {
-			err := chromedp.Run(ctx,
-				scrapeList(),
-			)
-			if err != nil {
-				log.Printf("Failed to execute chromedp tasks: %v", err)
+			return ListPage{}, err
+		}
+		return extractor.ExtractListPage(strings.NewReader(snapshot))
+	}
+
+	var firstPage ListPage
+	err = retryPolicy.Do(browserCtx, "Reading result count", func(ctx context.Context, attempt int) error {
+		var err error
+		firstPage, err = loadPage(ctx, fmt.Sprintf(urlBaseSrting, 1))
+		if err == nil && firstPage.ResultCount == 0 {
+			err = fmt.Errorf("%w: no result count found", errEvaluation)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("reading result count: %w", err)
+	}
+	var resultCount = firstPage.ResultCount
+	var maxPage = int(math.Ceil(float64(resultCount) / 100))
+
+	checkpoint := startOrResumeListRun(ctx, repo, resume, resultCount, maxPage)
+	runId := checkpoint.RunId
+
+	var currPage = checkpoint.LastCompletedPage + 1
+	log.Println("Maxpage:", maxPage, "Starting at page:", currPage)
+	var mismatches = 0
+	var failedPages []int
+	var sessionUpserted db.UpsertResult
+	detector := NewDriftDetector(NewDriftConfig(cfg))
+
+	var pageStart = time.Now()
+
+	// completePage records the outcome of the current page and moves on to the next one
+	completePage := func(status taskStatus, err error) {
+		recordItemResult(recordCtx, repo, runId, pageItemId(currPage), status, err, time.Since(pageStart))
+		if status == statusFailed {
+			failedPages = append(failedPages, currPage)
+		}
+		checkpoint.LastCompletedPage = currPage
+		if runId != 0 {
+			if err := repo.SaveListCheckpoint(recordCtx, checkpoint); err != nil {
+				log.Printf("Failed to save checkpoint for page %d: %v", currPage, err)
 			}
+		}
+		currPage++
+		mismatches = 0
+	}
+
+	for currPage <= maxPage && ctx.Err() == nil {
+		var url = fmt.Sprintf(urlBaseSrting, currPage)
+		log.Println("##### Scraping url ", url)
+		if mismatches == 0 {
+			pageStart = time.Now()
+		}
+
+		var page ListPage
+		err := retryPolicy.Do(browserCtx, fmt.Sprint("Loading page ", currPage), func(ctx context.Context, attempt int) error {
+			var err error
+			page, err = loadPage(ctx, url)
+			return err
+		})
+		if err != nil {
+			log.Printf("Giving up on page %d: %v", currPage, err)
+			completePage(statusFailed, err)
+			continue
+		}
+
+		renderedPageNr := page.RenderedPage
+		if renderedPageNr != currPage {
+			mismatches++
+			if mismatches > maxPageMismatches {
+				log.Println("renderedPageNr", renderedPageNr, "still does not equal targeted pagenr", currPage, "after", maxPageMismatches, "reloads - Skipping this page")
+				completePage(statusFailed, fmt.Errorf("rendered page %d instead of %d", renderedPageNr, currPage))
+				continue
+			}
+			log.Println("renderedPageNr", renderedPageNr, "does not equal targeted pagenr", currPage, "- Redoing this page")
+			sleep(ctx, retryPolicy.Backoff(mismatches))
+			continue
+		}
+
+		for _, row := range page.Rows {
+			detector.ObserveItem(row)
+		}
+		if detector.ObserveEmpty(len(page.Rows) == 0, "list pages without rows") {
+			log.Println("Aborting list scraper: too many consecutive pages without rows")
+			completePage(statusSkipped, fmt.Errorf("%w: no rows found", errEvaluation))
+			break
+		}
+
+		var upserted db.UpsertResult
+		err = retryPolicy.Do(recordCtx, fmt.Sprint("Saving page ", currPage), func(ctx context.Context, attempt int) error {
+			var err error
+			upserted, err = saveListRows(ctx, repo, page.Rows)
+			return err
+		})
+		log.Printf("Page %d: inserted %d, updated %d, unchanged %d", currPage, upserted.Inserted, upserted.Updated, upserted.Unchanged)
+		sessionUpserted.Add(upserted)
+		if runId != 0 {
+			if err := repo.AddScrapeRunUpsertCounts(recordCtx, runId, upserted); err != nil {
+				log.Printf("Failed to record upsert counts of page %d: %v", currPage, err)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to scrape page %d: %v", currPage, err)
+			completePage(statusFailed, err)
+		} else {
 			log.Println("Page", currPage, "scraped successfully!")
-			currPage++
+			completePage(statusSucceeded, nil)
+		}
+	}
+
+	log.Printf("List scraper finished: failed pages in this session: %v, inserted %d, updated %d, unchanged %d etfs",
+		failedPages, sessionUpserted.Inserted, sessionUpserted.Updated, sessionUpserted.Unchanged)
+	if err := ctx.Err(); err != nil {
+		if runId != 0 {
+			succeeded, skipped, failed, _ := repo.CountScrapeItemResults(recordCtx, runId)
+			finishScrapeRun(recordCtx, repo, runId, db.ScrapeRunStatusFailed, "interrupted", succeeded, skipped, failed)
+		}
+		return fmt.Errorf("list scraper interrupted after page %d: %w", checkpoint.LastCompletedPage, err)
+	}
+	reason := finishDriftCheck(recordCtx, repo, runId, db.ScrapeRunKindList, detector)
+	if runId != 0 {
+		succeeded, skipped, failed, err := repo.CountScrapeItemResults(recordCtx, runId)
+		if err != nil {
+			log.Printf("Failed to count results of scrape run %d: %v", runId, err)
+		}
+		if reason != "" {
+			finishScrapeRun(recordCtx, repo, runId, db.ScrapeRunStatusDegraded, reason, succeeded, skipped, failed)
 		} else {
-			log.Println("renderedPageNr", renderedPageNr, "does not equal targeted pagenr", currPage, "- Redoing this page")
+			finishScrapeRun(recordCtx, repo, runId, db.ScrapeRunStatusCompleted, "", succeeded, skipped, failed)
+		}
+		// Only a run that saw every page can tell which etfs are gone
+		if reason == "" && err == nil && skipped == 0 && failed == 0 {
+			reconcileListRun(recordCtx, repo, runId, cfg.DelistAfterMisses)
 		}
 	}
+	if reason != "" {
+		return fmt.Errorf("%w: %s", ErrRunDegraded, reason)
+	}
+	return nil
 }
 
-func getRenderedPage(renderedPageNr *int) chromedp.Tasks {
-	return chromedp.Tasks{
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			err := chromedp.Evaluate(`parseInt(document.querySelector("button.pagination-number.current-number").innerText)`, &renderedPageNr).Do(ctx)
-			if err != nil {
-				return fmt.Errorf("Error evaluating renderedPageNr: %w", err)
-			}
-			return nil
-		}),
+// reconcileListRun marks the etfs that were not in the search results of the complete run as missing or delisted
+// after delistAfterMisses complete runs in a row.
+func reconcileListRun(ctx context.Context, repo db.EtfRepository, runId int64, delistAfterMisses int) {
+	run, err := repo.GetScrapeRun(ctx, runId)
+	if err != nil {
+		log.Printf("Failed to load scrape run %d: %v", runId, err)
+		return
 	}
-
+	reconciliation, err := repo.ReconcileListRun(ctx, run.StartedAt, delistAfterMisses)
+	if err != nil {
+		log.Printf("Failed to reconcile etfs with run %d: %v", runId, err)
+		return
+	}
+	log.Printf("Etfs missing from the search results: %d, newly delisted: %d", reconciliation.Missing, reconciliation.Delisted)
 }
 
-func getMaxPage(maxPage *int) chromedp.Tasks {
-	return chromedp.Tasks{
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			err := chromedp.Evaluate(`Math.ceil(parseInt(document.querySelector(".result-number").innerText.replaceAll('.', '')) /100)`, &maxPage).Do(ctx)
-			if err != nil {
-				return fmt.Errorf("error evaluating maxPage: %w", err)
+// startOrResumeListRun returns the checkpoint to continue from.
+// A resumable run is only picked up if resume is set and the result count did not change.
+// If recording the run fails, a checkpoint with RunId 0 starting at page 1 is returned.
+func startOrResumeListRun(ctx context.Context, repo db.EtfRepository, resume bool, resultCount int, maxPage int) db.ListCheckpoint {
+	if resume {
+		run, checkpoint, err := repo.GetResumableListRun(ctx)
+		switch {
+		case errors.Is(err, db.ErrNotFound):
+			log.Println("No interrupted list run to resume. Starting a new run")
+		case err != nil:
+			log.Printf("Failed to look up interrupted list run: %v. Starting a new run", err)
+		case checkpoint.TotalResults != resultCount:
+			log.Printf("Result count changed from %d to %d since run %d was interrupted. Invalidating its checkpoint and starting a new run",
+				checkpoint.TotalResults, resultCount, run.Id)
+			finishScrapeRun(ctx, repo, run.Id, db.ScrapeRunStatusAbandoned, "result count changed", run.ItemsSucceeded, run.ItemsSkipped, run.ItemsFailed)
+		default:
+			if err := repo.ResumeScrapeRun(ctx, run.Id); err != nil {
+				log.Printf("Failed to mark run %d as resumed: %v", run.Id, err)
 			}
-			return nil
-		}),
+			log.Println("Resuming list run", run.Id, "after page", checkpoint.LastCompletedPage, "of", checkpoint.TotalPages)
+			return checkpoint
+		}
 	}
+
+	checkpoint := db.ListCheckpoint{TotalResults: resultCount, TotalPages: maxPage}
+	runId, err := repo.StartScrapeRun(ctx, db.ScrapeRunKindList, maxPage)
+	if err != nil {
+		log.Printf("Failed to record scrape run: %v", err)
+		return checkpoint
+	}
+	checkpoint.RunId = runId
+	if err := repo.SaveListCheckpoint(ctx, checkpoint); err != nil {
+		log.Printf("Failed to save initial checkpoint: %v", err)
+	}
+	return checkpoint
+}
+
+// pageItemId is the item id list pages are recorded under in t_scrape_item_result.
+func pageItemId(page int) string {
+	return fmt.Sprint("page-", page)
 }
 
 func awaitTableLoad() chromedp.Tasks {
@@ -100,7 +270,7 @@ func awaitTableLoad() chromedp.Tasks {
 				// Evaluate the number of rows in the table
 				err := chromedp.Evaluate(`document.querySelectorAll(".results-table tbody tr").length`, &numRows).Do(ctx)
 				if err != nil {
-					return fmt.Errorf("error evaluating row count: %w", err)
+					return fmt.Errorf("%w: row count: %w", errEvaluation, err)
 				}
 
 				// Check if we have 100 rows (or if it's the last page with fewer)
@@ -115,8 +285,9 @@ func awaitTableLoad() chromedp.Tasks {
 					break
 				}
 
-				// Optionally, you can wait a little before trying again
-				time.Sleep(200 * time.Millisecond)
+				if !sleep(ctx, 200*time.Millisecond) {
+					return ctx.Err()
+				}
 			}
 
 			return nil
@@ -124,61 +295,56 @@ func awaitTableLoad() chromedp.Tasks {
 	}
 }
 
-func scrapeList() chromedp.Tasks {
-	return chromedp.Tasks{
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			var results []map[string]string
-			err := chromedp.Evaluate(`Array.from(document.querySelectorAll('#main > div.page-content > div > div.informer-search > div.main-content > div.results-table > div > div.table-container > table > tbody > tr')).map(el => {
-        url = el.querySelector('.name a')?.href;
-        if (url.endsWith('/')) {
-            url = url.substring(0, url.length-1)
-        };
-        id = url.split('/').pop();
-        return {
-          id: id,
-					name: el.querySelector('.name')?.innerText,
-					totalExpenseRatio: el.querySelector('.totalExpenseRatio')?.innerText,
-					isDistributing: (!!el.querySelector('svg path[d^="M21.8371"]')).toString() || "false",
-					replicationMethod: el.querySelector('.replicationMethod')?.innerText,
-					fundVolume: el.querySelector('.fundVolume')?.innerText,
-					shareClassVolume: el.querySelector('.shareClassVolume')?.innerText,
-					releaseDate: el.querySelector('.releaseDate')?.innerText,
-				};
-			})`, &results).Do(ctx)
-			if err != nil {
-				return err
-			}
-
-			var insertedCount = 0
+// saveListRows parses the displayed values of the rows and upserts them into t_etf in one batch.
+// Invalid rows are skipped, their errors are returned after all other rows are saved.
+// The returned counts are valid as long as the batch was written, even if rows were skipped.
+func saveListRows(ctx context.Context, repo db.EtfRepository, rows []ListRow) (db.UpsertResult, error) {
+	batch := make([]db.EtfBaseData, 0, len(rows))
+	var errs []error
 
-			for _, result := range results {
-				var isDistributing, err_isDistributing = strconv.ParseBool(result["isDistributing"])
-				if err_isDistributing != nil {
-					fmt.Println("Error parsing isDistributing:", err_isDistributing)
-				}
-				var releaseDate, err_releaseDate = time.Parse("02.01.06", result["releaseDate"]) // Layout for DD.MM.YY
-				if err_releaseDate != nil {
-					fmt.Println("Error parsing releaseDate:", err_releaseDate)
-				}
-				var totalExpenseRatio = strings.TrimSpace(result["totalExpenseRatio"])
-				totalExpenseRatio = strings.TrimSuffix(totalExpenseRatio, "%")
-				totalExpenseRatio = strings.ReplaceAll(totalExpenseRatio, "\u00a0", "")
-				totalExpenseRatio = strings.ReplaceAll(totalExpenseRatio, ",", ".")
-				if totalExpenseRatio == "—" {
-					totalExpenseRatio = "0"
-				}
-				var totalExpenseRatioFloat, err_totalExpenseRatio = strconv.ParseFloat(totalExpenseRatio, 32)
-				totalExpenseRatioFloat = totalExpenseRatioFloat / 100
-				if err_totalExpenseRatio != nil {
-					fmt.Println("Error parsing totalExpenseRatio:", err_totalExpenseRatio)
-				}
-				db.InsertOrUpdateEtf(result["id"], result["name"], result["fundVolume"], isDistributing, releaseDate, result["replicationMethod"], result["shareClassVolume"], float32(totalExpenseRatioFloat))
-				insertedCount++
-			}
+	for _, result := range rows {
+		var releaseDate, err_releaseDate = time.Parse("02.01.06", result.ReleaseDate) // Layout for DD.MM.YY
+		if err_releaseDate != nil {
+			fmt.Println("Error parsing releaseDate:", err_releaseDate)
+		}
+		var totalExpenseRatio, err_totalExpenseRatio = parse.Percent(result.TotalExpenseRatio)
+		if err_totalExpenseRatio != nil {
+			fmt.Println("Error parsing totalExpenseRatio:", err_totalExpenseRatio)
+		}
+		var fundVolume, err_fundVolume = parse.Volume(result.FundVolume)
+		if err_fundVolume != nil {
+			fmt.Println("Error parsing fundVolume:", err_fundVolume)
+		}
+		var shareClassVolume, err_shareClassVolume = parse.Volume(result.ShareClassVolume)
+		if err_shareClassVolume != nil {
+			fmt.Println("Error parsing shareClassVolume:", err_shareClassVolume)
+		}
+		data := db.EtfBaseData{
+			Id:                  result.Id,
+			Name:                result.Name,
+			FundVolume:          result.FundVolume,
+			IsDistributing:      result.IsDistributing,
+			ReleaseDate:         releaseDate,
+			ReplicationMethod:   result.ReplicationMethod,
+			ShareClassVolume:    result.ShareClassVolume,
+			TotalExpenseRatio:   totalExpenseRatio,
+			FundVolumeEur:       fundVolume.InBaseCurrency(),
+			ShareClassVolumeEur: shareClassVolume.InBaseCurrency(),
+		}
+		if err := data.Validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		batch = append(batch, data)
+	}
 
-			log.Println("Inserted/Updated Count:", insertedCount)
+	upserted, err := repo.UpsertEtfs(ctx, batch)
+	if err != nil {
+		return db.UpsertResult{}, fmt.Errorf("%w: %w", errDatabase, err)
+	}
 
-			return nil
-		}),
+	if len(errs) > 0 {
+		return upserted, fmt.Errorf("%w: %d of %d rows: %w", errDatabase, len(errs), len(rows), errors.Join(errs...))
 	}
+	return upserted, nil
 }
@@ -0,0 +1,96 @@
+package scraper
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket shared by all workers.
+// Tokens refill continuously at rate per second up to burst.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   requestsPerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done.
+// A limiter with a rate <= 0 never blocks.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// HostRateLimiter keeps one RateLimiter per host so every site gets its own budget.
+type HostRateLimiter struct {
+	mu                sync.Mutex
+	requestsPerSecond float64
+	burst             int
+	limiters          map[string]*RateLimiter
+}
+
+func NewHostRateLimiter(requestsPerSecond float64, burst int) *HostRateLimiter {
+	return &HostRateLimiter{
+		requestsPerSecond: requestsPerSecond,
+		burst:             burst,
+		limiters:          map[string]*RateLimiter{},
+	}
+}
+
+// Wait blocks until a request to rawUrl's host is allowed.
+func (h *HostRateLimiter) Wait(ctx context.Context, rawUrl string) error {
+	host := rawUrl
+	if parsed, err := url.Parse(rawUrl); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+
+	h.mu.Lock()
+	limiter, ok := h.limiters[host]
+	if !ok {
+		limiter = NewRateLimiter(h.requestsPerSecond, h.burst)
+		h.limiters[host] = limiter
+	}
+	h.mu.Unlock()
+
+	return limiter.Wait(ctx)
+}
@@ -0,0 +1,63 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	ctx := context.Background()
+	// Refills a token every 1000 s, so only the burst is available
+	limiter := NewRateLimiter(0.001, 3)
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			t.Fatalf("wait %d within the burst: %v", i+1, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait after the burst = %v, want the deadline of ctx", err)
+	}
+}
+
+func TestRateLimiterRate(t *testing.T) {
+	limiter := NewRateLimiter(200, 1)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first request uses the burst, the other 4 wait 5 ms each
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("5 requests at 200/s took %v, want at least 20ms", elapsed)
+	}
+
+	unlimited := NewRateLimiter(0, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 10; i++ {
+		if err := unlimited.Wait(ctx); err != nil {
+			t.Fatalf("limiter without rate: %v", err)
+		}
+	}
+}
+
+func TestHostRateLimiter(t *testing.T) {
+	limiter := NewHostRateLimiter(0.001, 1)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, url := range []string{"https://a.example/etf/1", "https://b.example/etf/1"} {
+		if err := limiter.Wait(context.Background(), url); err != nil {
+			t.Fatalf("first request to %s: %v", url, err)
+		}
+	}
+	if err := limiter.Wait(cancelled, "https://a.example/etf/2"); !errors.Is(err, context.Canceled) {
+		t.Errorf("second request to a.example = %v, want to wait for its own budget until cancelled", err)
+	}
+}
@@ -0,0 +1,76 @@
+package scraper
+
+import (
+	"backend/db"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveListRows(t *testing.T) {
+	ctx := context.Background()
+	page, err := newTestExtractor(t).ExtractListPage(openFixture(t, "etf_search.html"))
+	if err != nil {
+		t.Fatalf("ExtractListPage: %v", err)
+	}
+	repo := db.NewMemoryRepository()
+	if upserted, err := saveListRows(ctx, repo, page.Rows); err != nil || upserted.Inserted != 4 {
+		t.Fatalf("saveListRows = %+v, %v, want 4 inserted etfs", upserted, err)
+	}
+	if upserted, _ := saveListRows(ctx, repo, page.Rows); upserted != (db.UpsertResult{Unchanged: 4}) {
+		t.Errorf("saving the page again = %+v, want 4 unchanged etfs", upserted)
+	}
+
+	ids, _ := repo.GetAllIdsWhereNoDetails(ctx)
+	if len(ids) != 4 {
+		t.Fatalf("got %d etfs without details, want 4", len(ids))
+	}
+
+	snapshot, err := repo.GetEtfAsOf(ctx, "lu2572257124", time.Now())
+	if err != nil {
+		t.Fatalf("GetEtfAsOf: %v", err)
+	}
+	for _, want := range []string{`"totalexpenseratio":null`, `"fund_volume_eur":845120000`, `"share_class_volume_eur":null`, `"releasedate":"2023-03-01"`} {
+		if !strings.Contains(string(snapshot.Data), want) {
+			t.Errorf("snapshot %s does not contain %s", snapshot.Data, want)
+		}
+	}
+}
+
+func TestFinishDriftCheck(t *testing.T) {
+	ctx := context.Background()
+	repo := db.NewMemoryRepository()
+	config := DriftConfig{MaxFillRateDrop: 0.25, BaselineRuns: 5, MinSamples: 2}
+
+	previousRun, _ := repo.StartScrapeRun(ctx, db.ScrapeRunKindList, 1)
+	repo.SaveScrapeRunFieldStats(ctx, previousRun, []db.FieldStat{{Field: "name", Filled: 10, Total: 10}, {Field: "fund_volume", Filled: 10, Total: 10}})
+	repo.FinishScrapeRun(ctx, previousRun, db.ScrapeRunStatusCompleted, "", 1, 0, 0)
+
+	runId, _ := repo.StartScrapeRun(ctx, db.ScrapeRunKindList, 1)
+	detector := NewDriftDetector(config)
+	for i := 0; i < 4; i++ {
+		detector.ObserveItem(ListRow{Id: "x", Name: "Fund"})
+	}
+
+	reason := finishDriftCheck(ctx, repo, runId, db.ScrapeRunKindList, detector)
+	if !strings.Contains(reason, "fund_volume filled 0% (baseline 100%)") || strings.Contains(reason, "name") {
+		t.Errorf("reason = %q, want only fund_volume to be degraded", reason)
+	}
+}
+
+func TestSaveListRowsRejected(t *testing.T) {
+	ctx := context.Background()
+	repo := db.NewMemoryRepository()
+	upserted, err := saveListRows(ctx, repo, []ListRow{{Id: "a", Name: "Fund a"}, {Id: "b"}, {Id: "c", Name: "Fund c"}})
+	if !errors.Is(err, db.ErrValidation) || ClassifyError(err) != ErrorClassRejected {
+		t.Fatalf("saveListRows = %v, want a validation error that is not retried", err)
+	}
+	if upserted.Inserted != 2 {
+		t.Errorf("upserted = %+v, want the two valid rows inserted", upserted)
+	}
+	if ids, _ := repo.GetAllIds(ctx); len(ids) != 2 {
+		t.Errorf("saved %v, want the two valid rows", ids)
+	}
+}
@@ -0,0 +1,167 @@
+package scraper
+
+import (
+	"backend/config"
+	"backend/db"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// ErrorClass groups scrape errors that share the same retry behaviour.
+type ErrorClass int
+
+const (
+	ErrorClassUnknown ErrorClass = iota
+	ErrorClassNavigationTimeout
+	ErrorClassIsinMissing
+	ErrorClassEvaluation
+	ErrorClassDatabase
+	ErrorClassRejected
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassNavigationTimeout:
+		return "navigation timeout"
+	case ErrorClassIsinMissing:
+		return "isin missing"
+	case ErrorClassEvaluation:
+		return "evaluation error"
+	case ErrorClassDatabase:
+		return "database error"
+	case ErrorClassRejected:
+		return "rejected by database"
+	default:
+		return "unknown error"
+	}
+}
+
+// Sentinel errors wrapped by the scrape tasks so failures can be classified.
+var (
+	errIsinMissing = errors.New("isin didnt show")
+	errEvaluation  = errors.New("evaluation failed")
+	errDatabase    = errors.New("database error")
+)
+
+func ClassifyError(err error) ErrorClass {
+	switch {
+	case err == nil:
+		return ErrorClassUnknown
+	case errors.Is(err, errIsinMissing):
+		return ErrorClassIsinMissing
+	// Retrying can't fix data the repository refuses to store
+	case errors.Is(err, db.ErrValidation), errors.Is(err, db.ErrConflict), errors.Is(err, db.ErrNotFound):
+		return ErrorClassRejected
+	case errors.Is(err, errDatabase):
+		return ErrorClassDatabase
+	case errors.Is(err, errEvaluation):
+		return ErrorClassEvaluation
+	case errors.Is(err, context.DeadlineExceeded),
+		strings.Contains(err.Error(), "net::ERR_TIMED_OUT"),
+		strings.Contains(err.Error(), "net::ERR_CONNECTION"),
+		strings.Contains(err.Error(), "net::ERR_NAME_NOT_RESOLVED"):
+		return ErrorClassNavigationTimeout
+	default:
+		return ErrorClassUnknown
+	}
+}
+
+// RetryRule overrides the policy for one error class.
+type RetryRule struct {
+	Retry       bool // Whether errors of this class are retried at all.
+	MaxAttempts int  // Total attempts for this class. 0 uses the policy default.
+}
+
+// RetryPolicy retries a task with exponential backoff and jitter.
+// The delay before attempt n+1 is BaseDelay * 2^(n-1), capped at MaxDelay and
+// randomized by +/- Jitter (a fraction of the delay).
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+	Rules       map[ErrorClass]RetryRule
+}
+
+func NewRetryPolicy(c config.Scraper) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: c.RetryMaxAttempts,
+		BaseDelay:   c.RetryBaseDelay,
+		MaxDelay:    c.RetryMaxDelay,
+		Jitter:      c.RetryJitter,
+		Rules: map[ErrorClass]RetryRule{
+			ErrorClassNavigationTimeout: {Retry: true},
+			// A missing isin is mostly a page without data. Give it one more chance to render.
+			ErrorClassIsinMissing: {Retry: true, MaxAttempts: 2},
+			ErrorClassEvaluation:  {Retry: true},
+			ErrorClassDatabase:    {Retry: true, MaxAttempts: 2},
+			ErrorClassRejected:    {Retry: false},
+			ErrorClassUnknown:     {Retry: true},
+		},
+	}
+}
+
+func (p RetryPolicy) maxAttempts(class ErrorClass) int {
+	rule, ok := p.Rules[class]
+	if ok && !rule.Retry {
+		return 1
+	}
+	if ok && rule.MaxAttempts > 0 {
+		return rule.MaxAttempts
+	}
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// Backoff returns the delay after the given (1 based) failed attempt.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// Do runs task until it succeeds, fails with a non retryable error or runs out of attempts.
+// The returned error is the last one encountered.
+func (p RetryPolicy) Do(ctx context.Context, name string, task func(ctx context.Context, attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := task(ctx, attempt)
+		if err == nil {
+			return nil
+		}
+
+		class := ClassifyError(err)
+		if attempt >= p.maxAttempts(class) {
+			return err
+		}
+
+		delay := p.Backoff(attempt)
+		log.Printf("%s failed (attempt %d, %s): %v. Retrying in %v", name, attempt, class, err, delay.Round(time.Millisecond))
+		if !sleep(ctx, delay) {
+			return err
+		}
+	}
+}
+
+// sleep waits for delay and returns false if ctx is done before.
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,126 @@
+package scraper
+
+import (
+	"backend/config"
+	"backend/db"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	policy := NewRetryPolicy(config.Scraper{RetryMaxAttempts: 4})
+	for _, test := range []struct {
+		err         error
+		class       ErrorClass
+		maxAttempts int
+	}{
+		{fmt.Errorf("scraping a: %w", context.DeadlineExceeded), ErrorClassNavigationTimeout, 4},
+		{errors.New("page load error net::ERR_CONNECTION_RESET"), ErrorClassNavigationTimeout, 4},
+		{errors.New("page load error net::ERR_NAME_NOT_RESOLVED"), ErrorClassNavigationTimeout, 4},
+		{fmt.Errorf("scraping a: %w", errIsinMissing), ErrorClassIsinMissing, 2},
+		{fmt.Errorf("%w: reading isin", errEvaluation), ErrorClassEvaluation, 4},
+		{fmt.Errorf("%w: connection refused", errDatabase), ErrorClassDatabase, 2},
+		// The repository refusing the data wins over the database error it is wrapped in
+		{fmt.Errorf("%w: %w", errDatabase, db.ErrValidation), ErrorClassRejected, 1},
+		{fmt.Errorf("%w: %w", errDatabase, db.ErrConflict), ErrorClassRejected, 1},
+		{fmt.Errorf("%w: %w", errDatabase, db.ErrNotFound), ErrorClassRejected, 1},
+		{errors.New("something else"), ErrorClassUnknown, 4},
+	} {
+		if class := ClassifyError(test.err); class != test.class {
+			t.Errorf("ClassifyError(%v) = %s, want %s", test.err, class, test.class)
+		}
+		if maxAttempts := policy.maxAttempts(test.class); maxAttempts != test.maxAttempts {
+			t.Errorf("maxAttempts(%s) = %d, want %d", test.class, maxAttempts, test.maxAttempts)
+		}
+	}
+
+	if maxAttempts := (RetryPolicy{}).maxAttempts(ErrorClassUnknown); maxAttempts != 1 {
+		t.Errorf("maxAttempts without attempts configured = %d, want 1", maxAttempts)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 20: time.Second} {
+		if delay := policy.Backoff(attempt); delay != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempt, delay, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := policy.Backoff(5); delay < 500*time.Millisecond || delay > 1500*time.Millisecond {
+			t.Fatalf("Backoff(5) with jitter = %v, want the capped delay +/- 50%%", delay)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := NewRetryPolicy(config.Scraper{RetryMaxAttempts: 3, RetryBaseDelay: time.Millisecond})
+	for _, test := range []struct {
+		err      error
+		attempts int
+	}{
+		{errEvaluation, 3},
+		{errIsinMissing, 2},
+		{db.ErrValidation, 1},
+	} {
+		attempts := 0
+		err := policy.Do(context.Background(), "test", func(ctx context.Context, attempt int) error {
+			attempts++
+			return test.err
+		})
+		if !errors.Is(err, test.err) || attempts != test.attempts {
+			t.Errorf("Do with %v = %v after %d attempts, want %d attempts", test.err, err, attempts, test.attempts)
+		}
+	}
+
+	attempts := 0
+	err := policy.Do(context.Background(), "test", func(ctx context.Context, attempt int) error {
+		if attempts++; attempt < 2 {
+			return errEvaluation
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("Do succeeding on the second attempt = %v after %d attempts", err, attempts)
+	}
+}
+
+func TestRetryPolicyDoStopsWhenCancelled(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	done := make(chan error)
+	go func() {
+		done <- policy.Do(ctx, "test", func(ctx context.Context, attempt int) error {
+			attempts++
+			return errEvaluation
+		})
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errEvaluation) || attempts != 1 {
+			t.Errorf("Do = %v after %d attempts, want the error of the only attempt", err, attempts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do kept waiting for the backoff after ctx was cancelled")
+	}
+}
+
+func TestSleep(t *testing.T) {
+	if !sleep(context.Background(), time.Millisecond) {
+		t.Error("sleep without cancellation = false, want true")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if sleep(ctx, time.Hour) || time.Since(start) > time.Second {
+		t.Error("sleep with a cancelled ctx did not return early")
+	}
+}
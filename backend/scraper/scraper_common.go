@@ -1,10 +1,13 @@
 package scraper
 
 import (
+	"backend/config"
+	"backend/db"
 	"context"
-	"fmt"
 	"log"
-	"os/user"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/chromedp/chromedp"
 )
@@ -25,32 +28,106 @@ func closePopup() chromedp.Tasks {
 	}
 }
 
-func getChromdpCtx() (context.Context, context.CancelFunc) {
-	// Specify the path to Chrome/Chromium executable
-	const CHROME_EXEC_PATH = "/Applications/Google Chrome.app/Contents/MacOS/Google Chrome"
-	var currentUser, _ = user.Current()
-	var username = currentUser.Username
-	var USER_DATA_DIR = fmt.Sprintf("/Users/%s/Library/Application Support/Google/Chrome/", username)
-	const PROFILE_DIRECTORY = "Default"
+// getChromdpCtx launches chrome, or attaches to a running one if a remote url is configured.
+// Cancelling ctx closes the browser.
+func getChromdpCtx(ctx context.Context, chrome config.Chrome) (context.Context, context.CancelFunc) {
+	// Attach to an already running chrome instead of launching one
+	if chrome.RemoteURL != "" {
+		log.Println("Attaching to remote chrome at", chrome.RemoteURL)
+		allocatorCtx, allocatorCancel := chromedp.NewRemoteAllocator(ctx, chrome.RemoteURL)
+		browserCtx, browserCancel := chromedp.NewContext(allocatorCtx)
+		return browserCtx, func() {
+			browserCancel()
+			allocatorCancel()
+		}
+	}
+
+	// Use an ephemeral profile if no persistent one is configured
+	userDataDir := chrome.UserDataDir
+	removeUserDataDir := func() {}
+	if userDataDir == "" {
+		tempDir, err := os.MkdirTemp("", "assetforge-chrome-")
+		if err != nil {
+			log.Printf("Error creating ephemeral chrome profile: %v", err)
+		} else {
+			userDataDir = tempDir
+			removeUserDataDir = func() { os.RemoveAll(tempDir) }
+		}
+	}
+
 	// options
 	opts := append(
 		chromedp.DefaultExecAllocatorOptions[:0], // No default options to provent chrome account login problems.
-		chromedp.ExecPath(CHROME_EXEC_PATH),
 		chromedp.DisableGPU,
-		chromedp.UserDataDir(USER_DATA_DIR),
-		chromedp.Flag("profile-directory", PROFILE_DIRECTORY),
-		chromedp.Flag("headless", false),
+		chromedp.NoFirstRun,
+		chromedp.NoDefaultBrowserCheck,
+		chromedp.WindowSize(chrome.WindowWidth, chrome.WindowHeight),
+		chromedp.Flag("headless", chrome.Headless),
 		chromedp.Flag("flag-switches-begin", true),
 		chromedp.Flag("flag-switches-end", true),
 		chromedp.Flag("enable-automation", false),
 		chromedp.Flag("disable-blink-features", "AutomationControlled"),
 		chromedp.Flag("new-window", true),
 	)
-	allocatorCtx, allocatorCancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	ctx, ctxCancel := chromedp.NewContext(allocatorCtx)
+	execPath := chrome.ExecPath
+	if execPath == "" {
+		execPath = findChromeExecPath()
+	}
+	if execPath != "" {
+		opts = append(opts, chromedp.ExecPath(execPath))
+	}
+	if userDataDir != "" {
+		opts = append(opts, chromedp.UserDataDir(userDataDir))
+	}
+	if chrome.ProfileDirectory != "" {
+		opts = append(opts, chromedp.Flag("profile-directory", chrome.ProfileDirectory))
+	}
+	if chrome.Headless {
+		opts = append(opts, chromedp.Flag("hide-scrollbars", true), chromedp.Flag("mute-audio", true))
+	}
+	if chrome.UserAgent != "" {
+		opts = append(opts, chromedp.UserAgent(chrome.UserAgent))
+	}
+	for _, flag := range chrome.ExtraFlags {
+		// Flags are given as "name" or "name=value"
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		if hasValue {
+			opts = append(opts, chromedp.Flag(name, value))
+		} else {
+			opts = append(opts, chromedp.Flag(name, true))
+		}
+	}
 
-	return ctx, func() {
-		ctxCancel()
+	log.Printf("Launching chrome (exec: %q, headless: %v, profile: %q)", execPath, chrome.Headless, userDataDir)
+	allocatorCtx, allocatorCancel := chromedp.NewExecAllocator(ctx, opts...)
+	browserCtx, browserCancel := chromedp.NewContext(allocatorCtx)
+
+	return browserCtx, func() {
+		browserCancel()
 		allocatorCancel()
+		removeUserDataDir()
+	}
+}
+
+// recordItemResult stores the outcome of a scraped item. Failing to record only gets logged.
+func recordItemResult(ctx context.Context, repo db.EtfRepository, runId int64, itemId string, status taskStatus, err error, duration time.Duration) {
+	if runId == 0 {
+		return
+	}
+	var errorMessage string
+	if err != nil {
+		errorMessage = err.Error()
+	}
+	if err := repo.InsertScrapeItemResult(ctx, runId, itemId, status.String(), errorMessage, duration); err != nil {
+		log.Printf("Failed to record result of %s: %v", itemId, err)
+	}
+}
+
+func finishScrapeRun(ctx context.Context, repo db.EtfRepository, runId int64, status string, statusReason string, succeeded int, skipped int, failed int) {
+	if runId == 0 {
+		return
+	}
+	if err := repo.FinishScrapeRun(ctx, runId, status, statusReason, succeeded, skipped, failed); err != nil {
+		log.Printf("Failed to record end of scrape run %d: %v", runId, err)
 	}
 }
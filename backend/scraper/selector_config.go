@@ -0,0 +1,187 @@
+package scraper
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Field extraction types of a FieldSpec.
+const (
+	FieldTypeText       = "text"       // innerText of the match
+	FieldTypeFirstText  = "first_text" // Text of the first child node of the match, e.g. a value followed by a bar element
+	FieldTypeBoolean    = "boolean"    // innerText of the match equals TrueValue
+	FieldTypeExists     = "exists"     // Whether the selector matches anything
+	FieldTypeAttribute  = "attribute"  // Value of attribute Attribute of the match
+	FieldTypeAttributes = "attributes" // Object of output key -> attribute value of the match
+	FieldTypeList       = "list"       // One object per match, built from Fields relative to the match
+)
+
+// Version of the selector config format this build understands.
+const selectorConfigVersion = 1
+
+//go:embed selectors.json
+var defaultSelectorConfig []byte
+
+// SelectorConfig maps the fields of the scraped pages to css selectors.
+// Keys of EtfDetails and fields of Labels are the json names of db.EtfDetailsData fields.
+type SelectorConfig struct {
+	Version int `json:"version"`
+	// Elements clicked before the etf profile is snapshotted, e.g. "show more" buttons.
+	ExpandSelectors []string             `json:"expand_selectors"`
+	EtfDetails      map[string]FieldSpec `json:"etf_details"`
+	// Cards of "label: value" rows on the etf profile, e.g. "Basisdaten".
+	LabelCards []LabelCardSpec `json:"label_cards,omitempty"`
+	// Dictionary of the (german) row labels of the label cards. Several labels may map to the same field.
+	Labels   map[string]LabelSpec `json:"labels,omitempty"`
+	ListPage map[string]FieldSpec `json:"list_page"`
+}
+
+// LabelCardSpec locates the rows of a label card and the label and value inside each row.
+type LabelCardSpec struct {
+	Name  string `json:"name"`
+	Rows  string `json:"rows"`
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// LabelSpec is the field a label card row is stored in.
+type LabelSpec struct {
+	Field     string `json:"field"`
+	TrueValue string `json:"true_value,omitempty"` // Makes the field a boolean that is true if the value equals TrueValue
+}
+
+// FieldSpec describes where a single field is found and how its value is read.
+type FieldSpec struct {
+	Type     string `json:"type"`
+	Selector string `json:"selector"`
+	// Which of the matches to read (0 based). Ignored for lists.
+	Index int `json:"index,omitempty"`
+	// Restricts the search to the WithinIndex-th match of Within.
+	Within      string `json:"within,omitempty"`
+	WithinIndex int    `json:"within_index,omitempty"`
+
+	TrueValue  string               `json:"true_value,omitempty"` // boolean
+	Attribute  string               `json:"attribute,omitempty"`  // attribute
+	Attributes map[string]string    `json:"attributes,omitempty"` // attributes
+	Fields     map[string]FieldSpec `json:"fields,omitempty"`     // list
+}
+
+// Fields the list scraper relies on. Other list page fields are ignored.
+var requiredListPageFields = []string{"rendered_page", "result_count", "rows"}
+
+// LoadSelectorConfig reads the selector config from path, or the embedded default if path is empty.
+func LoadSelectorConfig(path string) (SelectorConfig, error) {
+	var config SelectorConfig
+	data := defaultSelectorConfig
+	if path != "" {
+		log.Println("Using selector config", path)
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("reading selector config: %w", err)
+		}
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("parsing selector config %q: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid selector config %q: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate checks the config for unsupported versions, unknown types and missing selectors.
+func (c SelectorConfig) Validate() error {
+	var errs []error
+	if c.Version != selectorConfigVersion {
+		errs = append(errs, fmt.Errorf("unsupported version %d, expected %d", c.Version, selectorConfigVersion))
+	}
+	if len(c.EtfDetails) == 0 {
+		errs = append(errs, errors.New("etf_details: no fields configured"))
+	}
+	for _, name := range requiredListPageFields {
+		if _, ok := c.ListPage[name]; !ok {
+			errs = append(errs, fmt.Errorf("list_page.%s: missing", name))
+		}
+	}
+	for _, name := range sortedKeys(c.EtfDetails) {
+		errs = append(errs, c.EtfDetails[name].validate("etf_details."+name)...)
+	}
+	for i, card := range c.LabelCards {
+		if card.Rows == "" || card.Label == "" || card.Value == "" {
+			errs = append(errs, fmt.Errorf("label_cards[%d]: rows, label and value selectors are required", i))
+		}
+	}
+	if len(c.Labels) > 0 && len(c.LabelCards) == 0 {
+		errs = append(errs, errors.New("labels: no label_cards configured"))
+	}
+	fieldTypes := map[string]bool{}
+	for _, label := range sortedKeys(c.Labels) {
+		spec := c.Labels[label]
+		switch isBoolean, seen := fieldTypes[spec.Field]; {
+		case spec.Field == "":
+			errs = append(errs, fmt.Errorf("labels.%s: field missing", label))
+		case spec.Field == "additional_attributes":
+			errs = append(errs, fmt.Errorf("labels.%s: additional_attributes is reserved for unknown labels", label))
+		case c.EtfDetails[spec.Field].Type != "":
+			errs = append(errs, fmt.Errorf("labels.%s: field %s is already configured in etf_details", label, spec.Field))
+		case seen && isBoolean != (spec.TrueValue != ""):
+			errs = append(errs, fmt.Errorf("labels.%s: field %s is used as boolean and text", label, spec.Field))
+		}
+		fieldTypes[spec.Field] = spec.TrueValue != ""
+	}
+	for _, name := range sortedKeys(c.ListPage) {
+		errs = append(errs, c.ListPage[name].validate("list_page."+name)...)
+	}
+	return errors.Join(errs...)
+}
+
+func (f FieldSpec) validate(path string) []error {
+	var errs []error
+	if f.Selector == "" {
+		errs = append(errs, fmt.Errorf("%s: selector missing", path))
+	}
+	switch f.Type {
+	case FieldTypeText, FieldTypeFirstText, FieldTypeExists:
+	case FieldTypeBoolean:
+		if f.TrueValue == "" {
+			errs = append(errs, fmt.Errorf("%s: true_value missing", path))
+		}
+	case FieldTypeAttribute:
+		if f.Attribute == "" {
+			errs = append(errs, fmt.Errorf("%s: attribute missing", path))
+		}
+	case FieldTypeAttributes:
+		if len(f.Attributes) == 0 {
+			errs = append(errs, fmt.Errorf("%s: attributes missing", path))
+		}
+	case FieldTypeList:
+		if len(f.Fields) == 0 {
+			errs = append(errs, fmt.Errorf("%s: fields missing", path))
+		}
+		for _, name := range sortedKeys(f.Fields) {
+			errs = append(errs, f.Fields[name].validate(path+"."+name)...)
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s: unknown type %q", path, f.Type))
+	}
+	return errs
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
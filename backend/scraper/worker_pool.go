@@ -0,0 +1,165 @@
+package scraper
+
+import (
+	"backend/config"
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// PoolConfig controls how many tabs scrape in parallel and how fast requests are sent.
+type PoolConfig struct {
+	Concurrency       int     // Number of browser tabs working in parallel.
+	RequestsPerSecond float64 // Shared page loads per second per host. <= 0 disables limiting.
+	Burst             int     // Page loads allowed at once before the rate applies.
+}
+
+func NewPoolConfig(c config.Scraper) PoolConfig {
+	pool := PoolConfig{
+		Concurrency:       c.Concurrency,
+		RequestsPerSecond: c.RequestsPerSecond,
+		Burst:             c.Burst,
+	}
+	if pool.Concurrency < 1 {
+		pool.Concurrency = 1
+	}
+	return pool
+}
+
+type taskStatus int
+
+const (
+	statusSucceeded taskStatus = iota
+	statusSkipped
+	statusFailed
+)
+
+func (s taskStatus) String() string {
+	switch s {
+	case statusSucceeded:
+		return "succeeded"
+	case statusSkipped:
+		return "skipped"
+	default:
+		return "failed"
+	}
+}
+
+type taskResult struct {
+	Index    int
+	Id       string
+	Status   taskStatus
+	Err      error
+	Duration time.Duration
+}
+
+type poolSummary struct {
+	Succeeded int
+	Skipped   int
+	Failed    int
+	Duration  time.Duration
+}
+
+// taskFunc scrapes a single id inside the given tab context.
+type taskFunc func(tabCtx context.Context, id string) (taskStatus, error)
+
+// runPool distributes ids over config.Concurrency tabs of the browser behind browserCtx.
+// Progress is logged and passed to report in input order, regardless of the order tasks finish in.
+func runPool(browserCtx context.Context, config PoolConfig, ids []string, work taskFunc, report func(taskResult)) poolSummary {
+	start := time.Now()
+	tasks := make(chan int)
+	results := make(chan taskResult)
+
+	concurrency := config.Concurrency
+	if concurrency > len(ids) {
+		concurrency = len(ids)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each worker owns one tab of the shared browser
+			tabCtx, tabCancel := openTab(browserCtx)
+			defer tabCancel()
+
+			for index := range tasks {
+				taskStart := time.Now()
+				status, err := work(tabCtx, ids[index])
+				results <- taskResult{Index: index, Id: ids[index], Status: status, Err: err, Duration: time.Since(taskStart)}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(tasks)
+		for index := range ids {
+			// Don't hand out more tasks once cancelled, even if a worker is ready to take one
+			if browserCtx.Err() != nil {
+				return
+			}
+			select {
+			case tasks <- index:
+			case <-browserCtx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	summary := poolSummary{}
+	pending := map[int]taskResult{}
+	next := 0
+	for result := range results {
+		pending[result.Index] = result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			logTaskResult(result, len(ids))
+			if report != nil {
+				report(result)
+			}
+			switch result.Status {
+			case statusSucceeded:
+				summary.Succeeded++
+			case statusSkipped:
+				summary.Skipped++
+			default:
+				summary.Failed++
+			}
+		}
+	}
+
+	summary.Duration = time.Since(start)
+	return summary
+}
+
+// openTab opens a new tab of the browser behind browserCtx. Tests replace it to run the pool without a browser.
+var openTab = func(browserCtx context.Context) (context.Context, context.CancelFunc) {
+	tabCtx, tabCancel := chromedp.NewContext(browserCtx)
+	// Open the tab up front so per task timeouts don't tie its lifetime to a single task
+	if err := chromedp.Run(tabCtx); err != nil {
+		log.Printf("Failed to open tab: %v", err)
+	}
+	return tabCtx, tabCancel
+}
+
+func logTaskResult(result taskResult, total int) {
+	if result.Err != nil {
+		log.Printf("[%d/%d] %s %s after %v: %v", result.Index+1, total, result.Id, result.Status, result.Duration.Round(time.Millisecond), result.Err)
+		return
+	}
+	log.Printf("[%d/%d] %s %s after %v", result.Index+1, total, result.Id, result.Status, result.Duration.Round(time.Millisecond))
+}
@@ -0,0 +1,82 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// withoutBrowser makes runPool hand plain contexts to its workers instead of browser tabs.
+func withoutBrowser(t *testing.T) {
+	open := openTab
+	openTab = func(ctx context.Context) (context.Context, context.CancelFunc) { return context.WithCancel(ctx) }
+	t.Cleanup(func() { openTab = open })
+}
+
+func TestRunPoolReportsInInputOrder(t *testing.T) {
+	withoutBrowser(t)
+	ids := []string{"a", "b", "c", "d"}
+	// Each task waits for the one after it, so they finish in reverse order
+	finished := map[string]chan struct{}{}
+	for _, id := range ids {
+		finished[id] = make(chan struct{})
+	}
+	var mu sync.Mutex
+	var completed, reported []string
+
+	summary := runPool(context.Background(), PoolConfig{Concurrency: len(ids)}, ids, func(ctx context.Context, id string) (taskStatus, error) {
+		defer close(finished[id])
+		if i := slices.Index(ids, id); i+1 < len(ids) {
+			<-finished[ids[i+1]]
+		}
+		mu.Lock()
+		completed = append(completed, id)
+		mu.Unlock()
+		if id == "b" {
+			return statusFailed, errors.New("broken")
+		}
+		return statusSucceeded, nil
+	}, func(result taskResult) {
+		reported = append(reported, result.Id)
+	})
+
+	if !slices.Equal(completed, []string{"d", "c", "b", "a"}) {
+		t.Fatalf("tasks completed in order %v, want d, c, b, a", completed)
+	}
+	if !slices.Equal(reported, ids) {
+		t.Errorf("reported %v, want input order %v", reported, ids)
+	}
+	if summary.Succeeded != 3 || summary.Failed != 1 {
+		t.Errorf("summary = %+v, want 3 succeeded and 1 failed", summary)
+	}
+}
+
+func TestRunPoolStopsWhenCancelled(t *testing.T) {
+	withoutBrowser(t)
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = "etf"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	work := func(ctx context.Context, id string) (taskStatus, error) {
+		calls++
+		cancel()
+		return statusSucceeded, nil
+	}
+	if summary := runPool(ctx, PoolConfig{Concurrency: 1}, ids, work, nil); calls != 0 || summary.Succeeded != 0 {
+		t.Errorf("pool cancelled up front ran %d tasks, summary = %+v, want none", calls, summary)
+	}
+
+	// A task that cancels the pool lets at most the task handed out meanwhile run
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	summary := runPool(ctx, PoolConfig{Concurrency: 1}, ids, work, nil)
+	if calls < 1 || calls > 2 || summary.Succeeded != calls {
+		t.Errorf("pool cancelled by its first task ran %d tasks, summary = %+v, want 1 or 2", calls, summary)
+	}
+}
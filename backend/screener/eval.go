@@ -0,0 +1,108 @@
+package screener
+
+import (
+	"cmp"
+	"strings"
+)
+
+// Record provides the values of an etf to Match.
+type Record interface {
+	// Value returns the value of a t_etf column as float64, int64, string or bool, nil if it is null.
+	// Dates are "YYYY-MM-DD" strings.
+	Value(column string) any
+	// Weight returns the weight of a composition key as fraction, 0 if the etf has no such key.
+	Weight(dimension string, key string) float64
+}
+
+// Match evaluates the query like the condition returned by SQL, for repositories without a database.
+func (q *Query) Match(record Record) bool {
+	match, known := evaluate(q.root, record)
+	return match && known
+}
+
+// evaluate implements the three-valued logic of sql. Unknown results come from null values.
+func evaluate(e expr, record Record) (result bool, known bool) {
+	switch e := e.(type) {
+	case andExpr:
+		left, leftKnown := evaluate(e.left, record)
+		right, rightKnown := evaluate(e.right, record)
+		if (leftKnown && !left) || (rightKnown && !right) {
+			return false, true
+		}
+		return true, leftKnown && rightKnown
+	case orExpr:
+		left, leftKnown := evaluate(e.left, record)
+		right, rightKnown := evaluate(e.right, record)
+		if (leftKnown && left) || (rightKnown && right) {
+			return true, true
+		}
+		return false, leftKnown && rightKnown
+	case notExpr:
+		operand, known := evaluate(e.operand, record)
+		return !operand, known
+	case comparison:
+		return compare(e, record)
+	}
+	return false, false
+}
+
+func compare(c comparison, record Record) (bool, bool) {
+	var value any
+	if c.field.Keyed {
+		value = record.Weight(c.field.Column, c.key)
+	} else {
+		value = record.Value(strings.ToLower(c.field.Column))
+	}
+
+	var order int
+	ok := false
+	switch v := value.(type) {
+	case float64:
+		order, ok = compareTo(v, c.value)
+	case int64:
+		order, ok = compareTo(float64(v), c.value)
+	case bool:
+		if want, isBool := c.value.(bool); isBool {
+			order, ok = compareTo(boolInt(v), boolInt(want))
+		}
+	case string:
+		want, _ := c.value.(string)
+		if c.field.Type != TypeDate {
+			v, want = strings.ToLower(v), strings.ToLower(want)
+		}
+		if c.op == "~" {
+			return strings.Contains(v, want), true
+		}
+		order, ok = compareTo(v, want)
+	}
+	if !ok {
+		return false, false
+	}
+
+	switch c.op {
+	case "<":
+		return order < 0, true
+	case "<=":
+		return order <= 0, true
+	case ">":
+		return order > 0, true
+	case ">=":
+		return order >= 0, true
+	case "=":
+		return order == 0, true
+	}
+	return order != 0, true
+}
+
+// compareTo orders value and want, false if want is not of the same type
+func compareTo[T cmp.Ordered](value T, want any) (int, bool) {
+	w, ok := want.(T)
+	return cmp.Compare(value, w), ok
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,113 @@
+package screener
+
+import "sort"
+
+// Type is the type of a field, which decides the operators and literals it can be compared with.
+type Type int
+
+const (
+	TypeNumber  Type = iota // Compared with numbers, e.g. volume > 1000000000
+	TypePercent             // Stored as fraction, compared with percentages, e.g. ter < 0.2%
+	TypeInt                 // Compared with whole numbers, e.g. nr_positions > 1000
+	TypeText                // Compared with strings, ignoring case and ordered byte by byte. ~ matches parts, e.g. replication ~ "Physisch"
+	TypeBool                // Compared with true or false using = and !=
+	TypeDate                // Compared with "YYYY-MM-DD" strings, e.g. release_date < "2015-01-01"
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeNumber:
+		return "number"
+	case TypePercent:
+		return "percentage"
+	case TypeInt:
+		return "whole number"
+	case TypeText:
+		return "text"
+	case TypeBool:
+		return "boolean"
+	case TypeDate:
+		return "date"
+	}
+	return "unknown"
+}
+
+// Field is a value of an etf a screen can compare.
+type Field struct {
+	Name   string
+	Column string // t_etf column, or the t_etf_composition dimension of keyed fields
+	Type   Type
+	Keyed  bool // Composition weight selected by key, e.g. country["USA"]. Missing keys weigh 0
+}
+
+// Fields are named like the json fields of the scraped list rows and details, see db.EtfDetailsData.
+var fields = map[string]Field{
+	"name":                         {Column: "name", Type: TypeText},
+	"isin":                         {Column: "isin", Type: TypeText},
+	"wkn":                          {Column: "wkn", Type: TypeText},
+	"status":                       {Column: "status", Type: TypeText},
+	"total_expense_ratio":          {Column: "totalExpenseRatio", Type: TypePercent},
+	"fund_volume":                  {Column: "fund_volume_eur", Type: TypeNumber},
+	"share_class_volume":           {Column: "share_class_volume_eur", Type: TypeNumber},
+	"is_distributing":              {Column: "isDistributing", Type: TypeBool},
+	"replication_method":           {Column: "replicationMethod", Type: TypeText},
+	"release_date":                 {Column: "releaseDate", Type: TypeDate},
+	"nr_positions":                 {Column: "nr_positions", Type: TypeInt},
+	"nr_stock_positions":           {Column: "nr_stock_positions", Type: TypeInt},
+	"nr_bond_positions":            {Column: "nr_bond_positions", Type: TypeInt},
+	"nr_cash_and_other_positions":  {Column: "nr_cash_and_other_positions", Type: TypeInt},
+	"base_index":                   {Column: "base_index", Type: TypeText},
+	"fund_domicile":                {Column: "fund_domicile", Type: TypeText},
+	"fund_currency":                {Column: "fund_currency", Type: TypeText},
+	"trade_currency":               {Column: "trade_currency", Type: TypeText},
+	"fund_provider":                {Column: "fund_provider", Type: TypeText},
+	"legal_structure":              {Column: "legal_structure", Type: TypeText},
+	"fund_structure":               {Column: "fund_structure", Type: TypeText},
+	"administrator":                {Column: "administrator", Type: TypeText},
+	"depotbank":                    {Column: "depotbank", Type: TypeText},
+	"auditor":                      {Column: "auditor", Type: TypeText},
+	"securities_lending_permitted": {Column: "securities_lending_permitted", Type: TypeBool},
+	"has_currency_hedging":         {Column: "has_currency_hedging", Type: TypeBool},
+	"has_special_assets":           {Column: "has_special_assets", Type: TypeBool},
+	"weight_top_10":                {Column: "weight_top_10", Type: TypePercent},
+	"performance_1y":               {Column: "performance_1y", Type: TypePercent},
+	"performance_3y":               {Column: "performance_3y", Type: TypePercent},
+	"performance_5y":               {Column: "performance_5y", Type: TypePercent},
+	"country":                      {Column: "country", Type: TypePercent, Keyed: true},
+	"region":                       {Column: "region", Type: TypePercent, Keyed: true},
+	"currency":                     {Column: "currency", Type: TypePercent, Keyed: true},
+	"holding":                      {Column: "holding", Type: TypePercent, Keyed: true},
+	"industry":                     {Column: "industry", Type: TypePercent, Keyed: true},
+}
+
+// Short names of often used fields
+var aliases = map[string]string{
+	"ter":          "total_expense_ratio",
+	"volume":       "fund_volume",
+	"distributing": "is_distributing",
+	"replication":  "replication_method",
+	"domicile":     "fund_domicile",
+	"provider":     "fund_provider",
+	"hedged":       "has_currency_hedging",
+}
+
+// LookupField returns the field with the given name or alias.
+func LookupField(name string) (Field, bool) {
+	if canonical, ok := aliases[name]; ok {
+		name = canonical
+	}
+	field, ok := fields[name]
+	field.Name = name
+	return field, ok
+}
+
+// Fields returns all fields, sorted by name.
+func Fields() []Field {
+	all := make([]Field, 0, len(fields))
+	for name, field := range fields {
+		field.Name = name
+		all = append(all, field)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
@@ -0,0 +1,346 @@
+// Package screener implements the query language of etf screens, e.g.
+//
+//	ter < 0.2% AND country["USA"] < 50% AND nr_positions > 1000 AND replication = "Physisch"
+//
+// A screen combines comparisons of fields with AND, OR, NOT and parentheses. Queries are parsed and type
+// checked against the fields of t_etf once, then either translated to parameterized sql or evaluated in memory.
+package screener
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrInvalidQuery = errors.New("invalid screen")
+
+const (
+	maxQueryLength = 4000
+	maxDepth       = 50 // Nesting of parentheses and NOT
+)
+
+// Query is a parsed and type checked screen.
+type Query struct {
+	source string
+	root   expr
+}
+
+// String returns the query as it was written.
+func (q *Query) String() string {
+	return q.source
+}
+
+type expr interface{}
+
+type andExpr struct{ left, right expr }
+
+type orExpr struct{ left, right expr }
+
+type notExpr struct{ operand expr }
+
+type comparison struct {
+	field Field
+	key   string // Composition key of keyed fields
+	op    string
+	value any // float64, string or bool. Dates are "YYYY-MM-DD" strings
+}
+
+// Parse parses and type checks a screen. Errors wrap ErrInvalidQuery and name the position of the problem.
+func Parse(source string) (*Query, error) {
+	if len(source) > maxQueryLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidQuery, maxQueryLength)
+	}
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEnd {
+		return nil, next.errorf("unexpected %s", next)
+	}
+	return &Query{source: source, root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenPercent
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string // Unquoted for strings
+	pos  int    // Byte offset in the query, counted from 1
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of screen"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func (t token) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: position %d: %s", ErrInvalidQuery, t.pos, fmt.Sprintf(format, args...))
+}
+
+// Keywords are identifiers matched ignoring case
+func (t token) is(keyword string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := source[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case isLetter(c):
+			for i < len(source) && (isLetter(source[i]) || isDigit(source[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, source[start:i], start + 1})
+		case isDigit(c) || c == '-' || c == '.':
+			i++
+			for i < len(source) && (isDigit(source[i]) || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, source[start:i], start + 1})
+		case c == '"':
+			var text strings.Builder
+			for i++; ; i++ {
+				if i >= len(source) {
+					return nil, token{pos: start + 1}.errorf("unterminated string")
+				}
+				if source[i] == '\\' && i+1 < len(source) && (source[i+1] == '"' || source[i+1] == '\\') {
+					i++
+				} else if source[i] == '"' {
+					break
+				}
+				text.WriteByte(source[i])
+			}
+			i++
+			tokens = append(tokens, token{tokenString, text.String(), start + 1})
+		case strings.HasPrefix(source[i:], "<=") || strings.HasPrefix(source[i:], ">=") || strings.HasPrefix(source[i:], "!="):
+			i += 2
+			tokens = append(tokens, token{tokenOperator, source[start:i], start + 1})
+		case c == '<' || c == '>' || c == '=' || c == '~':
+			i++
+			tokens = append(tokens, token{tokenOperator, source[start:i], start + 1})
+		default:
+			kinds := map[byte]tokenKind{'%': tokenPercent, '(': tokenLParen, ')': tokenRParen, '[': tokenLBracket, ']': tokenRBracket}
+			kind, ok := kinds[c]
+			if !ok {
+				r, _ := utf8.DecodeRuneInString(source[i:])
+				return nil, token{pos: start + 1}.errorf("unexpected character %q", r)
+			}
+			i++
+			tokens = append(tokens, token{kind, source[start:i], start + 1})
+		}
+	}
+	return append(tokens, token{kind: tokenEnd, pos: len(source) + 1}), nil
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// parser is a recursive descent parser of
+//
+//	or         = and { "OR" and }
+//	and        = not { "AND" not }
+//	not        = "NOT" not | "(" or ")" | comparison
+//	comparison = field [ "[" string "]" ] operator value
+//	value      = number [ "%" ] | string | "true" | "false"
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.advance()
+	if t.kind != kind {
+		return t, t.errorf("expected %s, found %s", what, t)
+	}
+	return t, nil
+}
+
+func (p *parser) parseOr(depth int) (expr, error) {
+	left, err := p.parseAnd(depth)
+	for err == nil && p.peek().is("OR") {
+		p.advance()
+		var right expr
+		right, err = p.parseAnd(depth)
+		left = orExpr{left, right}
+	}
+	return left, err
+}
+
+func (p *parser) parseAnd(depth int) (expr, error) {
+	left, err := p.parseNot(depth)
+	for err == nil && p.peek().is("AND") {
+		p.advance()
+		var right expr
+		right, err = p.parseNot(depth)
+		left = andExpr{left, right}
+	}
+	return left, err
+}
+
+func (p *parser) parseNot(depth int) (expr, error) {
+	t := p.peek()
+	if depth > maxDepth {
+		return nil, t.errorf("nested deeper than %d levels", maxDepth)
+	}
+	switch {
+	case t.is("NOT"):
+		p.advance()
+		operand, err := p.parseNot(depth + 1)
+		return notExpr{operand}, err
+	case t.kind == tokenLParen:
+		p.advance()
+		inner, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.expect(tokenRParen, `")"`)
+		return inner, err
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	name, err := p.expect(tokenIdent, "field")
+	if err != nil {
+		return nil, err
+	}
+	field, ok := LookupField(name.text)
+	if !ok {
+		return nil, name.errorf("unknown field %s", name)
+	}
+
+	c := comparison{field: field}
+	if field.Keyed {
+		if _, err := p.expect(tokenLBracket, fmt.Sprintf(`"[" after %s, e.g. %s["..."]`, name, name.text)); err != nil {
+			return nil, err
+		}
+		key, err := p.expect(tokenString, "key")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRBracket, `"]"`); err != nil {
+			return nil, err
+		}
+		c.key = key.text
+	}
+
+	op, err := p.expect(tokenOperator, "comparison operator")
+	if err != nil {
+		return nil, err
+	}
+	c.op = op.text
+	switch field.Type {
+	case TypeText:
+	case TypeBool:
+		if c.op != "=" && c.op != "!=" {
+			return nil, op.errorf("%s is a %s and can only be compared with = and !=", name.text, field.Type)
+		}
+	default:
+		if c.op == "~" {
+			return nil, op.errorf("~ only applies to text, %s is a %s", name.text, field.Type)
+		}
+	}
+
+	c.value, err = p.parseValue(field, name.text)
+	return c, err
+}
+
+// parseValue parses the literal compared with the field and checks its type. Errors name the field as written.
+func (p *parser) parseValue(field Field, name string) (any, error) {
+	t := p.advance()
+	mismatch := func(example string) error {
+		return t.errorf("%s is a %s, compare it with e.g. %s instead of %s", name, field.Type, example, t)
+	}
+	switch field.Type {
+	case TypeText:
+		if t.kind != tokenString {
+			return nil, mismatch(`"text"`)
+		}
+		return t.text, nil
+	case TypeBool:
+		if !t.is("true") && !t.is("false") {
+			return nil, mismatch("true")
+		}
+		return t.is("true"), nil
+	case TypeDate:
+		if t.kind != tokenString {
+			return nil, mismatch(`"2020-01-31"`)
+		}
+		if _, err := time.Parse(time.DateOnly, t.text); err != nil {
+			return nil, t.errorf("%s is not a date like \"2020-01-31\"", t)
+		}
+		return t.text, nil
+	}
+
+	if t.kind != tokenNumber {
+		return nil, mismatch(map[Type]string{TypeNumber: "1000000", TypePercent: "0.2%", TypeInt: "100"}[field.Type])
+	}
+	percent := p.peek().kind == tokenPercent
+	text := t.text
+	if percent {
+		text += "e-2" // Shifted in decimal, 0.07% is exactly the float closest to 0.0007
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, t.errorf("%s is not a number", t)
+	}
+	switch {
+	case field.Type == TypePercent && !percent:
+		return nil, t.errorf("%s is a %s, write %s%%", name, field.Type, t.text)
+	case field.Type != TypePercent && percent:
+		return nil, p.peek().errorf("%s is a %s, not a percentage", name, field.Type)
+	case field.Type == TypeInt && number != float64(int64(number)):
+		return nil, mismatch("100")
+	case percent:
+		p.advance()
+	}
+	return number, nil
+}
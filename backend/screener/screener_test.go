@@ -0,0 +1,107 @@
+package screener
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	for query, want := range map[string]string{
+		"":                         "position 1: expected field, found end of screen",
+		"ter < 0.2":                `position 7: ter is a percentage, write 0.2%`,
+		"nr_positions > 10.5":      `position 16: nr_positions is a whole number, compare it with e.g. 100 instead of "10.5"`,
+		"nr_positions > 10%":       "position 18: nr_positions is a whole number, not a percentage",
+		`replication = Physisch`:   `position 15: replication is a text, compare it with e.g. "text" instead of "Physisch"`,
+		"distributing > true":      "position 14: distributing is a boolean and can only be compared with = and !=",
+		"ter ~ 1%":                 "position 5: ~ only applies to text, ter is a percentage",
+		"country < 50%":            `position 9: expected "[" after "country", e.g. country["..."], found "<"`,
+		`release_date > "2020-13"`: `position 16: "2020-13" is not a date like "2020-01-31"`,
+		"unknown = 1":              `position 1: unknown field "unknown"`,
+		"ter < 1% AND":             "position 13: expected field, found end of screen",
+		"(ter < 1%":                `position 10: expected ")", found end of screen`,
+		"ter < 1% ter < 2%":        `position 10: unexpected "ter"`,
+		`name = "Core`:             "position 8: unterminated string",
+		"ter < 1% & volume > 1":    "position 10: unexpected character '&'",
+		"volume > 1.2.3":           `position 10: "1.2.3" is not a number`,
+		strings.Repeat("(", 60):    "position 52: nested deeper than 50 levels",
+	} {
+		_, err := Parse(query)
+		if !errors.Is(err, ErrInvalidQuery) || err.Error() != "invalid screen: "+want {
+			t.Errorf("Parse(%q) error = %v, want %q", query, err, want)
+		}
+	}
+}
+
+// TestSQL checks the parameters of the condition. Its results are compared with Match against postgres in package db.
+func TestSQL(t *testing.T) {
+	query, err := Parse(`ter < 0.2% AND country["USA"] < 50% AND nr_positions > 1000 AND (replication ~ "Physisch" OR NOT distributing = true)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	condition, args := query.SQL(3)
+	if wantArgs := []any{0.002, "country", "USA", 0.5, 1000.0, "Physisch", true}; !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %v, want %v", args, wantArgs)
+	}
+	for i := range args {
+		if param := fmt.Sprintf("$%d", i+3); !strings.Contains(condition, param) {
+			t.Errorf("condition %s doesn't use %s", condition, param)
+		}
+	}
+	if strings.Contains(condition, "$2") || strings.Contains(condition, "$10") {
+		t.Errorf("condition %s uses parameters outside $3 to $9", condition)
+	}
+}
+
+type testRecord struct {
+	values  map[string]any
+	weights map[string]float64
+}
+
+func (r testRecord) Value(column string) any {
+	return r.values[column]
+}
+
+func (r testRecord) Weight(dimension string, key string) float64 {
+	return r.weights[dimension+"/"+key]
+}
+
+func TestMatch(t *testing.T) {
+	record := testRecord{
+		values: map[string]any{
+			"totalexpenseratio": 0.0007,
+			"nr_positions":      int64(1500),
+			"replicationmethod": "Physisch (Optimiertes Sampling)",
+			"isdistributing":    false,
+			"releasedate":       "2009-09-25",
+			"fund_domicile":     nil,
+		},
+		weights: map[string]float64{"country/USA": 0.7189},
+	}
+	for query, want := range map[string]bool{
+		"ter <= 0.07%":             true,
+		"ter < 0.07%":              false,
+		`replication ~ "physisch"`: true,
+		`replication = "physisch"`: false,
+		`replication = "PHYSISCH (optimiertes sampling)"`:     true,
+		"nr_positions > 1000 AND distributing = false":        true,
+		`country["USA"] > 70% AND country["Japan"] = 0%`:      true,
+		`country["USA"] < 50% OR release_date < "2010-01-01"`: true,
+		// Null values are unknown, like in sql
+		`domicile = "Irland"`:                    false,
+		`NOT domicile = "Irland"`:                false,
+		`domicile = "Irland" OR ter < 1%`:        true,
+		`NOT (domicile = "Irland" AND ter > 1%)`: true,
+		`NOT (domicile = "Irland" AND ter < 1%)`: false,
+	} {
+		query, err := Parse(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := query.Match(record); got != want {
+			t.Errorf("%s matches = %v, want %v", query, got, want)
+		}
+	}
+}
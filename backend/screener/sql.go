@@ -0,0 +1,59 @@
+package screener
+
+import "fmt"
+
+// SQL translates the query into a condition on the columns of t_etf. Values are passed as parameters,
+// numbered from firstParam, so the condition can be appended to queries with parameters of their own.
+// Comparisons of null columns are null like in sql, so etfs without a value never match, not even negated.
+func (q *Query) SQL(firstParam int) (string, []any) {
+	t := sqlTranslator{next: firstParam}
+	condition := t.translate(q.root)
+	return condition, t.args
+}
+
+type sqlTranslator struct {
+	next int
+	args []any
+}
+
+func (t *sqlTranslator) param(value any) string {
+	t.args = append(t.args, value)
+	t.next++
+	return fmt.Sprintf("$%d", t.next-1)
+}
+
+func (t *sqlTranslator) translate(e expr) string {
+	switch e := e.(type) {
+	case andExpr:
+		return "(" + t.translate(e.left) + " AND " + t.translate(e.right) + ")"
+	case orExpr:
+		return "(" + t.translate(e.left) + " OR " + t.translate(e.right) + ")"
+	case notExpr:
+		return "(NOT " + t.translate(e.operand) + ")"
+	case comparison:
+		return t.comparison(e)
+	}
+	panic(fmt.Sprintf("screener: unknown expression %T", e))
+}
+
+func (t *sqlTranslator) comparison(c comparison) string {
+	op := c.op
+	if op == "!=" {
+		op = "<>"
+	}
+	// Column names come from the field catalog, never from the query
+	column := "t_etf." + c.field.Column
+	switch {
+	case c.field.Keyed:
+		column = fmt.Sprintf("coalesce((SELECT c.weight FROM t_etf_composition c WHERE c.etf_id = t_etf.id AND c.dimension = %s AND c.key = %s), 0)",
+			t.param(c.field.Column), t.param(c.key))
+		return fmt.Sprintf("%s %s %s::NUMERIC", column, op, t.param(c.value))
+	case c.field.Type == TypeText && op == "~":
+		return fmt.Sprintf("strpos(lower(%s), lower(%s)) > 0", column, t.param(c.value))
+	case c.field.Type == TypeText:
+		// Ordered byte by byte like in Match, whatever the collation of the database
+		return fmt.Sprintf(`lower(%s) COLLATE "C" %s lower(%s)`, column, op, t.param(c.value))
+	}
+	casts := map[Type]string{TypeNumber: "NUMERIC", TypePercent: "NUMERIC", TypeInt: "NUMERIC", TypeBool: "BOOLEAN", TypeDate: "DATE"}
+	return fmt.Sprintf("%s %s %s::%s", column, op, t.param(c.value), casts[c.field.Type])
+}
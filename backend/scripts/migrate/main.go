@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -9,6 +10,7 @@ import (
 	"runtime"
 	"time"
 
+	"backend/config"
 	"backend/db"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
@@ -19,6 +21,7 @@ func main() {
 	// Define flags for command-line arguments
 	operation := flag.String("op", "", "Operation to perform: up, down, create")
 	migrationName := flag.String("name", "", "Name of the migration to create (required for create)")
+	loader := config.NewLoader(flag.CommandLine)
 	flag.Parse()
 
 	_, filename, _, _ := runtime.Caller(0) // Gets this files path
@@ -26,9 +29,9 @@ func main() {
 
 	switch *operation {
 	case "up":
-		runMigrations(migrationsDir, "up")
+		runMigrations(loader, migrationsDir, "up")
 	case "down":
-		runMigrations(migrationsDir, "down")
+		runMigrations(loader, migrationsDir, "down")
 	case "create":
 		if *migrationName == "" {
 			log.Fatalf("You must provide a migration name with -name for the create operation")
@@ -39,10 +42,16 @@ func main() {
 	}
 }
 
-func runMigrations(migrationsDir, direction string) {
-	// Use your existing db package to get a database connection
-	db.Establish_db_conn()
-	conn := db.GetDb() // Adjust to match your package's method
+func runMigrations(loader *config.Loader, migrationsDir, direction string) {
+	// Same config sources as the backend itself
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	conn, err := db.Connect(context.Background(), cfg.DB.ConnString())
+	if err != nil {
+		log.Fatal(err)
+	}
 	defer conn.Close()
 
 	// Get the PostgreSQL driver instance
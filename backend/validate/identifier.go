@@ -0,0 +1,91 @@
+// Package validate checks the identifiers of securities scraped from finanzfluss, i.e. ISINs and WKNs.
+// Values are normalized (trimmed and upper cased) before they are checked and returned in normalized form.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidISIN = errors.New("invalid isin")
+	ErrInvalidWKN  = errors.New("invalid wkn")
+)
+
+// ISIN checks an International Securities Identification Number (ISO 6166):
+// a two letter country code, nine alphanumeric characters and a check digit.
+// The check digit is verified with the Luhn algorithm over the value with letters expanded to numbers (A=10 ... Z=35).
+func ISIN(value string) (string, error) {
+	isin := strings.ToUpper(strings.TrimSpace(value))
+	if len(isin) != 12 {
+		return "", fmt.Errorf("%w: %q has %d characters, want 12", ErrInvalidISIN, value, len(isin))
+	}
+	if !isLetter(isin[0]) || !isLetter(isin[1]) {
+		return "", fmt.Errorf("%w: %q does not start with a country code", ErrInvalidISIN, value)
+	}
+	for i := 2; i < 11; i++ {
+		if !isLetter(isin[i]) && !isDigit(isin[i]) {
+			return "", fmt.Errorf("%w: %q contains %q", ErrInvalidISIN, value, isin[i])
+		}
+	}
+	if !isDigit(isin[11]) {
+		return "", fmt.Errorf("%w: %q does not end with a check digit", ErrInvalidISIN, value)
+	}
+	if want := isinCheckDigit(isin[:11]); isin[11] != want {
+		return "", fmt.Errorf("%w: %q has check digit %c, want %c", ErrInvalidISIN, value, isin[11], want)
+	}
+	return isin, nil
+}
+
+// isinCheckDigit computes the check digit of the first 11 characters of an ISIN.
+func isinCheckDigit(payload string) byte {
+	var digits []int
+	for i := 0; i < len(payload); i++ {
+		c := payload[i]
+		if isDigit(c) {
+			digits = append(digits, int(c-'0'))
+			continue
+		}
+		n := int(c-'A') + 10
+		digits = append(digits, n/10, n%10)
+	}
+	// Luhn: double every second digit, starting with the rightmost one as the check digit is appended to it
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// WKN checks a Wertpapierkennnummer, the german securities identification number:
+// six digits or upper case letters except I and O, which are not used to avoid confusion with 1 and 0.
+// A WKN has no check digit.
+func WKN(value string) (string, error) {
+	wkn := strings.ToUpper(strings.TrimSpace(value))
+	if len(wkn) != 6 {
+		return "", fmt.Errorf("%w: %q has %d characters, want 6", ErrInvalidWKN, value, len(wkn))
+	}
+	for i := 0; i < len(wkn); i++ {
+		c := wkn[i]
+		if !isDigit(c) && (!isLetter(c) || c == 'I' || c == 'O') {
+			return "", fmt.Errorf("%w: %q contains %q", ErrInvalidWKN, value, c)
+		}
+	}
+	return wkn, nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,43 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestISIN(t *testing.T) {
+	valid := map[string]string{
+		"IE00B4L5Y983":   "IE00B4L5Y983",
+		" ie00b4l5y983 ": "IE00B4L5Y983",
+		"US0378331005":   "US0378331005",
+		"DE000A0F5UF5":   "DE000A0F5UF5",
+		"LU2572257124":   "LU2572257124",
+	}
+	for value, want := range valid {
+		got, err := ISIN(value)
+		if err != nil || got != want {
+			t.Errorf("ISIN(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "IE00B4L5Y98", "IE00B4L5Y984", "1E00B4L5Y983", "IE00B4L5Y9-3", "IE00B4L5Y98X", "—"} {
+		if _, err := ISIN(value); !errors.Is(err, ErrInvalidISIN) {
+			t.Errorf("ISIN(%q) error = %v, want ErrInvalidISIN", value, err)
+		}
+	}
+}
+
+func TestWKN(t *testing.T) {
+	for value, want := range map[string]string{"A0RPWH": "A0RPWH", "a1jx52 ": "A1JX52", "593393": "593393"} {
+		got, err := WKN(value)
+		if err != nil || got != want {
+			t.Errorf("WKN(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "A0RPW", "A0RPWHX", "A0RPWI", "A0RPWO", "A0-PWH"} {
+		if _, err := WKN(value); !errors.Is(err, ErrInvalidWKN) {
+			t.Errorf("WKN(%q) error = %v, want ErrInvalidWKN", value, err)
+		}
+	}
+}